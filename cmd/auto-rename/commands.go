@@ -0,0 +1,184 @@
+// Maintenance commands for auto-rename
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/infrastructure"
+	"auto-rename/internal/usecase"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// runCommand chạy lệnh bảo trì được truyền sau các flag, ví dụ: auto-rename -db=x.db backup
+func runCommand(cfg config.Config, args []string) error {
+	switch args[0] {
+	case "backup":
+		db, err := infrastructure.NewDatabase(cfg.DbPath)
+		if err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		defer db.Close()
+		path, err := usecase.BackupDatabase(cfg, db)
+		if err != nil {
+			return err
+		}
+		slog.Info("backup created", "path", path)
+		return nil
+	case "restore":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: auto-rename [flags] restore <backup-file>")
+		}
+		previous, err := infrastructure.RestoreBackup(args[1], cfg.DbPath)
+		if err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		if previous != "" {
+			slog.Info("previous database kept", "path", previous)
+		}
+		slog.Info("database restored", "db", cfg.DbPath, "backup", args[1])
+		return nil
+	case "audit":
+		if len(args) < 2 || args[1] != "verify" {
+			return fmt.Errorf("usage: auto-rename [flags] audit verify")
+		}
+		db, err := infrastructure.NewDatabase(cfg.DbPath)
+		if err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		defer db.Close()
+		result, err := db.VerifyAuditLog()
+		if err != nil {
+			return err
+		}
+		if !result.Valid {
+			return fmt.Errorf("audit log is broken at entry %d: %s (%d entries)", result.BrokenAt, result.Problem, result.Entries)
+		}
+		slog.Info("audit log OK", "entries", result.Entries, "last_hash", result.LastHash)
+		return nil
+	case "undo":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: auto-rename [flags] undo <record-id>...")
+		}
+		db, err := infrastructure.NewDatabase(cfg.DbPath)
+		if err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		defer db.Close()
+		failed := 0
+		// Bản ghi của một nhóm file đi kèm được hoàn tác cùng nhau
+		undone := map[int]bool{}
+		for _, arg := range args[1:] {
+			id, err := strconv.Atoi(arg)
+			if err == nil && undone[id] {
+				continue
+			}
+			if err == nil {
+				records, undoErr := usecase.UndoRename(db, id)
+				for _, r := range records {
+					undone[r.Id] = true
+				}
+				err = undoErr
+			}
+			if err != nil {
+				slog.Error("undo failed", "id", arg, "error", err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("undo failed for %d of %d records", failed, len(args)-1)
+		}
+		return nil
+	case "rules":
+		if len(args) < 3 || args[1] != "test" {
+			return fmt.Errorf("usage: auto-rename -rules=<file> rules test <path>...")
+		}
+		db, err := infrastructure.NewDatabase(cfg.DbPath)
+		if err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		defer db.Close()
+		failed := 0
+		for _, path := range args[2:] {
+			if err := printRuleTest(cfg, db, path); err != nil {
+				fmt.Printf("%s\n  error: %v\n", path, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("rules failed for %d of %d files", failed, len(args)-2)
+		}
+		return nil
+	case "foreign":
+		if cfg.Dir == "" {
+			return fmt.Errorf("usage: auto-rename -dir=<dir> foreign")
+		}
+		db, err := infrastructure.NewDatabase(cfg.DbPath)
+		if err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		defer db.Close()
+		foreign, err := usecase.FindForeignFiles(cfg, db)
+		if err != nil {
+			return err
+		}
+		for _, path := range foreign {
+			fmt.Println(path)
+		}
+		slog.Info("foreign files found", "dir", cfg.Dir, "count", len(foreign))
+		return nil
+	case "hash-password":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: auto-rename hash-password <password>")
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(args[1]), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(hash))
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// printRuleTest in biến của file và quyết định của luật, không đổi tên file
+func printRuleTest(cfg config.Config, db *infrastructure.Database, path string) error {
+	test, err := usecase.TestRules(cfg, db, path)
+	if err != nil {
+		return err
+	}
+	fmt.Println(test.Path)
+	fmt.Printf("  root: %s\n", test.Root)
+	names := make([]string, 0, len(test.Vars))
+	for name := range test.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-12s = %s\n", name, test.Vars[name])
+	}
+	d := test.Decision
+	switch {
+	case !d.Matched:
+		fmt.Println("  no rule matched: default UUID name")
+	case d.Skip:
+		fmt.Printf("  rule %s: skip (%s)\n", d.Rule, d.Reason)
+	default:
+		name := d.Name
+		if name == "" {
+			name = "<uuid>" + test.Ext
+		}
+		dir := filepath.Dir(test.Path)
+		if d.Dir != "" {
+			dir = filepath.Join(test.Root, filepath.FromSlash(d.Dir))
+		}
+		fmt.Printf("  rule %s: rename to %s\n", d.Rule, filepath.Join(dir, name))
+	}
+	return nil
+}
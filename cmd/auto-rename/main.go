@@ -2,8 +2,12 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"auto-rename/internal/config"
 	"auto-rename/internal/delivery"
@@ -11,46 +15,97 @@ import (
 	"auto-rename/internal/usecase"
 )
 
+// webhookShutdownTimeout là thời gian tối đa chờ gửi webhook khi thoát
+const webhookShutdownTimeout = 30 * time.Second
+
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Printf("Environment variables:")
-	cfg := config.ParseFlags()
-	// log.Printf("config.Cron=%v", cfg.Cron)
-	// log.Printf("config.Dir=%v", cfg.Dir)
+	cfg, err := config.ParseFlags()
+	if err != nil {
+		fatal("configuration error", "error", err)
+	}
+	if err := infrastructure.SetupLogging(cfg.LogLevel, cfg.LogFormat, cfg.LogBufferSize); err != nil {
+		fatal("logging setup failed", "error", err)
+	}
+	slog.Info("configuration loaded", "config", cfg)
+	slog.Debug("command line", "args", os.Args)
+
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(cfg, args); err != nil {
+			fatal("command failed", "command", args[0], "error", err)
+		}
+		return
+	}
 
 	if err := config.ValidateConfig(cfg); err != nil {
-		log.Fatalf("Configuration error: %v", err)
+		fatal("configuration error", "error", err)
 	}
 
 	db, err := infrastructure.NewDatabase(cfg.DbPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("failed to initialize database", "db", cfg.DbPath, "error", err)
 	}
 	defer db.Close()
 
+	// Bắt đầu trước lượt quét đầu tiên để không bỏ lỡ event của nó
+	usecase.StartWebhooks(cfg, db)
+
 	if !cfg.WebOnly && cfg.Dir != "" {
 		if err := usecase.RenameFiles(cfg, db); err != nil {
-			log.Fatalf("Error renaming files: %v", err)
+			fatal("error renaming files", "root", cfg.Dir, "error", err)
 		}
 	}
 
+	if cfg.Cron || cfg.WebPort != "" {
+		// Chạy lâu (cron, web): khi bị dừng thì gửi nốt webhook đang chờ rồi thoát
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			sig := <-signals
+			slog.Info("shutting down", "signal", sig.String())
+			usecase.StopWebhooks(webhookShutdownTimeout)
+			os.Exit(0)
+		}()
+	}
+
 	if cfg.Cron {
 		if cfg.Dir == "" {
-			log.Fatalf("-cron requires -dir to be specified")
+			fatal("-cron requires -dir to be specified")
 		}
-		log.Printf("Cron mode enabled: scanning %s every 60s", cfg.Dir)
+		slog.Info("cron mode enabled", "root", cfg.Dir, "interval", usecase.CronInterval)
 		go usecase.StartCronScanner(cfg, db)
 	}
 
+	// Worker luôn chạy để thực hiện các đề xuất được duyệt qua web UI
+	go usecase.StartReviewWorker(cfg, db)
+	// Thử lại đổi tên lỗi tạm thời và các file được thử lại thủ công qua web UI
+	go usecase.StartRetryWorker(cfg, db)
+
+	if cfg.BackupInterval > 0 {
+		go usecase.StartBackupScheduler(cfg, db)
+	}
+
 	if cfg.WebPort != "" {
-		fmt.Printf("\nStarting web server on port %s...\n", cfg.WebPort)
-		fmt.Printf("View results at: http://localhost:%s\n", cfg.WebPort)
-		webServer := delivery.NewWebServer(db, cfg.WebPort)
-		log.Fatal(webServer.Start())
+		slog.Info("starting web server", "port", cfg.WebPort, "url", "http://localhost:"+cfg.WebPort)
+		if !cfg.AuthEnabled() {
+			slog.Warn("no AUTH_TOKENS or AUTH_USERS_FILE configured, web interface is open to anyone who can reach the port", "port", cfg.WebPort)
+		}
+		webServer := delivery.NewWebServer(db, cfg)
+		err := webServer.Start()
+		usecase.StopWebhooks(webhookShutdownTimeout)
+		fatal("web server stopped", "error", err)
 	}
 
 	if cfg.Cron && cfg.WebPort == "" {
 		// Block main goroutine so cron scanner keeps running if no web server
 		select {}
 	}
+
+	// Chạy một lần: chờ gửi nốt webhook của lượt quét trước khi thoát
+	usecase.StopWebhooks(webhookShutdownTimeout)
+}
+
+// fatal ghi log lỗi rồi thoát, thay cho log.Fatalf
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -2,11 +2,19 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+
+	"auto-rename/internal/domain"
+	"auto-rename/internal/rules"
 
 	"github.com/joho/godotenv"
 )
@@ -20,10 +28,120 @@ type Config struct {
 	DbPath          string
 	Cron            bool
 	RenameSubfolder bool
+	BackupDir       string
+	BackupInterval  time.Duration
+	BackupKeep      int
+	Workers         int
+	DBBatchSize     int
+	ProfilesFile    string
+	Profiles        map[string]Profile
+	ReviewMode      bool
+	ReviewExpiry    time.Duration
+	AuthTokens      map[string]string
+	AuthUsersFile   string
+	AuthUsers       []domain.User
+	SessionSecret   string
+	SessionTTL      time.Duration
+	// LivenessIntervals là số chu kỳ cron được phép bỏ lỡ trước khi /healthz báo lỗi
+	LivenessIntervals int
+	LogLevel          slog.Level
+	LogFormat         string
+	LogBufferSize     int
+	WebhooksFile      string
+	Webhooks          []Webhook
+	HooksFile         string
+	Hooks             Hooks
+	RulesFile         string
+	Rules             *rules.Set
+	// Layout chuyển file đã đổi tên vào cây thư mục dưới LayoutDir (mặc định là Dir)
+	Layout    string
+	LayoutDir string
+	// CollisionPolicy là cách xử lý khi đích đổi tên đã có file
+	CollisionPolicy string
+	// RetryMaxAttempts là số lần tự thử lại đổi tên lỗi tạm thời, 0 là tắt;
+	// khoảng chờ bắt đầu từ RetryBackoff và nhân đôi sau mỗi lần
+	RetryMaxAttempts int
+	RetryBackoff     time.Duration
+	// ExtensionFixes là các cách sửa đuôi file theo nội dung: missing, case, mismatch
+	ExtensionFixes []string
+	// CompoundExtensions là các đuôi ghép như .tar.gz được giữ nguyên khi đổi tên,
+	// chữ thường, dài trước ngắn sau
+	CompoundExtensions []string
+	// ConfirmRenamed chỉ coi file tên UUID là đã đổi tên khi DB có bản ghi đổi
+	// tên ra tên đó; file còn lại được báo là foreign
+	ConfirmRenamed bool
+	// SidecarExtensions là đuôi của file đi kèm (vd .xmp, .srt), chữ thường; file
+	// đi kèm được đổi tên cùng file chính có cùng tên gốc
+	SidecarExtensions []string
+}
+
+// DefaultCompoundExtensions là danh sách đuôi ghép mặc định
+const DefaultCompoundExtensions = ".tar.gz,.tar.bz2,.tar.xz,.tar.zst,.tar.lz,.tar.lz4,.tar.lzma,.tar.z,.min.js,.min.mjs,.min.css,.d.ts,.d.mts,.d.cts,.js.map,.css.map,.user.js"
+
+// DefaultSidecarExtensions là danh sách đuôi file đi kèm mặc định
+const DefaultSidecarExtensions = ".xmp,.aae,.thm,.lrv,.srt,.vtt,.ass,.ssa,.sub,.idx,.sup"
+
+// Profile là bộ cấu hình quét đặt tên, dùng khi kích hoạt quét từ web UI
+type Profile struct {
+	Dir             string `json:"dir"`
+	DryRun          *bool  `json:"dry_run,omitempty"`
+	RenameSubfolder *bool  `json:"rename_subfolder,omitempty"`
+	Review          *bool  `json:"review,omitempty"`
+	Layout          string `json:"layout,omitempty"`
+	LayoutDir       string `json:"layout_dir,omitempty"`
+}
+
+// Webhook là một endpoint nhận thông báo; Events rỗng là nhận mọi event.
+// Batch gom file-renamed của một lượt quét thành một payload files-renamed.
+type Webhook struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Batch       bool     `json:"batch,omitempty"`
+	MaxAttempts int      `json:"max_attempts,omitempty"`
+}
+
+// Wants kiểm tra webhook có đăng ký event
+func (w Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultHookTimeout là thời gian chạy tối đa của hook không cấu hình timeout
+const DefaultHookTimeout = 30 * time.Second
+
+// HookCommand là một lệnh shell chạy quanh việc đổi tên
+type HookCommand struct {
+	Name    string        `json:"name"`
+	Command string        `json:"command"`
+	Timeout time.Duration `json:"-"`
+	// TimeoutText là timeout trong file cấu hình, vd "30s"
+	TimeoutText string `json:"timeout,omitempty"`
+}
+
+// Hooks là các lệnh chạy trước/sau mỗi lần đổi tên và lúc bắt đầu/kết thúc lượt quét
+type Hooks struct {
+	PreRename  []HookCommand `json:"pre_rename,omitempty"`
+	PostRename []HookCommand `json:"post_rename,omitempty"`
+	RunStart   []HookCommand `json:"run_start,omitempty"`
+	RunEnd     []HookCommand `json:"run_end,omitempty"`
+}
+
+// Count trả về tổng số hook đã cấu hình
+func (h Hooks) Count() int {
+	return len(h.PreRename) + len(h.PostRename) + len(h.RunStart) + len(h.RunEnd)
 }
 
 // parseFlags lấy config từ flag và env
-func ParseFlags() Config {
+func ParseFlags() (Config, error) {
 	_ = godotenv.Load()
 	envDir := os.Getenv("DIR")
 	envDryRun := getBoolEnv("DRY_RUN", false)
@@ -32,16 +150,34 @@ func ParseFlags() Config {
 	envDbPath := getEnv("DB_PATH", "./file_renames.db")
 	envCron := getBoolEnv("CRON", false)
 	envRenameSubfolder := getBoolEnv("RENAME_SUBFOLDER", true)
-
-	log.Printf("Reading configuration...")
-	log.Printf("envDir=%v", envDir)
-	log.Printf("envDryRun=%v", envDryRun)
-	log.Printf("envWebPort=%v", envWebPort)
-	log.Printf("envWebOnly=%v", envWebOnly)
-	log.Printf("envDbPath=%v", envDbPath)
-	log.Printf("envCron=%v", envCron)
-	log.Printf("envRenameSubfolder=%v", envRenameSubfolder)
-	log.Printf("Command line args: %v", os.Args)
+	envBackupDir := getEnv("BACKUP_DIR", "./backups")
+	envBackupInterval := getDurationEnv("BACKUP_INTERVAL", 0)
+	envBackupKeep := getIntEnv("BACKUP_KEEP", 7)
+	envWorkers := getIntEnv("WORKERS", 4)
+	envDBBatchSize := getIntEnv("DB_BATCH_SIZE", 100)
+	envProfilesFile := os.Getenv("PROFILES_FILE")
+	envReviewMode := getBoolEnv("REVIEW_MODE", false)
+	envReviewExpiry := getDurationEnv("REVIEW_EXPIRY", 7*24*time.Hour)
+	envAuthTokens := os.Getenv("AUTH_TOKENS")
+	envAuthUsersFile := os.Getenv("AUTH_USERS_FILE")
+	envSessionSecret := os.Getenv("SESSION_SECRET")
+	envSessionTTL := getDurationEnv("SESSION_TTL", 12*time.Hour)
+	envLivenessIntervals := getIntEnv("LIVENESS_INTERVALS", 3)
+	envLogLevel := getEnv("LOG_LEVEL", "info")
+	envLogFormat := getEnv("LOG_FORMAT", "text")
+	envLogBufferSize := getIntEnv("LOG_BUFFER_SIZE", 1000)
+	envWebhooksFile := os.Getenv("WEBHOOKS_FILE")
+	envHooksFile := os.Getenv("HOOKS_FILE")
+	envRulesFile := os.Getenv("RULES_FILE")
+	envLayout := os.Getenv("LAYOUT")
+	envLayoutDir := os.Getenv("LAYOUT_DIR")
+	envCollisionPolicy := getEnv("COLLISION_POLICY", domain.CollisionRegenerate)
+	envRetryMaxAttempts := getIntEnv("RETRY_MAX_ATTEMPTS", 5)
+	envRetryBackoff := getDurationEnv("RETRY_BACKOFF", time.Minute)
+	envFixExtensions := os.Getenv("FIX_EXTENSIONS")
+	envConfirmRenamed := getBoolEnv("CONFIRM_RENAMED", false)
+	envCompoundExtensions := getEnv("COMPOUND_EXTENSIONS", DefaultCompoundExtensions)
+	envSidecarExtensions := getEnv("SIDECAR_EXTENSIONS", DefaultSidecarExtensions)
 
 	var config Config
 	flag.StringVar(&config.Dir, "dir", envDir, "Directory containing files to rename (can also set DIR env var)")
@@ -51,9 +187,395 @@ func ParseFlags() Config {
 	flag.StringVar(&config.DbPath, "db", envDbPath, "SQLite database path (can also set DB_PATH env var)")
 	flag.BoolVar(&config.Cron, "cron", envCron, "Continuously scan directory every minute (can also set CRON env var)")
 	flag.BoolVar(&config.RenameSubfolder, "rename-subfolder", envRenameSubfolder, "Allow renaming files in subfolders (can also set RENAME_SUBFOLDER env var)")
+	flag.StringVar(&config.BackupDir, "backup-dir", envBackupDir, "Directory for database backups (can also set BACKUP_DIR env var)")
+	flag.DurationVar(&config.BackupInterval, "backup-interval", envBackupInterval, "Interval between scheduled backups, 0 disables (can also set BACKUP_INTERVAL env var)")
+	flag.IntVar(&config.BackupKeep, "backup-keep", envBackupKeep, "Number of backups to keep when rotating (can also set BACKUP_KEEP env var)")
+	flag.IntVar(&config.Workers, "workers", envWorkers, "Number of files renamed concurrently (can also set WORKERS env var)")
+	flag.IntVar(&config.DBBatchSize, "db-batch-size", envDBBatchSize, "Number of records written per database transaction (can also set DB_BATCH_SIZE env var)")
+	flag.StringVar(&config.ProfilesFile, "profiles", envProfilesFile, "JSON file with named scan profiles (can also set PROFILES_FILE env var)")
+	flag.BoolVar(&config.ReviewMode, "review", envReviewMode, "Queue planned renames for approval instead of renaming immediately (can also set REVIEW_MODE env var)")
+	flag.DurationVar(&config.ReviewExpiry, "review-expiry", envReviewExpiry, "How long planned renames wait for approval before expiring (can also set REVIEW_EXPIRY env var)")
+	authTokens := flag.String("auth-tokens", envAuthTokens, "Comma-separated bearer tokens with roles, e.g. token:admin (can also set AUTH_TOKENS env var)")
+	flag.StringVar(&config.AuthUsersFile, "auth-users", envAuthUsersFile, "File with name:bcrypt-hash:role lines for basic auth and login (can also set AUTH_USERS_FILE env var)")
+	flag.StringVar(&config.SessionSecret, "session-secret", envSessionSecret, "Secret used to sign login sessions (can also set SESSION_SECRET env var)")
+	flag.DurationVar(&config.SessionTTL, "session-ttl", envSessionTTL, "Lifetime of login sessions (can also set SESSION_TTL env var)")
+	flag.IntVar(&config.LivenessIntervals, "liveness-intervals", envLivenessIntervals, "Missed cron intervals before the scanner is reported unhealthy (can also set LIVENESS_INTERVALS env var)")
+	logLevel := flag.String("log-level", envLogLevel, "Minimum log level: debug, info, warn or error (can also set LOG_LEVEL env var)")
+	flag.StringVar(&config.LogFormat, "log-format", envLogFormat, "Log output format: text or json (can also set LOG_FORMAT env var)")
+	flag.IntVar(&config.LogBufferSize, "log-buffer-size", envLogBufferSize, "Recent log lines kept in memory for the web UI (can also set LOG_BUFFER_SIZE env var)")
+	flag.StringVar(&config.WebhooksFile, "webhooks", envWebhooksFile, "JSON file with outbound webhooks (can also set WEBHOOKS_FILE env var)")
+	flag.StringVar(&config.HooksFile, "hooks", envHooksFile, "JSON file with commands run around renames (can also set HOOKS_FILE env var)")
+	flag.StringVar(&config.RulesFile, "rules", envRulesFile, "File with naming rules (can also set RULES_FILE env var)")
+	flag.StringVar(&config.Layout, "layout", envLayout, "Move renamed files into a folder layout: uuid, hash or date; empty renames in place (can also set LAYOUT env var)")
+	flag.StringVar(&config.LayoutDir, "layout-dir", envLayoutDir, "Root of the folder layout, defaults to the scanned directory (can also set LAYOUT_DIR env var)")
+	flag.StringVar(&config.CollisionPolicy, "collision-policy", envCollisionPolicy, "What to do when the new name is taken: regenerate, suffix, skip or fail (can also set COLLISION_POLICY env var)")
+	flag.IntVar(&config.RetryMaxAttempts, "retry-max-attempts", envRetryMaxAttempts, "Automatic retries of a rename that failed with a transient error, 0 disables (can also set RETRY_MAX_ATTEMPTS env var)")
+	flag.DurationVar(&config.RetryBackoff, "retry-backoff", envRetryBackoff, "Wait before the first retry, doubled after each failed retry (can also set RETRY_BACKOFF env var)")
+	fixExtensions := flag.String("fix-extensions", envFixExtensions, "Comma-separated extension fixes based on the file content: missing, case, mismatch (can also set FIX_EXTENSIONS env var)")
+	flag.BoolVar(&config.ConfirmRenamed, "confirm-renamed", envConfirmRenamed, "Treat UUID-named files as renamed only if the database has a record of the rename; others are reported as foreign (can also set CONFIRM_RENAMED env var)")
+	compoundExtensions := flag.String("compound-extensions", envCompoundExtensions, "Comma-separated multi-part extensions kept whole when renaming, e.g. .tar.gz (can also set COMPOUND_EXTENSIONS env var)")
+	sidecarExtensions := flag.String("sidecar-extensions", envSidecarExtensions, "Comma-separated extensions of sidecar files renamed together with the main file of the same name, e.g. .xmp,.srt (can also set SIDECAR_EXTENSIONS env var)")
 	flag.Parse()
 
-	return config
+	if err := config.LogLevel.UnmarshalText([]byte(*logLevel)); err != nil {
+		return config, fmt.Errorf("invalid log level %q", *logLevel)
+	}
+	if config.LogFormat != "text" && config.LogFormat != "json" {
+		return config, fmt.Errorf("invalid log format %q, expected text or json", config.LogFormat)
+	}
+	if !domain.ValidLayout(config.Layout) {
+		return config, fmt.Errorf("invalid layout %q, expected uuid, hash or date", config.Layout)
+	}
+	if !domain.ValidCollisionPolicy(config.CollisionPolicy) {
+		return config, fmt.Errorf("invalid collision policy %q, expected regenerate, suffix, skip or fail", config.CollisionPolicy)
+	}
+	if config.RetryMaxAttempts < 0 {
+		return config, fmt.Errorf("invalid retry max attempts %d, must not be negative", config.RetryMaxAttempts)
+	}
+
+	fixes, err := ParseExtensionFixes(*fixExtensions)
+	if err != nil {
+		return config, fmt.Errorf("invalid extension fixes: %w", err)
+	}
+	config.ExtensionFixes = fixes
+	compound, err := ParseCompoundExtensions(*compoundExtensions)
+	if err != nil {
+		return config, fmt.Errorf("invalid compound extensions: %w", err)
+	}
+	config.CompoundExtensions = compound
+	sidecars, err := ParseSidecarExtensions(*sidecarExtensions)
+	if err != nil {
+		return config, fmt.Errorf("invalid sidecar extensions: %w", err)
+	}
+	config.SidecarExtensions = sidecars
+
+	tokens, err := ParseAuthTokens(*authTokens)
+	if err != nil {
+		return config, fmt.Errorf("invalid auth tokens: %w", err)
+	}
+	config.AuthTokens = tokens
+	if config.AuthUsersFile != "" {
+		users, err := LoadUsers(config.AuthUsersFile)
+		if err != nil {
+			return config, fmt.Errorf("failed to load users: %w", err)
+		}
+		config.AuthUsers = users
+	}
+
+	if config.ProfilesFile != "" {
+		profiles, err := LoadProfiles(config.ProfilesFile)
+		if err != nil {
+			return config, fmt.Errorf("failed to load profiles: %w", err)
+		}
+		config.Profiles = profiles
+	}
+
+	if config.WebhooksFile != "" {
+		webhooks, err := LoadWebhooks(config.WebhooksFile)
+		if err != nil {
+			return config, fmt.Errorf("failed to load webhooks: %w", err)
+		}
+		config.Webhooks = webhooks
+	}
+
+	if config.HooksFile != "" {
+		hooks, err := LoadHooks(config.HooksFile)
+		if err != nil {
+			return config, fmt.Errorf("failed to load hooks: %w", err)
+		}
+		config.Hooks = hooks
+	}
+
+	if config.RulesFile != "" {
+		set, err := rules.Load(config.RulesFile)
+		if err != nil {
+			return config, fmt.Errorf("failed to load rules: %w", err)
+		}
+		config.Rules = set
+	}
+
+	return config, nil
+}
+
+// LogValue ghi cấu hình đang dùng vào log (slog.LogValuer), ẩn các giá trị bí mật
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("dir", c.Dir),
+		slog.Bool("dry_run", c.DryRun),
+		slog.String("web_port", c.WebPort),
+		slog.Bool("web_only", c.WebOnly),
+		slog.String("db", c.DbPath),
+		slog.Bool("cron", c.Cron),
+		slog.Bool("rename_subfolder", c.RenameSubfolder),
+		slog.String("backup_dir", c.BackupDir),
+		slog.String("backup_interval", c.BackupInterval.String()),
+		slog.Int("backup_keep", c.BackupKeep),
+		slog.Int("workers", c.Workers),
+		slog.Int("db_batch_size", c.DBBatchSize),
+		slog.String("profiles", c.ProfilesFile),
+		slog.Bool("review", c.ReviewMode),
+		slog.String("review_expiry", c.ReviewExpiry.String()),
+		slog.Int("auth_tokens", len(c.AuthTokens)),
+		slog.String("auth_users", c.AuthUsersFile),
+		slog.String("session_secret", maskSecret(c.SessionSecret)),
+		slog.String("session_ttl", c.SessionTTL.String()),
+		slog.Int("liveness_intervals", c.LivenessIntervals),
+		slog.String("log_level", c.LogLevel.String()),
+		slog.String("log_format", c.LogFormat),
+		slog.Int("log_buffer_size", c.LogBufferSize),
+		slog.String("webhooks", c.WebhooksFile),
+		slog.Int("webhook_count", len(c.Webhooks)),
+		slog.String("hooks", c.HooksFile),
+		slog.Int("hook_count", c.Hooks.Count()),
+		slog.String("rules", c.RulesFile),
+		slog.Int("rule_count", c.Rules.Len()),
+		slog.String("layout", c.Layout),
+		slog.String("layout_dir", c.LayoutDir),
+		slog.String("collision_policy", c.CollisionPolicy),
+		slog.Int("retry_max_attempts", c.RetryMaxAttempts),
+		slog.Duration("retry_backoff", c.RetryBackoff),
+		slog.String("fix_extensions", strings.Join(c.ExtensionFixes, ",")),
+		slog.String("compound_extensions", strings.Join(c.CompoundExtensions, ",")),
+		slog.String("sidecar_extensions", strings.Join(c.SidecarExtensions, ",")),
+		slog.Bool("confirm_renamed", c.ConfirmRenamed),
+	)
+}
+
+// FixesExtension kiểm tra cách sửa đuôi file fix có được bật
+func (c Config) FixesExtension(fix string) bool {
+	for _, f := range c.ExtensionFixes {
+		if f == fix {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadProfiles đọc danh sách profile từ file JSON dạng {"name": {"dir": "..."}}
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles map[string]Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %w", path, err)
+	}
+	for name, p := range profiles {
+		if p.Dir == "" {
+			return nil, fmt.Errorf("profile %q has no dir", name)
+		}
+		if !domain.ValidLayout(p.Layout) {
+			return nil, fmt.Errorf("profile %q has invalid layout %q", name, p.Layout)
+		}
+	}
+	return profiles, nil
+}
+
+// LoadWebhooks đọc danh sách webhook từ file JSON dạng [{"name": "...", "url": "..."}]
+func LoadWebhooks(path string) ([]Webhook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var webhooks []Webhook
+	if err := json.Unmarshal(data, &webhooks); err != nil {
+		return nil, fmt.Errorf("invalid webhooks file %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for _, w := range webhooks {
+		if w.Name == "" {
+			return nil, fmt.Errorf("webhook with url %q has no name", w.URL)
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("duplicate webhook name %q", w.Name)
+		}
+		seen[w.Name] = true
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q: url must be an absolute http(s) URL", w.Name)
+		}
+		for _, e := range w.Events {
+			if !domain.ValidWebhookEvent(e) {
+				return nil, fmt.Errorf("webhook %q: unknown event %q", w.Name, e)
+			}
+		}
+		if w.MaxAttempts < 0 {
+			return nil, fmt.Errorf("webhook %q: max_attempts must not be negative", w.Name)
+		}
+	}
+	return webhooks, nil
+}
+
+// LoadHooks đọc file JSON dạng {"pre_rename": [{"command": "...", "timeout": "30s"}], ...}
+func LoadHooks(path string) (Hooks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Hooks{}, err
+	}
+	var hooks Hooks
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return Hooks{}, fmt.Errorf("invalid hooks file %s: %w", path, err)
+	}
+	for stage, list := range map[string][]HookCommand{
+		"pre_rename": hooks.PreRename, "post_rename": hooks.PostRename,
+		"run_start": hooks.RunStart, "run_end": hooks.RunEnd,
+	} {
+		for i := range list {
+			h := &list[i]
+			if strings.TrimSpace(h.Command) == "" {
+				return Hooks{}, fmt.Errorf("%s hook %d has no command", stage, i+1)
+			}
+			if h.Name == "" {
+				h.Name = fmt.Sprintf("%s#%d", stage, i+1)
+			}
+			h.Timeout = DefaultHookTimeout
+			if h.TimeoutText != "" {
+				d, err := time.ParseDuration(h.TimeoutText)
+				if err != nil || d <= 0 {
+					return Hooks{}, fmt.Errorf("hook %q: invalid timeout %q", h.Name, h.TimeoutText)
+				}
+				h.Timeout = d
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// ParseExtensionFixes đọc danh sách cách sửa đuôi file phân tách bằng dấu phẩy
+func ParseExtensionFixes(value string) ([]string, error) {
+	var fixes []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !domain.ValidExtensionFix(item) {
+			return nil, fmt.Errorf("unknown fix %q, expected missing, case or mismatch", item)
+		}
+		fixes = append(fixes, item)
+	}
+	return fixes, nil
+}
+
+// ParseCompoundExtensions đọc danh sách đuôi ghép phân tách bằng dấu phẩy, vd
+// ".tar.gz,.min.js". Kết quả là chữ thường, đuôi dài đứng trước để khớp trước.
+func ParseCompoundExtensions(value string) ([]string, error) {
+	var exts []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" || seen[item] {
+			continue
+		}
+		if !strings.HasPrefix(item, ".") || strings.Count(item, ".") < 2 || strings.Contains(item, "..") ||
+			strings.HasSuffix(item, ".") || strings.ContainsAny(item, `/\ `) {
+			return nil, fmt.Errorf("%q is not a multi-part extension like .tar.gz", item)
+		}
+		seen[item] = true
+		exts = append(exts, item)
+	}
+	sort.SliceStable(exts, func(i, j int) bool { return len(exts[i]) > len(exts[j]) })
+	return exts, nil
+}
+
+// ParseSidecarExtensions đọc danh sách đuôi file đi kèm phân tách bằng dấu phẩy,
+// vd ".xmp,.srt". Kết quả là chữ thường.
+func ParseSidecarExtensions(value string) ([]string, error) {
+	var exts []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" || seen[item] {
+			continue
+		}
+		if len(item) < 2 || !strings.HasPrefix(item, ".") || strings.Count(item, ".") != 1 || strings.ContainsAny(item, `/\ `) {
+			return nil, fmt.Errorf("%q is not an extension like .xmp", item)
+		}
+		seen[item] = true
+		exts = append(exts, item)
+	}
+	return exts, nil
+}
+
+// ParseAuthTokens đọc danh sách "token:role" phân tách bằng dấu phẩy
+func ParseAuthTokens(value string) (map[string]string, error) {
+	tokens := map[string]string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("token entry must be token:role")
+		}
+		token, role := item[:i], item[i+1:]
+		if !domain.ValidRole(role) {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+		tokens[token] = role
+	}
+	return tokens, nil
+}
+
+// LoadUsers đọc file tài khoản, mỗi dòng dạng name:bcrypt-hash:role, bỏ qua dòng trống và #
+func LoadUsers(path string) ([]domain.User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var users []domain.User
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%s:%d: expected name:bcrypt-hash:role", path, n+1)
+		}
+		if !domain.ValidRole(parts[2]) {
+			return nil, fmt.Errorf("%s:%d: unknown role %q", path, n+1, parts[2])
+		}
+		users = append(users, domain.User{Name: parts[0], PasswordHash: parts[1], Role: parts[2]})
+	}
+	return users, nil
+}
+
+// AuthEnabled kiểm tra có cấu hình token hoặc tài khoản nào không
+func (c Config) AuthEnabled() bool {
+	return len(c.AuthTokens) > 0 || len(c.AuthUsers) > 0
+}
+
+// maskSecret ẩn giá trị bí mật khi log cấu hình
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "***"
+}
+
+// WithProfile trả về bản sao config đã áp dụng profile
+func (c Config) WithProfile(name string) (Config, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return c, fmt.Errorf("unknown profile %q", name)
+	}
+	c.Dir = p.Dir
+	if p.DryRun != nil {
+		c.DryRun = *p.DryRun
+	}
+	if p.RenameSubfolder != nil {
+		c.RenameSubfolder = *p.RenameSubfolder
+	}
+	if p.Review != nil {
+		c.ReviewMode = *p.Review
+	}
+	if p.Layout != "" {
+		c.Layout, c.LayoutDir = p.Layout, p.LayoutDir
+	}
+	return c, nil
 }
 
 // getEnv lấy biến môi trường hoặc trả về giá trị mặc định
@@ -78,11 +600,50 @@ func getBoolEnv(key string, defaultValue bool) bool {
 	return boolValue
 }
 
+// getIntEnv lấy biến môi trường kiểu int hoặc trả về giá trị mặc định
+func getIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return intValue
+}
+
+// getDurationEnv lấy biến môi trường kiểu duration (vd: 24h, 30m) hoặc trả về giá trị mặc định
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue
+	}
+	return d
+}
+
 // validateConfig kiểm tra tính hợp lệ của config
 func ValidateConfig(config Config) error {
+	// Review worker, retry worker và /healthz chạy cả ở chế độ chỉ web
+	if config.ReviewExpiry <= 0 {
+		return fmt.Errorf("review-expiry must be positive, got %s", config.ReviewExpiry)
+	}
+	if config.RetryBackoff <= 0 {
+		return fmt.Errorf("retry-backoff must be positive, got %s", config.RetryBackoff)
+	}
+	if config.LivenessIntervals < 1 {
+		return fmt.Errorf("liveness-intervals must be at least 1")
+	}
 	if config.WebOnly {
 		return nil
 	}
+	if config.Workers < 1 {
+		return fmt.Errorf("workers must be at least 1")
+	}
 	if config.Dir == "" {
 		return fmt.Errorf("directory path is required. Use -dir flag")
 	}
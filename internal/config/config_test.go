@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	valid := Config{
+		Dir:               t.TempDir(),
+		Workers:           4,
+		ReviewExpiry:      7 * 24 * time.Hour,
+		RetryBackoff:      time.Minute,
+		LivenessIntervals: 3,
+	}
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"zero review expiry", func(c *Config) { c.ReviewExpiry = 0 }, "review-expiry"},
+		{"negative review expiry", func(c *Config) { c.ReviewExpiry = -time.Hour }, "review-expiry"},
+		{"zero retry backoff", func(c *Config) { c.RetryBackoff = 0 }, "retry-backoff"},
+		{"negative retry backoff", func(c *Config) { c.RetryBackoff = -time.Second }, "retry-backoff"},
+		{"zero liveness intervals", func(c *Config) { c.LivenessIntervals = 0 }, "liveness-intervals"},
+		{"negative liveness intervals", func(c *Config) { c.LivenessIntervals = -1 }, "liveness-intervals"},
+		{"web only checks durations", func(c *Config) { c.WebOnly, c.Dir, c.ReviewExpiry = true, "", 0 }, "review-expiry"},
+		{"web only needs no directory", func(c *Config) { c.WebOnly, c.Dir = true, "" }, ""},
+		{"no workers", func(c *Config) { c.Workers = 0 }, "workers"},
+		{"no directory", func(c *Config) { c.Dir = "" }, "directory path is required"},
+		{"missing directory", func(c *Config) { c.Dir += "/missing" }, "does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.change(&c)
+			err := ValidateConfig(c)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("ValidateConfig = %v, want nil", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateConfig = %v, want error about %s", err, tt.want)
+			}
+		})
+	}
+}
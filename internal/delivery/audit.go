@@ -0,0 +1,175 @@
+// Audit trail of user actions in the web server
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+const (
+	// maxAuditParams giới hạn số byte body được lưu làm tham số
+	maxAuditParams = 4096
+	// maxAuditResult giới hạn số byte phản hồi được lưu làm kết quả
+	maxAuditResult = 512
+)
+
+// auditWriter ghi lại status code và phần đầu của phản hồi để lưu vào audit log
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (a *auditWriter) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *auditWriter) Write(p []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	if room := maxAuditResult - a.body.Len(); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		a.body.Write(p[:room])
+	}
+	return a.ResponseWriter.Write(p)
+}
+
+// Flush cho stream (SSE) đi qua writer audit
+func (a *auditWriter) Flush() {
+	if f, ok := a.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// beginAudit đọc tham số của request rồi trả về writer và hàm ghi audit khi request xong
+func (ws *WebServer) beginAudit(w http.ResponseWriter, r *http.Request, principal Principal) (*auditWriter, func()) {
+	params := auditParams(r)
+	aw := &auditWriter{ResponseWriter: w}
+	return aw, func() {
+		status := aw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ws.audit(r, principal, params, status, strings.TrimSpace(aw.body.String()))
+	}
+}
+
+// audit ghi một dòng audit; lỗi ghi chỉ được log để không chặn request
+func (ws *WebServer) audit(r *http.Request, principal Principal, params string, status int, result string) {
+	_, err := ws.db.AppendAuditEntry(domain.AuditEntry{
+		Timestamp:  time.Now().UTC().Format(time.RFC3339Nano),
+		Actor:      principal.Name,
+		Role:       principal.Role,
+		AuthMethod: principal.Method,
+		SourceIP:   clientIP(r),
+		Method:     r.Method,
+		Endpoint:   r.URL.Path,
+		Params:     params,
+		Status:     status,
+		Result:     result,
+	})
+	if err != nil {
+		slog.Error("audit: failed to record entry", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+}
+
+// auditParams gom query string và body (JSON hoặc form) của request; body được trả lại cho handler
+func auditParams(r *http.Request) string {
+	params := map[string]interface{}{}
+	if q := r.URL.RawQuery; q != "" {
+		params["query"] = q
+	}
+	if r.Body != nil && r.ContentLength != 0 {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxAuditParams+1))
+		if err == nil {
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+			if len(data) > maxAuditParams {
+				data = data[:maxAuditParams]
+				params["truncated"] = true
+			}
+			var body interface{}
+			if json.Unmarshal(data, &body) == nil {
+				params["body"] = body
+			} else {
+				params["body"] = string(data)
+			}
+		}
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	out, _ := json.Marshal(params)
+	return string(out)
+}
+
+// clientIP lấy IP nguồn của kết nối (không tin header X-Forwarded-For)
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (ws *WebServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("template/audit.html")
+	if err != nil {
+		http.Error(w, "Template audit error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, nil)
+}
+
+func (ws *WebServer) handleAPIAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	page := 1
+	pageSize := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && v > 0 {
+		page = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("pageSize")); err == nil && v > 0 {
+		pageSize = v
+	}
+	entries, err := ws.db.GetAuditEntriesPage(page, pageSize)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	total, err := ws.db.CountAuditEntries()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":  entries,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+func (ws *WebServer) handleAPIAuditVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	result, err := ws.db.VerifyAuditLog()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,59 @@
+package delivery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auto-rename/internal/domain"
+)
+
+func TestProtectAudit(t *testing.T) {
+	ws := newTestServer(t, true)
+	tests := []struct {
+		method    string
+		path      string
+		token     string
+		wantAudit bool
+		wantActor string
+	}{
+		{http.MethodGet, "/api/records", testViewerToken, true, "token:" + tokenID(testViewerToken)},
+		{http.MethodGet, "/api/scan/preview?dir=/data", testAdminToken, true, "token:" + tokenID(testAdminToken)},
+		{http.MethodGet, "/api/config", "wrong", true, "unauthenticated"},
+		{http.MethodPost, "/api/scan", testAdminToken, true, "token:" + tokenID(testAdminToken)},
+		// Trang HTML chỉ đọc không phải lệnh gọi API
+		{http.MethodGet, "/records", testViewerToken, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			before, err := ws.db.CountAuditEntries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := ws.protect(domain.RoleViewer, domain.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			})
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			h(httptest.NewRecorder(), r)
+
+			entries, err := ws.db.GetAuditEntriesPage(1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, _ := ws.db.CountAuditEntries()
+			if audited := after > before; audited != tt.wantAudit {
+				t.Fatalf("audited = %v, want %v", audited, tt.wantAudit)
+			}
+			if !tt.wantAudit {
+				return
+			}
+			if e := entries[0]; e.Actor != tt.wantActor || e.Method != tt.method || e.Endpoint != r.URL.Path {
+				t.Errorf("audit entry = %s %s by %s, want %s %s by %s", e.Method, e.Endpoint, e.Actor, tt.method, r.URL.Path, tt.wantActor)
+			}
+		})
+	}
+	if result, err := ws.db.VerifyAuditLog(); err != nil || !result.Valid {
+		t.Errorf("VerifyAuditLog = %+v, %v, want a valid chain", result, err)
+	}
+}
@@ -0,0 +1,372 @@
+// Authentication, role checks and CSRF protection for the web server
+package delivery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookieName = "auto_rename_session"
+	csrfCookieName    = "auto_rename_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+	csrfFormField     = "csrf_token"
+)
+
+// Cách người dùng được xác thực
+const (
+	authMethodNone    = "none"
+	authMethodBearer  = "bearer"
+	authMethodBasic   = "basic"
+	authMethodSession = "session"
+)
+
+// Principal là người dùng đã xác thực của một request
+type Principal struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Method string `json:"method"`
+}
+
+type principalKey struct{}
+
+// principalFrom lấy Principal đã gắn vào request bởi middleware
+func principalFrom(r *http.Request) Principal {
+	if p, ok := r.Context().Value(principalKey{}).(Principal); ok {
+		return p
+	}
+	return Principal{Name: "anonymous", Method: authMethodNone}
+}
+
+// authenticator kiểm tra bearer token, HTTP basic và session cookie
+type authenticator struct {
+	enabled bool
+	tokens  map[string]string
+	users   map[string]domain.User
+	secret  []byte
+	ttl     time.Duration
+}
+
+func newAuthenticator(cfg config.Config) *authenticator {
+	a := &authenticator{
+		enabled: cfg.AuthEnabled(),
+		tokens:  cfg.AuthTokens,
+		users:   make(map[string]domain.User),
+		ttl:     cfg.SessionTTL,
+	}
+	for _, u := range cfg.AuthUsers {
+		a.users[u.Name] = u
+	}
+	if cfg.SessionSecret != "" {
+		a.secret = []byte(cfg.SessionSecret)
+	} else {
+		// Không có secret cố định: session mất hiệu lực khi khởi động lại
+		a.secret = make([]byte, 32)
+		if _, err := rand.Read(a.secret); err != nil {
+			panic("failed to generate session secret: " + err.Error())
+		}
+	}
+	if a.ttl <= 0 {
+		a.ttl = 12 * time.Hour
+	}
+	return a
+}
+
+// authenticate xác định Principal của request; ok=false khi thiếu hoặc sai thông tin đăng nhập
+func (a *authenticator) authenticate(r *http.Request) (Principal, bool) {
+	if !a.enabled {
+		return Principal{Name: "anonymous", Role: domain.RoleAdmin, Method: authMethodNone}, true
+	}
+	if h := r.Header.Get("Authorization"); h != "" {
+		if token, found := strings.CutPrefix(h, "Bearer "); found {
+			return a.checkToken(strings.TrimSpace(token))
+		}
+		if name, password, found := r.BasicAuth(); found {
+			user, ok := a.checkPassword(name, password)
+			if !ok {
+				return Principal{}, false
+			}
+			return Principal{Name: user.Name, Role: user.Role, Method: authMethodBasic}, true
+		}
+		return Principal{}, false
+	}
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		return a.checkSession(c.Value)
+	}
+	return Principal{}, false
+}
+
+func (a *authenticator) checkToken(token string) (Principal, bool) {
+	for t, role := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return Principal{Name: "token:" + tokenID(t), Role: role, Method: authMethodBearer}, true
+		}
+	}
+	return Principal{}, false
+}
+
+// tokenID là định danh ngắn của token để ghi log mà không lộ token
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:4])
+}
+
+func (a *authenticator) checkPassword(name, password string) (domain.User, bool) {
+	user, ok := a.users[name]
+	if !ok {
+		return domain.User{}, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return domain.User{}, false
+	}
+	return user, true
+}
+
+// newSession tạo giá trị cookie session đã ký: base64(name|expiry).hmac
+func (a *authenticator) newSession(name string) (string, time.Time) {
+	expires := time.Now().Add(a.ttl)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(name + "|" + strconv.FormatInt(expires.Unix(), 10)))
+	return payload + "." + a.sign(payload), expires
+}
+
+func (a *authenticator) checkSession(value string) (Principal, bool) {
+	payload, sig, found := strings.Cut(value, ".")
+	if !found || !hmac.Equal([]byte(sig), []byte(a.sign(payload))) {
+		return Principal{}, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Principal{}, false
+	}
+	name, exp, found := strings.Cut(string(raw), "|")
+	if !found {
+		return Principal{}, false
+	}
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expUnix {
+		return Principal{}, false
+	}
+	// Vai trò lấy từ cấu hình hiện tại để thu hồi/đổi quyền có hiệu lực ngay
+	user, ok := a.users[name]
+	if !ok {
+		return Principal{}, false
+	}
+	return Principal{Name: user.Name, Role: user.Role, Method: authMethodSession}, true
+}
+
+func (a *authenticator) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// protect bọc handler với yêu cầu vai trò: readRole cho GET/HEAD, writeRole cho method khác.
+// Request thay đổi dữ liệu phải qua kiểm tra CSRF.
+func (ws *WebServer) protect(readRole, writeRole string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ensureCSRFCookie(w, r)
+		principal, ok := ws.auth.authenticate(r)
+		// Mọi lệnh gọi API và mọi request thay đổi dữ liệu đều được ghi audit, kể cả khi bị từ chối
+		if isAPIRequest(r) || !isSafeMethod(r.Method) {
+			actor := principal
+			if !ok {
+				actor = Principal{Name: "unauthenticated", Method: authMethodNone}
+			}
+			aw, finish := ws.beginAudit(w, r, actor)
+			defer finish()
+			w = aw
+		}
+		if !ok {
+			if isAPIRequest(r) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			} else {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			}
+			return
+		}
+		need := readRole
+		if !isSafeMethod(r.Method) {
+			need = writeRole
+			if err := checkCSRF(r, principal); err != nil {
+				http.Error(w, "CSRF check failed: "+err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		if !domain.RoleAllows(principal.Role, need) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// checkCSRF chặn request khác nguồn dựa trên Sec-Fetch-Site/Origin (trình duyệt có thể
+// không gửi hai header này), rồi bắt mọi request không dùng bearer token gửi kèm
+// token CSRF trùng với cookie (double submit). Trình duyệt tự gửi cookie session và
+// thông tin basic auth, còn bearer token thì không nên chỉ bearer được miễn.
+func checkCSRF(r *http.Request, principal Principal) error {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return fmt.Errorf("cross-site request")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return fmt.Errorf("origin %s does not match host", origin)
+		}
+	}
+	if principal.Method == authMethodBearer {
+		return nil
+	}
+	return checkCSRFToken(r)
+}
+
+// checkCSRFToken so token trong header hoặc form với cookie CSRF
+func checkCSRFToken(r *http.Request) error {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || c.Value == "" {
+		return fmt.Errorf("missing CSRF cookie")
+	}
+	token := r.Header.Get(csrfHeaderName)
+	if token == "" {
+		token = r.PostFormValue(csrfFormField)
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Value)) != 1 {
+		return fmt.Errorf("invalid CSRF token")
+	}
+	return nil
+}
+
+// ensureCSRFCookie đặt cookie CSRF ngẫu nhiên nếu chưa có; JS đọc cookie này để gửi header
+func ensureCSRFCookie(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	token := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+	})
+	// Gắn vào request để handler hiện tại (trang login) dùng ngay được
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// safeRedirect chỉ cho phép chuyển hướng tới đường dẫn nội bộ
+func safeRedirect(next string) string {
+	if next == "" || !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (ws *WebServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	csrfToken := ensureCSRFCookie(w, r)
+	data := map[string]interface{}{
+		"Next":      safeRedirect(r.URL.Query().Get("next")),
+		"CSRFToken": csrfToken,
+		"Error":     "",
+		"Enabled":   ws.auth.enabled,
+	}
+	if r.Method == http.MethodPost {
+		if err := checkCSRF(r, Principal{Method: authMethodSession}); err != nil {
+			http.Error(w, "CSRF check failed: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		data["Next"] = safeRedirect(r.PostFormValue("next"))
+		username := r.PostFormValue("username")
+		user, ok := ws.auth.checkPassword(username, r.PostFormValue("password"))
+		// Không lưu mật khẩu vào audit log
+		params, _ := json.Marshal(map[string]string{"username": username})
+		if ok {
+			ws.audit(r, Principal{Name: user.Name, Role: user.Role, Method: authMethodSession}, string(params), http.StatusSeeOther, "login succeeded")
+			value, expires := ws.auth.newSession(user.Name)
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookieName,
+				Value:    value,
+				Path:     "/",
+				Expires:  expires,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+				Secure:   r.TLS != nil,
+			})
+			slog.Info("login", "user", user.Name, "role", user.Role, "ip", clientIP(r))
+			http.Redirect(w, r, data["Next"].(string), http.StatusSeeOther)
+			return
+		}
+		slog.Warn("login failed", "user", username, "ip", clientIP(r))
+		ws.audit(r, Principal{Name: username, Method: authMethodNone}, string(params), http.StatusUnauthorized, "invalid username or password")
+		data["Error"] = "Invalid username or password"
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	tmpl, err := template.ParseFiles("template/login.html")
+	if err != nil {
+		http.Error(w, "Template login error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, data)
+}
+
+func (ws *WebServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := checkCSRF(r, Principal{Method: authMethodSession}); err != nil {
+		http.Error(w, "CSRF check failed: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		if principal, ok := ws.auth.checkSession(c.Value); ok {
+			ws.audit(r, principal, "", http.StatusSeeOther, "logout")
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// handleAPIMe trả về người dùng hiện tại để UI ẩn/hiện chức năng theo vai trò
+func (ws *WebServer) handleAPIMe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	p := principalFrom(r)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":         p.Name,
+		"role":         p.Role,
+		"method":       p.Method,
+		"auth_enabled": ws.auth.enabled,
+	})
+}
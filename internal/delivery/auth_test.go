@@ -0,0 +1,199 @@
+package delivery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testAdminToken  = "admin-token"
+	testViewerToken = "viewer-token"
+	testPassword    = "s3cret"
+	testCSRFToken   = "csrf-value"
+)
+
+// newTestServer tạo WebServer với DB tạm; enabled bật xác thực bằng token và user alice/bob
+func newTestServer(t *testing.T, enabled bool) *WebServer {
+	t.Helper()
+	db, err := infrastructure.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	cfg := config.Config{SessionSecret: "session-secret"}
+	if enabled {
+		hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.AuthTokens = map[string]string{testAdminToken: domain.RoleAdmin, testViewerToken: domain.RoleViewer}
+		cfg.AuthUsers = []domain.User{
+			{Name: "alice", PasswordHash: string(hash), Role: domain.RoleOperator},
+			{Name: "bob", PasswordHash: string(hash), Role: domain.RoleViewer},
+		}
+	}
+	return &WebServer{db: db, config: cfg, auth: newAuthenticator(cfg)}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ws := newTestServer(t, true)
+	session, _ := ws.auth.newSession("alice")
+	expired := newAuthenticator(config.Config{SessionSecret: "session-secret", AuthUsers: ws.config.AuthUsers})
+	expired.ttl = -time.Minute
+	expiredSession, _ := expired.newSession("alice")
+	other := newAuthenticator(config.Config{SessionSecret: "other-secret", AuthUsers: ws.config.AuthUsers})
+	foreignSession, _ := other.newSession("alice")
+	ghostSession, _ := ws.auth.newSession("carol")
+
+	tests := []struct {
+		name   string
+		setup  func(r *http.Request)
+		want   Principal
+		wantOK bool
+	}{
+		{"no credentials", func(r *http.Request) {}, Principal{}, false},
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+testAdminToken) },
+			Principal{Name: "token:" + tokenID(testAdminToken), Role: domain.RoleAdmin, Method: authMethodBearer}, true},
+		{"unknown bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, Principal{}, false},
+		{"basic auth", func(r *http.Request) { r.SetBasicAuth("alice", testPassword) },
+			Principal{Name: "alice", Role: domain.RoleOperator, Method: authMethodBasic}, true},
+		{"basic auth wrong password", func(r *http.Request) { r.SetBasicAuth("alice", "wrong") }, Principal{}, false},
+		{"basic auth unknown user", func(r *http.Request) { r.SetBasicAuth("carol", testPassword) }, Principal{}, false},
+		{"other authorization scheme", func(r *http.Request) { r.Header.Set("Authorization", "Digest x") }, Principal{}, false},
+		{"session", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session}) },
+			Principal{Name: "alice", Role: domain.RoleOperator, Method: authMethodSession}, true},
+		{"tampered session", func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: strings.Replace(session, ".", "x.", 1)})
+		}, Principal{}, false},
+		{"expired session", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: expiredSession}) }, Principal{}, false},
+		{"session signed with another secret", func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: foreignSession})
+		}, Principal{}, false},
+		{"session of removed user", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: ghostSession}) }, Principal{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/records", nil)
+			tt.setup(r)
+			got, ok := ws.auth.authenticate(r)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("authenticate() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// Tắt xác thực thì mọi request là admin ẩn danh
+	open := newTestServer(t, false)
+	got, ok := open.auth.authenticate(httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ok || got.Role != domain.RoleAdmin || got.Method != authMethodNone {
+		t.Errorf("authenticate() without auth = %+v, %v, want anonymous admin", got, ok)
+	}
+}
+
+// withCSRF gửi token CSRF trùng với cookie như trang web
+func withCSRF(r *http.Request) {
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: testCSRFToken})
+	r.Header.Set(csrfHeaderName, testCSRFToken)
+}
+
+func TestProtect(t *testing.T) {
+	ws := newTestServer(t, true)
+	open := newTestServer(t, false)
+	session, _ := ws.auth.newSession("alice")
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(r *http.Request) { r.SetBasicAuth("alice", testPassword) }
+	withSession := func(r *http.Request) { r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session}) }
+	and := func(fns ...func(r *http.Request)) func(r *http.Request) {
+		return func(r *http.Request) {
+			for _, fn := range fns {
+				fn(r)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		server *WebServer
+		method string
+		setup  func(r *http.Request)
+		want   int
+	}{
+		{"unauthenticated", ws, http.MethodGet, func(r *http.Request) {}, http.StatusUnauthorized},
+		{"viewer reads", ws, http.MethodGet, bearer(testViewerToken), http.StatusOK},
+		{"viewer cannot write", ws, http.MethodPost, bearer(testViewerToken), http.StatusForbidden},
+		{"bearer needs no CSRF token", ws, http.MethodPost, bearer(testAdminToken), http.StatusOK},
+		{"bearer cross-site", ws, http.MethodPost, and(bearer(testAdminToken), func(r *http.Request) { r.Header.Set("Sec-Fetch-Site", "cross-site") }), http.StatusForbidden},
+		{"bearer foreign origin", ws, http.MethodPost, and(bearer(testAdminToken), func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") }), http.StatusForbidden},
+		{"same origin", ws, http.MethodPost, and(bearer(testAdminToken), func(r *http.Request) { r.Header.Set("Origin", "http://"+r.Host) }), http.StatusOK},
+		{"basic auth without CSRF token", ws, http.MethodPost, basic, http.StatusForbidden},
+		{"basic auth with CSRF token", ws, http.MethodPost, and(basic, withCSRF), http.StatusOK},
+		{"session without CSRF token", ws, http.MethodPost, withSession, http.StatusForbidden},
+		{"session with CSRF token", ws, http.MethodPost, and(withSession, withCSRF), http.StatusOK},
+		{"session with wrong CSRF token", ws, http.MethodPost, and(withSession, withCSRF, func(r *http.Request) { r.Header.Set(csrfHeaderName, "other") }), http.StatusForbidden},
+		{"session with CSRF header but no cookie", ws, http.MethodPost, and(withSession, func(r *http.Request) { r.Header.Set(csrfHeaderName, testCSRFToken) }), http.StatusForbidden},
+		{"session reads without CSRF token", ws, http.MethodGet, withSession, http.StatusOK},
+		{"auth disabled without CSRF token", open, http.MethodPost, func(r *http.Request) {}, http.StatusForbidden},
+		{"auth disabled with CSRF token", open, http.MethodPost, withCSRF, http.StatusOK},
+		{"auth disabled reads", open, http.MethodGet, func(r *http.Request) {}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := tt.server.protect(domain.RoleViewer, domain.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+			r := httptest.NewRequest(tt.method, "/api/scan", nil)
+			tt.setup(r)
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, strings.TrimSpace(w.Body.String()))
+			}
+			if called != (tt.want == http.StatusOK) {
+				t.Errorf("handler called = %v with status %d", called, w.Code)
+			}
+		})
+	}
+}
+
+func TestLoginCSRF(t *testing.T) {
+	ws := newTestServer(t, true)
+	post := func(csrf bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=alice&password="+testPassword))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if csrf {
+			withCSRF(r)
+		}
+		w := httptest.NewRecorder()
+		ws.handleLogin(w, r)
+		return w
+	}
+	if w := post(false); w.Code != http.StatusForbidden {
+		t.Errorf("login without CSRF token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w := post(true)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("login: status %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	var session string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			session = c.Value
+		}
+	}
+	if p, ok := ws.auth.checkSession(session); !ok || p.Name != "alice" {
+		t.Errorf("login session = %+v, %v, want alice", p, ok)
+	}
+}
@@ -0,0 +1,29 @@
+// Health and readiness probes
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"auto-rename/internal/usecase"
+)
+
+// handleHealthz báo tiến trình còn sống (và cron scanner còn tick nếu bật)
+func (ws *WebServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, usecase.Liveness(ws.config))
+}
+
+// handleReadyz báo sẵn sàng nhận request: DB, migration và thư mục theo dõi
+func (ws *WebServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, usecase.Readiness(ws.config, ws.db))
+}
+
+// writeHealthReport trả 200 khi mọi kiểm tra đạt, ngược lại 503
+func writeHealthReport(w http.ResponseWriter, report usecase.HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.OK() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
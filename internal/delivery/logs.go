@@ -0,0 +1,99 @@
+// Recent application logs for the web UI
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auto-rename/internal/infrastructure"
+)
+
+// parseLogFilter đọc ?level=warn&q=text&after=seq cho /api/logs và /api/logs/stream
+func parseLogFilter(r *http.Request) (infrastructure.LogFilter, error) {
+	params := r.URL.Query()
+	filter := infrastructure.LogFilter{MinLevel: slog.LevelDebug, Contains: params.Get("q")}
+	if v := params.Get("level"); v != "" {
+		if err := filter.MinLevel.UnmarshalText([]byte(v)); err != nil {
+			return filter, fmt.Errorf("invalid level %q", v)
+		}
+	}
+	if v := params.Get("after"); v != "" {
+		after, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid after %q", v)
+		}
+		filter.After = after
+	}
+	return filter, nil
+}
+
+// handleAPILogs trả về các dòng log gần nhất trong bộ đệm, cũ nhất trước
+func (ws *WebServer) handleAPILogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 200
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":  infrastructure.Logs.Entries(filter, limit),
+		"capacity": infrastructure.Logs.Capacity(),
+	})
+}
+
+// handleAPILogsStream stream dòng log mới thỏa bộ lọc qua Server-Sent Events
+func (ws *WebServer) handleAPILogsStream(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	lines, unsubscribe := infrastructure.Logs.Subscribe(256)
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case e, ok := <-lines:
+			if !ok {
+				return
+			}
+			if !filter.Match(e) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", e.Seq, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Prometheus /metrics endpoint and HTTP request metrics
+package delivery
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+	"auto-rename/internal/usecase"
+)
+
+var (
+	httpRequests = infrastructure.Metrics.NewCounterVec(
+		"auto_rename_http_requests_total",
+		"HTTP requests served, by handler, method and status code.",
+		"handler", "method", "code")
+	httpDuration = infrastructure.Metrics.NewHistogramVec(
+		"auto_rename_http_request_duration_seconds",
+		"Time spent serving HTTP requests, by handler.",
+		infrastructure.DefaultBuckets,
+		"handler")
+)
+
+// registerGaugesOnce đảm bảo gauge đọc từ DB chỉ đăng ký một lần
+var registerGaugesOnce sync.Once
+
+// registerGauges đăng ký các gauge được tính lúc scrape
+func (ws *WebServer) registerGauges() {
+	registerGaugesOnce.Do(func() {
+		infrastructure.Metrics.NewGaugeFunc(
+			"auto_rename_pending_renames",
+			"Planned renames waiting for review.",
+			func() (float64, bool) {
+				n, err := ws.db.CountPendingRenames(domain.PendingStatusPending)
+				if err != nil {
+					slog.Error("metrics: failed to count pending renames", "error", err)
+					return 0, false
+				}
+				return float64(n), true
+			})
+		infrastructure.Metrics.NewGaugeFunc(
+			"auto_rename_scans_running",
+			"Scans currently in progress.",
+			func() (float64, bool) {
+				return float64(len(usecase.ActiveRuns())), true
+			})
+		infrastructure.Metrics.NewGaugeFunc(
+			"auto_rename_database_size_bytes",
+			"Size of the SQLite database including its write-ahead log.",
+			func() (float64, bool) {
+				info, err := os.Stat(ws.config.DbPath)
+				if err != nil {
+					return 0, false
+				}
+				size := info.Size()
+				if wal, err := os.Stat(ws.config.DbPath + "-wal"); err == nil {
+					size += wal.Size()
+				}
+				return float64(size), true
+			})
+	})
+}
+
+// handleMetrics xuất metric theo định dạng text của Prometheus
+func (ws *WebServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := infrastructure.Metrics.WriteText(w); err != nil {
+		slog.Warn("metrics: write failed", "error", err)
+	}
+}
+
+// statusRecorder ghi lại status code; giữ Flush để SSE vẫn hoạt động
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// quietPaths là các route bị gọi định kỳ (probe, scrape); access log của chúng
+// chỉ ghi ở mức debug khi thành công
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true, "/favicon.ico": true}
+
+// instrument đo số request và thời gian xử lý theo route (pattern) để nhãn ít
+// giá trị, đồng thời ghi access log cho mỗi request
+func instrument(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		elapsed := time.Since(start)
+		httpRequests.Inc(pattern, r.Method, strconv.Itoa(status))
+		httpDuration.Observe(elapsed.Seconds(), pattern)
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case quietPaths[pattern]:
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", pattern,
+			"status", status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(elapsed.Microseconds())/1000,
+			"ip", clientIP(r),
+			"user_agent", r.UserAgent(),
+		)
+	}
+}
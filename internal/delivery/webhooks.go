@@ -0,0 +1,104 @@
+// Webhook configuration and delivery log API
+package delivery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"auto-rename/internal/domain"
+	"auto-rename/internal/usecase"
+)
+
+// webhookView là cấu hình webhook trả về API, không kèm secret
+type webhookView struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Batch       bool     `json:"batch"`
+	MaxAttempts int      `json:"max_attempts,omitempty"`
+	Signed      bool     `json:"signed"`
+}
+
+// handleAPIWebhooks liệt kê các webhook đã cấu hình
+func (ws *WebServer) handleAPIWebhooks(w http.ResponseWriter, r *http.Request) {
+	views := []webhookView{}
+	for _, h := range ws.config.Webhooks {
+		events := h.Events
+		if len(events) == 0 {
+			events = domain.WebhookEvents
+		}
+		// Ẩn mật khẩu nếu URL có user:password
+		target := h.URL
+		if u, err := url.Parse(h.URL); err == nil {
+			target = u.Redacted()
+		}
+		views = append(views, webhookView{Name: h.Name, URL: target, Events: events, Batch: h.Batch, MaxAttempts: h.MaxAttempts, Signed: h.Secret != ""})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"webhooks": views})
+}
+
+// handleAPIWebhookDeliveries trả về delivery log, mới nhất trước
+func (ws *WebServer) handleAPIWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", domain.WebhookStatusPending, domain.WebhookStatusDelivered, domain.WebhookStatusFailed:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+	deliveries, err := ws.db.GetWebhookDeliveries(q.Get("webhook"), status, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"deliveries": deliveries})
+}
+
+// handleAPIWebhookTest gửi event ping tới webhook ?name=
+func (ws *WebServer) handleAPIWebhookTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	delivery, err := usecase.TestWebhook(r.URL.Query().Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// handleAPIWebhookRedeliver gửi lại payload của lần gửi ?id=
+func (ws *WebServer) handleAPIWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	delivery, err := usecase.RedeliverWebhook(ws.db, r.URL.Query().Get("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
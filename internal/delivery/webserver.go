@@ -2,22 +2,33 @@
 package delivery
 
 import (
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
 	"auto-rename/internal/infrastructure"
+	"auto-rename/internal/usecase"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type WebServer struct {
 	db      *infrastructure.Database
 	webPort string
+	config  config.Config
+	auth    *authenticator
 }
 
-func NewWebServer(db *infrastructure.Database, webPort string) *WebServer {
-	return &WebServer{db: db, webPort: webPort}
+func NewWebServer(db *infrastructure.Database, cfg config.Config) *WebServer {
+	ws := &WebServer{db: db, webPort: cfg.WebPort, config: cfg, auth: newAuthenticator(cfg)}
+	ws.registerGauges()
+	return ws
 }
 
 func (ws *WebServer) Start() error {
@@ -25,12 +36,48 @@ func (ws *WebServer) Start() error {
 	// Serve static files from ./static directory
 	fileServer := http.FileServer(http.Dir("static"))
 	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
-	mux.HandleFunc("/favicon.ico", ws.handleFavicon)
-	mux.HandleFunc("/logs", ws.handleLogs)
-	mux.HandleFunc("/records", ws.handleRecord)
-	mux.HandleFunc("/api/records", ws.handleAPIRecords)
-	mux.HandleFunc("/api/stats", ws.handleAPIStats)
-	mux.HandleFunc("/", ws.handleIndex)
+	// handle đăng ký route kèm đo metric theo pattern
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, instrument(pattern, h))
+	}
+	handle("/favicon.ico", ws.handleFavicon)
+	handle("/login", ws.handleLogin)
+	handle("/logout", ws.handleLogout)
+	// Probe của Kubernetes/docker-compose không đăng nhập
+	handle("/healthz", ws.handleHealthz)
+	handle("/readyz", ws.handleReadyz)
+	// viewer: xem dữ liệu; operator: quét, duyệt; admin: cấu hình, bảo trì
+	handle("/logs", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleLogs))
+	handle("/records", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleRecord))
+	handle("/review", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleReview))
+	handle("/api/me", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIMe))
+	handle("/api/records", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIRecords))
+	handle("/api/records/search", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIRecordsSearch))
+	handle("/api/stats", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIStats))
+	handle("/api/progress", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIProgress))
+	handle("/api/events", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIEvents))
+	handle("/api/cron/logs", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPICronLogs))
+	handle("/api/cron/status", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPICronStatus))
+	handle("/api/profiles", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIProfiles))
+	handle("/api/review", ws.protect(domain.RoleViewer, domain.RoleOperator, ws.handleAPIReview))
+	handle("/api/logs", ws.protect(domain.RoleOperator, domain.RoleOperator, ws.handleAPILogs))
+	handle("/api/logs/stream", ws.protect(domain.RoleOperator, domain.RoleOperator, ws.handleAPILogsStream))
+	handle("/api/records/undo", ws.protect(domain.RoleOperator, domain.RoleOperator, ws.handleAPIRecordsUndo))
+	handle("/api/records/retry", ws.protect(domain.RoleOperator, domain.RoleOperator, ws.handleAPIRecordsRetry))
+	handle("/api/retries", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleAPIRetries))
+	handle("/api/scan", ws.protect(domain.RoleOperator, domain.RoleOperator, ws.handleAPIScan))
+	handle("/api/scan/preview", ws.protect(domain.RoleOperator, domain.RoleOperator, ws.handleAPIScanPreview))
+	handle("/api/backups", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIBackups))
+	handle("/api/config", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIConfig))
+	handle("/api/webhooks", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIWebhooks))
+	handle("/api/webhooks/deliveries", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIWebhookDeliveries))
+	handle("/api/webhooks/test", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIWebhookTest))
+	handle("/api/webhooks/redeliver", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIWebhookRedeliver))
+	handle("/audit", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAudit))
+	handle("/api/audit", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIAudit))
+	handle("/api/audit/verify", ws.protect(domain.RoleAdmin, domain.RoleAdmin, ws.handleAPIAuditVerify))
+	handle("/metrics", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleMetrics))
+	handle("/", ws.protect(domain.RoleViewer, domain.RoleViewer, ws.handleIndex))
 	server := &http.Server{
 		Addr:    ":" + ws.webPort,
 		Handler: mux,
@@ -55,7 +102,6 @@ func (ws *WebServer) handleFavicon(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
-	println("handleIndex:", r.URL.Path, "IP:", r.RemoteAddr, "Time:", time.Now().Format("2006-01-02 15:04:05"))
 	tmpl, err := template.ParseFiles("template/index.html")
 	if err != nil {
 		http.Error(w, "Template index error", http.StatusInternalServerError)
@@ -65,7 +111,6 @@ func (ws *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) handleLogs(w http.ResponseWriter, r *http.Request) {
-	println("handleLogs:", r.URL.Path, "IP:", r.RemoteAddr, "Time:", time.Now().Format("2006-01-02 15:04:05"))
 	tmpl, err := template.ParseFiles("template/logs.html")
 	if err != nil {
 		http.Error(w, "Template logs error", http.StatusInternalServerError)
@@ -75,7 +120,6 @@ func (ws *WebServer) handleLogs(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) handleRecord(w http.ResponseWriter, r *http.Request) {
-	println("handleRecord:", r.URL.Path, "IP:", r.RemoteAddr, "Time:", time.Now().Format("2006-01-02 15:04:05"))
 	tmpl, err := template.ParseFiles("template/records.html")
 	if err != nil {
 		http.Error(w, "Template records error", http.StatusInternalServerError)
@@ -84,6 +128,15 @@ func (ws *WebServer) handleRecord(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, nil)
 }
 
+func (ws *WebServer) handleReview(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("template/review.html")
+	if err != nil {
+		http.Error(w, "Template review error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, nil)
+}
+
 func (ws *WebServer) handleAPIRecords(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	page := 1
@@ -116,11 +169,517 @@ func (ws *WebServer) handleAPIRecords(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (ws *WebServer) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+// handleAPIRecordsSearch tìm bản ghi theo tên, loại file và metadata ảnh/video:
+// ?q=&camera=&taken_from=&taken_to=&min_width=&min_height=&min_duration=&max_duration=
+// &mime=&ext=&status=success|failed&mismatch=1&has_metadata=1&limit=&offset=
+func (ws *WebServer) handleAPIRecordsSearch(w http.ResponseWriter, r *http.Request) {
+	q, err := parseRecordQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	records, err := ws.db.SearchFileRecords(q)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	stats := map[string]interface{}{
-		"status":    "ok",
-		"timestamp": time.Now().Format(time.RFC3339),
+	json.NewEncoder(w).Encode(records)
+}
+
+// parseRecordQuery đọc bộ lọc của /api/records/search. Ngày chụp nhận RFC3339
+// hoặc YYYY-MM-DD theo giờ địa phương; taken_to dạng ngày tính cả ngày đó.
+func parseRecordQuery(r *http.Request) (domain.RecordQuery, error) {
+	params := r.URL.Query()
+	q := domain.RecordQuery{
+		Name:      strings.TrimSpace(params.Get("q")),
+		Camera:    strings.TrimSpace(params.Get("camera")),
+		MimeType:  params.Get("mime"),
+		Extension: params.Get("ext"),
+		Limit:     100,
+	}
+	if q.Extension != "" && !strings.HasPrefix(q.Extension, ".") {
+		q.Extension = "." + q.Extension
+	}
+	parseDate := func(name string, endOfDay bool) (time.Time, error) {
+		v := params.Get(name)
+		if v == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+			if endOfDay {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t, nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s %q: use RFC3339 or YYYY-MM-DD", name, v)
+		}
+		return t, nil
 	}
+	var err error
+	if q.TakenFrom, err = parseDate("taken_from", false); err != nil {
+		return q, err
+	}
+	if q.TakenTo, err = parseDate("taken_to", true); err != nil {
+		return q, err
+	}
+	for name, dst := range map[string]*int{"min_width": &q.MinWidth, "min_height": &q.MinHeight} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]*float64{"min_duration": &q.MinDuration, "max_duration": &q.MaxDuration} {
+		if v := params.Get(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				return q, fmt.Errorf("invalid %s %q: seconds", name, v)
+			}
+			*dst = f
+		}
+	}
+	switch status := params.Get("status"); status {
+	case "":
+	case "success", "failed":
+		success := status == "success"
+		q.Success = &success
+	default:
+		return q, fmt.Errorf("invalid status %q", status)
+	}
+	q.ExtMismatch = params.Get("mismatch") == "1" || params.Get("mismatch") == "true"
+	q.HasMetadata = params.Get("has_metadata") == "1" || params.Get("has_metadata") == "true"
+	if v, err := strconv.Atoi(params.Get("limit")); err == nil && v > 0 && v <= 1000 {
+		q.Limit = v
+	}
+	if v, err := strconv.Atoi(params.Get("offset")); err == nil && v > 0 {
+		q.Offset = v
+	}
+	return q, nil
+}
+
+// handleAPIRecordsUndo chuyển file của các bản ghi {"ids": [...]} về đường dẫn cũ.
+// Bản ghi không hoàn tác được có lỗi riêng trong "errors", theo id. Bản ghi
+// thuộc nhóm file đi kèm kéo theo cả nhóm, "undone" có mọi bản ghi của nhóm.
+func (ws *WebServer) handleAPIRecordsUndo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		http.Error(w, "Body must be {\"ids\": [...]}", http.StatusBadRequest)
+		return
+	}
+	undone := []domain.FileRecord{}
+	failed := map[string]string{}
+	done := map[int]bool{}
+	for _, id := range req.IDs {
+		// Đã được hoàn tác cùng nhóm file đi kèm của một id trước đó
+		if done[id] {
+			continue
+		}
+		records, err := usecase.UndoRename(ws.db, id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			failed[strconv.Itoa(id)] = "record not found"
+		case err != nil:
+			failed[strconv.Itoa(id)] = err.Error()
+		default:
+			for _, r := range records {
+				done[r.Id] = true
+			}
+			undone = append(undone, records...)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"undone": undone,
+		"errors": failed,
+	})
+}
+
+// handleAPIRecordsRetry đưa file của các bản ghi thất bại {"ids": [...]} vào
+// hàng đợi thử lại ngay. Bản ghi không thử lại được có lỗi riêng trong "errors", theo id.
+func (ws *WebServer) handleAPIRecordsRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		http.Error(w, "Body must be {\"ids\": [...]}", http.StatusBadRequest)
+		return
+	}
+	queued := []domain.RenameRetry{}
+	failed := map[string]string{}
+	for _, id := range req.IDs {
+		retry, err := usecase.RetryRecord(ws.config, ws.db, id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			failed[strconv.Itoa(id)] = "record not found"
+		case err != nil:
+			failed[strconv.Itoa(id)] = err.Error()
+		default:
+			queued = append(queued, retry)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queued": queued,
+		"errors": failed,
+	})
+}
+
+// handleAPIRetries trả về hàng đợi thử lại, mới cập nhật nhất trước: ?status=&limit=
+func (ws *WebServer) handleAPIRetries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", domain.RetryStatusPending, domain.RetryStatusDone, domain.RetryStatusFailed:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+	retries, err := ws.db.GetRenameRetries(status, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"retries": retries})
+}
+
+// handleAPIStats trả về thống kê trong khoảng thời gian:
+// ?range=24h|7d|30d|all hoặc ?from=&to= (RFC3339), &interval=hour|day, &limit=
+func (ws *WebServer) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	q, err := parseStatsQuery(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stats, err := ws.db.GetStats(q)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
+
+// parseStatsQuery đọc khoảng thời gian của /api/stats; mặc định là toàn bộ lịch sử
+func parseStatsQuery(r *http.Request, now time.Time) (domain.StatsQuery, error) {
+	params := r.URL.Query()
+	q := domain.StatsQuery{To: now, Limit: 20}
+	switch rng := params.Get("range"); {
+	case rng == "" || rng == "all":
+	case strings.HasSuffix(rng, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(rng, "d"))
+		if err != nil || days <= 0 {
+			return q, fmt.Errorf("invalid range %q", rng)
+		}
+		q.From = now.AddDate(0, 0, -days)
+	default:
+		d, err := time.ParseDuration(rng)
+		if err != nil || d <= 0 {
+			return q, fmt.Errorf("invalid range %q", rng)
+		}
+		q.From = now.Add(-d)
+	}
+	if v := params.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid from: %v", err)
+		}
+		q.From = t
+	}
+	if v := params.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid to: %v", err)
+		}
+		q.To = t
+	}
+	if !q.From.IsZero() && !q.From.Before(q.To) {
+		return q, errors.New("from must be before to")
+	}
+	switch q.Interval = params.Get("interval"); q.Interval {
+	case domain.StatsIntervalHour, domain.StatsIntervalDay:
+	case "":
+		// Khoảng ngắn gộp theo giờ, dài hơn 2 ngày (hoặc không giới hạn) gộp theo ngày
+		q.Interval = domain.StatsIntervalDay
+		if !q.From.IsZero() && q.To.Sub(q.From) <= 48*time.Hour {
+			q.Interval = domain.StatsIntervalHour
+		}
+	default:
+		return q, fmt.Errorf("invalid interval %q", q.Interval)
+	}
+	if v, err := strconv.Atoi(params.Get("limit")); err == nil && v > 0 && v <= 1000 {
+		q.Limit = v
+	}
+	return q, nil
+}
+
+func (ws *WebServer) handleAPIBackups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	backups, err := infrastructure.ListBackups(ws.config.BackupDir)
+	if err != nil {
+		http.Error(w, "Backup listing error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"directory": ws.config.BackupDir,
+		"backups":   backups,
+	})
+}
+
+func (ws *WebServer) handleAPIProgress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs": usecase.ActiveRuns(),
+	})
+}
+
+func (ws *WebServer) handleAPICronLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usecase.RecentRuns())
+}
+
+func (ws *WebServer) handleAPICronStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usecase.GetCronStatus())
+}
+
+// handleAPIEvents stream event của lượt quét qua Server-Sent Events
+func (ws *WebServer) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	events, unsubscribe := usecase.Events.Subscribe(256)
+	defer unsubscribe()
+
+	// Comment định kỳ giữ kết nối qua proxy
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleAPIScan bắt đầu một lượt quét nền: POST {"dir": "...", "profile": "...", "dry_run": true}
+func (ws *WebServer) handleAPIScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req usecase.ScanRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	cfg, err := usecase.ResolveScanConfig(ws.config, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	runID, err := usecase.StartScan(cfg, ws.db)
+	if errors.Is(err, usecase.ErrScanInProgress) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to start scan", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"run_id":  runID,
+		"root":    cfg.Dir,
+		"dry_run": cfg.DryRun,
+	})
+}
+
+// handleAPIScanPreview trả về các thay đổi tên dự kiến mà không động tới file
+func (ws *WebServer) handleAPIScanPreview(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cfg, err := usecase.ResolveScanConfig(ws.config, usecase.ScanRequest{Dir: q.Get("dir"), Profile: q.Get("profile")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 500
+	if l := q.Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	results, truncated, err := usecase.PreviewRenames(cfg, ws.db, limit)
+	if err != nil {
+		http.Error(w, "Preview failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"root":      cfg.Dir,
+		"results":   results,
+		"truncated": truncated,
+	})
+}
+
+func (ws *WebServer) handleAPIProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	profiles := ws.config.Profiles
+	if profiles == nil {
+		profiles = map[string]config.Profile{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"default_dir": ws.config.Dir,
+		"profiles":    profiles,
+	})
+}
+
+// handleAPIReview liệt kê (GET) hoặc duyệt/từ chối hàng loạt (POST {"ids": [...], "action": "approve"}) đề xuất đổi tên
+func (ws *WebServer) handleAPIReview(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		status := q.Get("status")
+		if status == "all" {
+			status = ""
+		} else if status == "" {
+			status = domain.PendingStatusPending
+		}
+		page := 1
+		pageSize := 50
+		if v, err := strconv.Atoi(q.Get("page")); err == nil && v > 0 {
+			page = v
+		}
+		if v, err := strconv.Atoi(q.Get("pageSize")); err == nil && v > 0 {
+			pageSize = v
+		}
+		items, err := ws.db.GetPendingRenamesPage(status, page, pageSize)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		total, err := ws.db.CountPendingRenames(status)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items":    items,
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
+		})
+	case http.MethodPost:
+		var req struct {
+			IDs    []int  `json:"ids"`
+			Action string `json:"action"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.Action != "approve" && req.Action != "reject" {
+			http.Error(w, "action must be approve or reject", http.StatusBadRequest)
+			return
+		}
+		updated, err := usecase.DecideRenames(ws.db, req.IDs, req.Action == "approve")
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"action":  req.Action,
+			"updated": updated,
+		})
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAPIConfig trả về cấu hình đang chạy, không kèm bí mật
+func (ws *WebServer) handleAPIConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	cfg := ws.config
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dir":                 cfg.Dir,
+		"dry_run":             cfg.DryRun,
+		"web_port":            cfg.WebPort,
+		"web_only":            cfg.WebOnly,
+		"db_path":             cfg.DbPath,
+		"cron":                cfg.Cron,
+		"rename_subfolder":    cfg.RenameSubfolder,
+		"backup_dir":          cfg.BackupDir,
+		"backup_interval":     cfg.BackupInterval.String(),
+		"backup_keep":         cfg.BackupKeep,
+		"workers":             cfg.Workers,
+		"db_batch_size":       cfg.DBBatchSize,
+		"profiles":            cfg.Profiles,
+		"review_mode":         cfg.ReviewMode,
+		"review_expiry":       cfg.ReviewExpiry.String(),
+		"layout":              cfg.Layout,
+		"layout_dir":          cfg.LayoutDir,
+		"collision_policy":    cfg.CollisionPolicy,
+		"retry_max_attempts":  cfg.RetryMaxAttempts,
+		"retry_backoff":       cfg.RetryBackoff.String(),
+		"fix_extensions":      cfg.ExtensionFixes,
+		"compound_extensions": cfg.CompoundExtensions,
+		"sidecar_extensions":  cfg.SidecarExtensions,
+		"confirm_renamed":     cfg.ConfirmRenamed,
+		"auth_enabled":        cfg.AuthEnabled(),
+		"auth_users":          cfg.AuthUsers,
+		"auth_tokens":         len(cfg.AuthTokens),
+		"session_ttl":         cfg.SessionTTL.String(),
+	})
+}
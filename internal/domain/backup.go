@@ -0,0 +1,10 @@
+// Domain entities for database backups
+package domain
+
+// BackupInfo mô tả một file backup database
+type BackupInfo struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"created_at"`
+}
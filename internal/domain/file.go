@@ -1,16 +1,167 @@
 // Domain entities for auto-rename
 package domain
 
+import "time"
+
 // FileRecord định nghĩa thông tin file đã được xử lý
 type FileRecord struct {
 	Id           int    `json:"id"`
 	OriginalName string `json:"original_name"`
 	NewName      string `json:"new_name"`
-	FilePath     string `json:"file_path"`
+	// FilePath là thư mục chứa file sau khi đổi tên; bản ghi tạo trước khi có
+	// worker pool lưu thư mục quét, kể cả với file ở thư mục con
+	FilePath string `json:"file_path"`
+	FileSize int64  `json:"file_size"`
+	FileMode string `json:"file_mode"`
+	ModTime  string `json:"mod_time"`
+	Success  bool   `json:"success"`
+	ErrorMsg string `json:"error_msg"`
+	// RenamedAt là thời điểm xử lý theo RFC3339 UTC
+	RenamedAt string `json:"renamed_at"`
+	Extension string `json:"extension"`
+	ErrorType string `json:"error_type,omitempty"`
+	// OldPath và NewPath là đường dẫn đầy đủ trước và sau khi đổi tên, dùng để hoàn tác
+	OldPath  string `json:"old_path,omitempty"`
+	NewPath  string `json:"new_path,omitempty"`
+	UndoneAt string `json:"undone_at,omitempty"`
+	// MoveStrategy là cách file được chuyển: rename, hoặc copy khi khác file system
+	MoveStrategy string `json:"move_strategy,omitempty"`
+	// MimeType là loại file nhận ra từ nội dung; ExtMismatch cho biết đuôi gốc không khớp nội dung
+	MimeType    string `json:"mime_type,omitempty"`
+	ExtMismatch bool   `json:"ext_mismatch,omitempty"`
+	// Metadata là metadata ảnh/video lưu trong bảng file_metadata, nil khi không có
+	Metadata *FileMetadata `json:"metadata,omitempty"`
+	// GroupID là chung cho file chính và các file đi kèm được đổi tên cùng nhau
+	GroupID string `json:"group_id,omitempty"`
+}
+
+// FileMetadata là metadata ảnh/video đọc từ EXIF hoặc header HEIC, MP4/MOV
+type FileMetadata struct {
+	// TakenAt là thời điểm chụp hoặc quay (RFC3339), rỗng khi không có
+	TakenAt     string `json:"taken_at,omitempty"`
+	CameraMake  string `json:"camera_make,omitempty"`
+	CameraModel string `json:"camera_model,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	// Duration là thời lượng video/âm thanh tính bằng giây
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// RecordQuery là bộ lọc tìm bản ghi; trường rỗng hoặc 0 là không lọc
+type RecordQuery struct {
+	// Name là chuỗi con của tên gốc hoặc tên mới
+	Name string
+	// Camera là chuỗi con của hãng hoặc model máy ảnh
+	Camera string
+	// TakenFrom và TakenTo giới hạn thời điểm chụp trong [TakenFrom, TakenTo)
+	TakenFrom time.Time
+	TakenTo   time.Time
+	MinWidth  int
+	MinHeight int
+	// MinDuration và MaxDuration tính bằng giây
+	MinDuration float64
+	MaxDuration float64
+	// MimeType khớp loại đầy đủ (image/jpeg) hoặc tiền tố kết thúc bằng / (video/)
+	MimeType string
+	// Extension là đuôi file, vd .jpg
+	Extension string
+	// Success lọc theo kết quả đổi tên: nil là mọi bản ghi
+	Success     *bool
+	ExtMismatch bool
+	HasMetadata bool
+	Limit       int
+	Offset      int
+}
+
+// Loại lỗi lưu cùng bản ghi thất bại, dùng để thống kê
+const (
+	ErrorTypeFileInfo  = "file_info"
+	ErrorTypeRename    = "rename"
+	ErrorTypeRule      = "rule"
+	ErrorTypeLayout    = "layout"
+	ErrorTypeCollision = "collision"
+)
+
+// Cách xử lý khi đích đổi tên đã có file; file có sẵn không bao giờ bị ghi đè
+const (
+	// CollisionRegenerate tạo tên mới (UUID mới, hoặc chạy lại luật đặt tên)
+	CollisionRegenerate = "regenerate"
+	// CollisionSuffix thêm hậu tố vào tên: name-1.ext, name-2.ext...
+	CollisionSuffix = "suffix"
+	// CollisionSkip bỏ qua file
+	CollisionSkip = "skip"
+	// CollisionFail ghi nhận file đổi tên thất bại
+	CollisionFail = "fail"
+)
+
+// ValidCollisionPolicy kiểm tra tên chính sách xử lý trùng tên
+func ValidCollisionPolicy(policy string) bool {
+	switch policy {
+	case CollisionRegenerate, CollisionSuffix, CollisionSkip, CollisionFail:
+		return true
+	}
+	return false
+}
+
+// Cách sửa đuôi file theo loại file nhận ra từ nội dung
+const (
+	// ExtFixMissing thêm đuôi chuẩn cho file không có đuôi
+	ExtFixMissing = "missing"
+	// ExtFixCase đổi đuôi sang chữ thường: .JPG thành .jpg
+	ExtFixCase = "case"
+	// ExtFixMismatch thay đuôi không khớp nội dung bằng đuôi chuẩn
+	ExtFixMismatch = "mismatch"
+)
+
+// ValidExtensionFix kiểm tra tên cách sửa đuôi file
+func ValidExtensionFix(fix string) bool {
+	switch fix {
+	case ExtFixMissing, ExtFixCase, ExtFixMismatch:
+		return true
+	}
+	return false
+}
+
+// Cách sắp xếp file đã đổi tên vào cây thư mục đích; rỗng là đổi tên tại chỗ
+const (
+	// LayoutUUID chia thư mục theo 4 ký tự hex đầu của tên mới: ab/cd/<uuid>.ext
+	LayoutUUID = "uuid"
+	// LayoutHash chia thư mục theo SHA-256 nội dung file: ab/cd/<uuid>.ext
+	LayoutHash = "hash"
+	// LayoutDate chia thư mục theo ngày chụp EXIF hoặc ngày sửa: 2026/10/16/<uuid>.ext
+	LayoutDate = "date"
+)
+
+// ValidLayout kiểm tra tên layout; chuỗi rỗng là hợp lệ
+func ValidLayout(layout string) bool {
+	switch layout {
+	case "", LayoutUUID, LayoutHash, LayoutDate:
+		return true
+	}
+	return false
+}
+
+// Trạng thái của một đề xuất đổi tên trong hàng chờ duyệt
+const (
+	PendingStatusPending  = "pending"
+	PendingStatusApproved = "approved"
+	PendingStatusRejected = "rejected"
+	PendingStatusDone     = "done"
+	PendingStatusFailed   = "failed"
+	PendingStatusExpired  = "expired"
+)
+
+// PendingRename là một đề xuất đổi tên đang chờ người duyệt
+type PendingRename struct {
+	Id           int    `json:"id"`
+	Path         string `json:"path"`
+	OriginalName string `json:"original_name"`
+	NewName      string `json:"new_name"`
 	FileSize     int64  `json:"file_size"`
-	FileMode     string `json:"file_mode"`
 	ModTime      string `json:"mod_time"`
-	Success      bool   `json:"success"`
+	Status       string `json:"status"`
 	ErrorMsg     string `json:"error_msg"`
-	RenamedAt    string `json:"renamed_at"`
+	CreatedAt    string `json:"created_at"`
+	ExpiresAt    string `json:"expires_at"`
+	DecidedAt    string `json:"decided_at"`
 }
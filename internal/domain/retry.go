@@ -0,0 +1,24 @@
+// Domain entities for the rename retry queue
+package domain
+
+// Trạng thái của một file trong hàng đợi thử lại
+const (
+	RetryStatusPending = "pending"
+	RetryStatusDone    = "done"
+	RetryStatusFailed  = "failed"
+)
+
+// RenameRetry là một file đổi tên thất bại được thử lại sau, kèm kết quả lần thử gần nhất.
+// Attempts là số lần đã thử lại, không tính lần đổi tên đầu tiên trong lượt quét.
+type RenameRetry struct {
+	ID            int    `json:"id"`
+	Path          string `json:"path"`
+	Root          string `json:"root"`
+	OriginalName  string `json:"original_name"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	NextAttemptAt string `json:"next_attempt_at"`
+}
@@ -0,0 +1,50 @@
+// Statistics over processed files
+package domain
+
+import "time"
+
+// Khoảng gộp của chuỗi thời gian thống kê
+const (
+	StatsIntervalHour = "hour"
+	StatsIntervalDay  = "day"
+)
+
+// StatsQuery giới hạn thống kê trong [From, To); From rỗng nghĩa là từ đầu
+type StatsQuery struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	// Limit là số nhóm tối đa cho thống kê theo đuôi file và thư mục
+	Limit int
+}
+
+// StatCount là số file (và tổng dung lượng) của một nhóm
+type StatCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// StatsPoint là một điểm của chuỗi thời gian, Time là đầu khoảng (UTC)
+type StatsPoint struct {
+	Time    string `json:"time"`
+	Renamed int    `json:"renamed"`
+	Failed  int    `json:"failed"`
+}
+
+// Stats tổng hợp các bản ghi trong khoảng thời gian được hỏi
+type Stats struct {
+	From              string       `json:"from,omitempty"`
+	To                string       `json:"to"`
+	Interval          string       `json:"interval"`
+	TotalRecords      int          `json:"total_records"`
+	SuccessfulRenames int          `json:"successful_renames"`
+	FailedRenames     int          `json:"failed_renames"`
+	SuccessRate       float64      `json:"success_rate"`
+	RecentActivity    int          `json:"recent_activity"`
+	BytesProcessed    int64        `json:"bytes_processed"`
+	FailuresByType    []StatCount  `json:"failures_by_type"`
+	ByExtension       []StatCount  `json:"by_extension"`
+	ByDirectory       []StatCount  `json:"by_directory"`
+	Series            []StatsPoint `json:"series"`
+}
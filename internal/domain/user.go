@@ -0,0 +1,46 @@
+// Domain entities for web authentication
+package domain
+
+// Các vai trò truy cập web UI, quyền tăng dần
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleLevels = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// ValidRole kiểm tra tên vai trò hợp lệ
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// RoleAllows kiểm tra vai trò have có đủ quyền của vai trò need
+func RoleAllows(have, need string) bool {
+	return roleLevels[have] >= roleLevels[need] && roleLevels[need] > 0
+}
+
+// User là tài khoản đăng nhập web UI, mật khẩu lưu dạng bcrypt
+type User struct {
+	Name         string `json:"name"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+}
+
+// AuditEntry là một dòng nhật ký thao tác, nối chuỗi bằng hash với dòng trước
+type AuditEntry struct {
+	Id         int    `json:"id"`
+	Timestamp  string `json:"timestamp"`
+	Actor      string `json:"actor"`
+	Role       string `json:"role"`
+	AuthMethod string `json:"auth_method"`
+	SourceIP   string `json:"source_ip"`
+	Method     string `json:"method"`
+	Endpoint   string `json:"endpoint"`
+	Params     string `json:"params"`
+	Status     int    `json:"status"`
+	Result     string `json:"result"`
+	PrevHash   string `json:"prev_hash"`
+	Hash       string `json:"hash"`
+}
@@ -0,0 +1,48 @@
+// Domain entities for outbound webhooks
+package domain
+
+// Các loại event gửi qua webhook
+const (
+	WebhookEventFileRenamed  = "file-renamed"
+	WebhookEventFileFailed   = "file-failed"
+	WebhookEventRunFinished  = "run-finished"
+	WebhookEventRunFailed    = "run-failed"
+	WebhookEventFilesRenamed = "files-renamed" // file-renamed gom theo lượt quét khi webhook bật batch
+	WebhookEventPing         = "ping"          // gửi thử từ API, luôn được gửi
+)
+
+// WebhookEvents là các event có thể đăng ký trong cấu hình webhook
+var WebhookEvents = []string{WebhookEventFileRenamed, WebhookEventFileFailed, WebhookEventRunFinished, WebhookEventRunFailed}
+
+// ValidWebhookEvent kiểm tra tên event có thể đăng ký
+func ValidWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Trạng thái của một lần gửi webhook
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusFailed    = "failed"
+)
+
+// WebhookDelivery là một payload gửi tới một webhook, kèm kết quả lần thử gần nhất
+type WebhookDelivery struct {
+	ID            string `json:"id"`
+	Webhook       string `json:"webhook"`
+	Event         string `json:"event"`
+	RunID         string `json:"run_id"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	ResponseCode  int    `json:"response_code"`
+	LastError     string `json:"last_error"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	NextAttemptAt string `json:"next_attempt_at"`
+}
@@ -0,0 +1,139 @@
+// Tamper-evident audit log storage for auto-rename
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"auto-rename/internal/domain"
+)
+
+// auditGenesisHash là prev_hash của dòng đầu tiên trong chuỗi
+const auditGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+const auditColumns = "id, ts, COALESCE(actor, ''), COALESCE(role, ''), COALESCE(auth_method, ''), COALESCE(source_ip, ''), COALESCE(method, ''), COALESCE(endpoint, ''), COALESCE(params, ''), COALESCE(status, 0), COALESCE(result, ''), prev_hash, hash"
+
+// auditHash tính hash của một dòng từ hash dòng trước và toàn bộ nội dung dòng
+func auditHash(e domain.AuditEntry) string {
+	payload, _ := json.Marshal([]interface{}{
+		e.Id, e.Timestamp, e.Actor, e.Role, e.AuthMethod, e.SourceIP, e.Method, e.Endpoint, e.Params, e.Status, e.Result,
+	})
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), payload...))
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendAuditEntry ghi thêm một dòng audit, nối hash với dòng cuối cùng
+func (d *Database) AppendAuditEntry(e domain.AuditEntry) (domain.AuditEntry, error) {
+	d.auditMu.Lock()
+	defer d.auditMu.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return e, err
+	}
+	defer tx.Rollback()
+
+	var lastID int
+	var lastHash string
+	err = tx.QueryRow("SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&lastID, &lastHash)
+	if err == sql.ErrNoRows {
+		lastHash = auditGenesisHash
+	} else if err != nil {
+		return e, err
+	}
+	// id được gán tường minh để nằm trong nội dung được hash
+	e.Id = lastID + 1
+	e.PrevHash = lastHash
+	e.Hash = auditHash(e)
+	if _, err := tx.Exec(
+		`INSERT INTO audit_log (id, ts, actor, role, auth_method, source_ip, method, endpoint, params, status, result, prev_hash, hash)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Id, e.Timestamp, e.Actor, e.Role, e.AuthMethod, e.SourceIP, e.Method, e.Endpoint, e.Params, e.Status, e.Result, e.PrevHash, e.Hash,
+	); err != nil {
+		return e, err
+	}
+	return e, tx.Commit()
+}
+
+// GetAuditEntriesPage lấy các dòng audit, mới nhất trước
+func (d *Database) GetAuditEntriesPage(page, pageSize int) ([]domain.AuditEntry, error) {
+	offset := (page - 1) * pageSize
+	rows, err := d.db.Query("SELECT "+auditColumns+" FROM audit_log ORDER BY id DESC LIMIT ? OFFSET ?", pageSize, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []domain.AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// CountAuditEntries đếm số dòng audit
+func (d *Database) CountAuditEntries() (int, error) {
+	var count int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM audit_log").Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// AuditVerification là kết quả kiểm tra chuỗi hash của audit_log
+type AuditVerification struct {
+	Entries  int    `json:"entries"`
+	Valid    bool   `json:"valid"`
+	BrokenAt int    `json:"broken_at,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+	LastHash string `json:"last_hash"`
+}
+
+// VerifyAuditLog tính lại hash của từng dòng theo thứ tự và kiểm tra liên kết với dòng trước
+func (d *Database) VerifyAuditLog() (AuditVerification, error) {
+	result := AuditVerification{Valid: true, LastHash: auditGenesisHash}
+	rows, err := d.db.Query("SELECT " + auditColumns + " FROM audit_log ORDER BY id")
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	expectedID := 1
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return result, err
+		}
+		result.Entries++
+		if !result.Valid {
+			continue
+		}
+		switch {
+		case e.Id != expectedID:
+			result.Problem = fmt.Sprintf("expected entry %d, found %d (entries missing)", expectedID, e.Id)
+		case e.PrevHash != result.LastHash:
+			result.Problem = "prev_hash does not match the previous entry"
+		case auditHash(e) != e.Hash:
+			result.Problem = "entry content does not match its hash"
+		}
+		if result.Problem != "" {
+			result.Valid = false
+			result.BrokenAt = e.Id
+			continue
+		}
+		result.LastHash = e.Hash
+		expectedID++
+	}
+	return result, rows.Err()
+}
+
+func scanAuditEntry(rows *sql.Rows) (domain.AuditEntry, error) {
+	var e domain.AuditEntry
+	err := rows.Scan(&e.Id, &e.Timestamp, &e.Actor, &e.Role, &e.AuthMethod, &e.SourceIP, &e.Method, &e.Endpoint, &e.Params, &e.Status, &e.Result, &e.PrevHash, &e.Hash)
+	return e, err
+}
@@ -0,0 +1,96 @@
+package infrastructure
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"auto-rename/internal/domain"
+)
+
+// newAuditDatabase tạo DB tạm có n dòng audit
+func newAuditDatabase(t *testing.T, n int) *Database {
+	t.Helper()
+	d, err := NewDatabase(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	for i := 1; i <= n; i++ {
+		_, err := d.AppendAuditEntry(domain.AuditEntry{
+			Timestamp: fmt.Sprintf("2026-01-01T00:00:0%dZ", i),
+			Actor:     "alice", Role: domain.RoleOperator, AuthMethod: "session", SourceIP: "127.0.0.1",
+			Method: "POST", Endpoint: "/api/scan", Params: `{"body":{"dry_run":true}}`, Status: 202, Result: "started",
+		})
+		if err != nil {
+			t.Fatalf("AppendAuditEntry: %v", err)
+		}
+	}
+	return d
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	d := newAuditDatabase(t, 3)
+	result, err := d.VerifyAuditLog()
+	if err != nil {
+		t.Fatalf("VerifyAuditLog: %v", err)
+	}
+	if !result.Valid || result.Entries != 3 {
+		t.Fatalf("VerifyAuditLog = %+v, want 3 valid entries", result)
+	}
+	entries, err := d.GetAuditEntriesPage(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mới nhất trước: mỗi dòng trỏ tới hash của dòng trước nó
+	if entries[0].Hash != result.LastHash || entries[0].PrevHash != entries[1].Hash || entries[2].PrevHash != auditGenesisHash {
+		t.Errorf("hash chain is not linked: %+v", entries)
+	}
+
+	// Trigger chặn sửa và xóa
+	if _, err := d.db.Exec("UPDATE audit_log SET actor = 'mallory' WHERE id = 2"); err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("UPDATE audit_log = %v, want append-only error", err)
+	}
+	if _, err := d.db.Exec("DELETE FROM audit_log WHERE id = 2"); err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("DELETE FROM audit_log = %v, want append-only error", err)
+	}
+}
+
+func TestVerifyAuditLogTampered(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  []string
+		problem string
+	}{
+		{"edited entry", []string{"DROP TRIGGER audit_log_no_update", "UPDATE audit_log SET actor = 'mallory' WHERE id = 2"}, "content does not match"},
+		{"forged hash", []string{"DROP TRIGGER audit_log_no_update", "UPDATE audit_log SET hash = 'forged' WHERE id = 2"}, "content does not match"},
+		{"relinked entry", []string{"DROP TRIGGER audit_log_no_update", "UPDATE audit_log SET prev_hash = 'other' WHERE id = 2"}, "prev_hash does not match"},
+		{"deleted entry", []string{"DROP TRIGGER audit_log_no_delete", "DELETE FROM audit_log WHERE id = 2"}, "entries missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newAuditDatabase(t, 3)
+			for _, stmt := range tt.tamper {
+				if _, err := d.db.Exec(stmt); err != nil {
+					t.Fatalf("%s: %v", stmt, err)
+				}
+			}
+			result, err := d.VerifyAuditLog()
+			if err != nil {
+				t.Fatalf("VerifyAuditLog: %v", err)
+			}
+			if result.Valid || !strings.Contains(result.Problem, tt.problem) {
+				t.Errorf("VerifyAuditLog = %+v, want invalid with %q", result, tt.problem)
+			}
+		})
+	}
+
+	// Dòng sau phần bị sửa vẫn được đếm
+	d := newAuditDatabase(t, 3)
+	d.db.Exec("DROP TRIGGER audit_log_no_update")
+	d.db.Exec("UPDATE audit_log SET result = 'changed' WHERE id = 2")
+	if result, _ := d.VerifyAuditLog(); result.BrokenAt != 2 || result.Entries != 3 {
+		t.Errorf("VerifyAuditLog = %+v, want broken at 2 of 3 entries", result)
+	}
+}
@@ -0,0 +1,223 @@
+// Database backup and restore helpers for auto-rename
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"auto-rename/internal/domain"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupPrefix và backupExt xác định tên file backup: file_renames-20060102-150405.db
+const (
+	backupPrefix = "file_renames-"
+	backupExt    = ".db"
+)
+
+// BackupFileName tạo tên file backup theo thời gian
+func BackupFileName(t time.Time) string {
+	return backupPrefix + t.Format("20060102-150405") + backupExt
+}
+
+// Backup sao lưu database đang chạy sang destPath bằng SQLite online backup API
+func (d *Database) Backup(destPath string) error {
+	tmpPath := destPath + ".tmp"
+	_ = os.Remove(tmpPath)
+
+	conn, err := d.db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		srcConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		raw, err := (&sqlite3.SQLiteDriver{}).Open(tmpPath)
+		if err != nil {
+			return err
+		}
+		destConn := raw.(*sqlite3.SQLiteConn)
+		defer destConn.Close()
+
+		backup, err := destConn.Backup("main", srcConn, "main")
+		if err != nil {
+			return err
+		}
+		if _, err := backup.Step(-1); err != nil {
+			backup.Finish()
+			return err
+		}
+		return backup.Finish()
+	})
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+// ListBackups liệt kê các file backup trong dir, mới nhất trước
+func ListBackups(dir string) ([]domain.BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []domain.BackupInfo{}, nil
+		}
+		return nil, err
+	}
+	backups := []domain.BackupInfo{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, domain.BackupInfo{
+			Name:      name,
+			Path:      filepath.Join(dir, name),
+			Size:      info.Size(),
+			CreatedAt: info.ModTime().Format(time.RFC3339),
+		})
+	}
+	// Tên file chứa timestamp nên sắp xếp theo tên là sắp xếp theo thời gian
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// RotateBackups chỉ giữ lại keep bản backup mới nhất
+func RotateBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[i].Name)
+	}
+	return removed, nil
+}
+
+// ValidateBackup kiểm tra file backup có schema version hợp lệ và không bị hỏng
+func ValidateBackup(backupPath string) (int, error) {
+	if _, err := os.Stat(backupPath); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+backupPath+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	version, err := schemaVersionOf(db)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read schema version: %w", err)
+	}
+	if version < 1 || version > SchemaVersion {
+		return version, fmt.Errorf("backup schema version %d is not supported (expected 1..%d)", version, SchemaVersion)
+	}
+	var check string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&check); err != nil {
+		return version, fmt.Errorf("integrity check failed: %w", err)
+	}
+	if check != "ok" {
+		return version, fmt.Errorf("integrity check failed: %s", check)
+	}
+	return version, nil
+}
+
+// RestoreBackup thay database tại dbPath bằng backupPath sau khi kiểm tra schema.
+// Database hiện tại được giữ lại với hậu tố .pre-restore. Phải gọi khi DB chưa mở.
+func RestoreBackup(backupPath, dbPath string) (string, error) {
+	if _, err := ValidateBackup(backupPath); err != nil {
+		return "", err
+	}
+
+	tmpPath := dbPath + ".restore.tmp"
+	if err := copyFileSync(backupPath, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", err
+	}
+
+	previous := ""
+	if _, err := os.Stat(dbPath); err == nil {
+		// Ở chế độ WAL dữ liệu đã commit có thể còn trong -wal: ghi vào file chính
+		// trước. Không checkpoint được thì -wal vẫn được giữ cùng bản cũ bên dưới.
+		_ = checkpointDatabase(dbPath)
+		previous = dbPath + ".pre-restore-" + time.Now().Format("20060102-150405")
+		if err := os.Rename(dbPath, previous); err != nil {
+			_ = os.Remove(tmpPath)
+			return "", err
+		}
+	}
+	// File WAL/SHM cũ thuộc về database trước, không được áp vào bản restore;
+	// chúng đi cùng bản cũ để phần chưa checkpoint không bị mất
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + suffix); err != nil {
+			continue
+		}
+		if previous != "" {
+			if err := os.Rename(dbPath+suffix, previous+suffix); err == nil {
+				continue
+			}
+		}
+		_ = os.Remove(dbPath + suffix)
+	}
+
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return previous, err
+	}
+	return previous, nil
+}
+
+// checkpointDatabase ghi toàn bộ WAL vào file database và làm rỗng -wal
+func checkpointDatabase(dbPath string) error {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+// copyFileSync copy file và fsync trước khi đóng
+func copyFileSync(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := out.ReadFrom(in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,156 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+// recordNames đọc tên gốc của mọi bản ghi trong database tại path
+func recordNames(t *testing.T, path string) []string {
+	t.Helper()
+	d, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase(%s): %v", path, err)
+	}
+	defer d.Close()
+	records, err := d.GetAllFileRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range records {
+		names = append(names, r.OriginalName)
+	}
+	return names
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "file_renames.db")
+	backupPath := filepath.Join(dir, "backups", BackupFileName(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)))
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	if err := d.InsertFileRecords([]domain.FileRecord{{OriginalName: "before.txt", Success: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Backup(backupPath); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	// Ghi sau khi sao lưu, chưa checkpoint khỏi WAL
+	if err := d.InsertFileRecords([]domain.FileRecord{{OriginalName: "after.txt", Success: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backupPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary backup file left behind: %v", err)
+	}
+	version, err := ValidateBackup(backupPath)
+	if err != nil || version != SchemaVersion {
+		t.Fatalf("ValidateBackup = %d, %v, want %d", version, err, SchemaVersion)
+	}
+	d.Close()
+
+	previous, err := RestoreBackup(backupPath, dbPath)
+	if err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if !strings.HasPrefix(previous, dbPath+".pre-restore-") {
+		t.Errorf("previous database = %q, want %s.pre-restore-*", previous, dbPath)
+	}
+	if got := recordNames(t, dbPath); fmt.Sprint(got) != "[before.txt]" {
+		t.Errorf("restored records = %v, want [before.txt]", got)
+	}
+	// Bản cũ giữ cả phần còn trong WAL lúc restore
+	if got := recordNames(t, previous); len(got) != 2 {
+		t.Errorf("previous database records = %v, want before.txt and after.txt", got)
+	}
+	if _, err := os.Stat(dbPath + ".restore.tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary restore file left behind: %v", err)
+	}
+}
+
+func TestRestoreBackupRejectsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := filepath.Join(dir, "future.db")
+	db, err := sql.Open("sqlite3", future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	empty := filepath.Join(dir, "empty.db")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, backup := range []string{garbage, future, empty, filepath.Join(dir, "missing.db")} {
+		t.Run(filepath.Base(backup), func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "file_renames.db")
+			if err := os.WriteFile(dbPath, []byte("current"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := RestoreBackup(backup, dbPath); err == nil {
+				t.Fatal("RestoreBackup succeeded, want error")
+			}
+			// Database hiện tại không bị đụng tới
+			if data, _ := os.ReadFile(dbPath); string(data) != "current" {
+				t.Errorf("current database changed to %q", data)
+			}
+		})
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		name := BackupFileName(start.Add(time.Duration(i) * time.Hour))
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Không phải backup: không được liệt kê hay xóa
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := RotateBackups(dir, 2)
+	if err != nil {
+		t.Fatalf("RotateBackups: %v", err)
+	}
+	wantRemoved := []string{BackupFileName(start.Add(time.Hour)), BackupFileName(start)}
+	if fmt.Sprint(removed) != fmt.Sprint(wantRemoved) {
+		t.Errorf("removed = %v, want %v", removed, wantRemoved)
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Name != BackupFileName(start.Add(3*time.Hour)) {
+		t.Errorf("backups = %+v, want the 2 newest, newest first", backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("notes.txt: %v", err)
+	}
+	if backups, err := ListBackups(filepath.Join(dir, "missing")); err != nil || len(backups) != 0 {
+		t.Errorf("ListBackups of missing dir = %v, %v, want empty", backups, err)
+	}
+}
@@ -0,0 +1,54 @@
+// Running external hook commands
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxCommandOutput giới hạn số byte output của lệnh được giữ lại
+const maxCommandOutput = 4096
+
+// limitedBuffer chỉ giữ maxCommandOutput byte đầu, phần còn lại bị bỏ
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxCommandOutput - b.Len(); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		b.Buffer.Write(p[:room])
+	}
+	return len(p), nil
+}
+
+// RunShellCommand chạy command qua /bin/sh -c với biến môi trường bổ sung env
+// và stdin. Trả về stdout, stderr (đã cắt bớt) và lỗi nếu lệnh không chạy
+// được, hết thời gian hoặc thoát với mã khác 0.
+func RunShellCommand(ctx context.Context, command string, env []string, stdin []byte) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr limitedBuffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// Tiến trình con còn giữ pipe sau khi bị kill không được làm treo Wait
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = errors.New("timed out")
+	} else if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("exit status %d", exitErr.ExitCode())
+		}
+	}
+	return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), err
+}
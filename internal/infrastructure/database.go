@@ -2,7 +2,12 @@
 package infrastructure
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
 
 	"auto-rename/internal/domain"
 
@@ -11,16 +16,16 @@ import (
 
 type Database struct {
 	db *sql.DB
+	// auditMu tuần tự hóa việc ghi audit_log để chuỗi hash không bị rẽ nhánh
+	auditMu sync.Mutex
 }
 
-// NewDatabase khởi tạo kết nối database
-func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, err
-	}
-	// Auto-create table if not exists
-	createTableSQL := `
+// SchemaVersion là phiên bản schema hiện tại, lưu trong PRAGMA user_version
+const SchemaVersion = 13
+
+// migrations chứa các câu lệnh nâng cấp schema, phần tử thứ i nâng lên phiên bản i+1
+var migrations = []string{
+	`
     CREATE TABLE IF NOT EXISTS file_records (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
         original_name TEXT,
@@ -32,16 +37,257 @@ func NewDatabase(dbPath string) (*Database, error) {
         success BOOLEAN,
         error_msg TEXT,
         renamed_at TEXT
-    );`
-	if _, err := db.Exec(createTableSQL); err != nil {
+    );`,
+	`
+    CREATE TABLE IF NOT EXISTS pending_renames (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        path TEXT NOT NULL,
+        original_name TEXT,
+        new_name TEXT,
+        file_size INTEGER,
+        mod_time TEXT,
+        status TEXT NOT NULL DEFAULT 'pending',
+        error_msg TEXT,
+        created_at TEXT,
+        expires_at TEXT,
+        decided_at TEXT
+    );
+    CREATE INDEX IF NOT EXISTS idx_pending_renames_status ON pending_renames(status);
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_pending_renames_open_path ON pending_renames(path) WHERE status IN ('pending', 'approved');`,
+	`
+    CREATE TABLE IF NOT EXISTS audit_log (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        ts TEXT NOT NULL,
+        actor TEXT,
+        role TEXT,
+        auth_method TEXT,
+        source_ip TEXT,
+        method TEXT,
+        endpoint TEXT,
+        params TEXT,
+        status INTEGER,
+        result TEXT,
+        prev_hash TEXT NOT NULL,
+        hash TEXT NOT NULL
+    );
+    CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+    BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+    CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+    BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+	// Bản ghi cũ luôn có new_name = UUID (36 ký tự) + đuôi file gốc. renamed_at được
+	// chuẩn hóa về RFC3339 UTC để thống kê so sánh trực tiếp trên index
+	`
+    ALTER TABLE file_records ADD COLUMN extension TEXT NOT NULL DEFAULT '';
+    ALTER TABLE file_records ADD COLUMN error_type TEXT NOT NULL DEFAULT '';
+    UPDATE file_records SET extension = lower(substr(new_name, 37)) WHERE length(new_name) > 36;
+    UPDATE file_records SET error_type = CASE
+        WHEN error_msg LIKE 'Failed to get file info%' THEN 'file_info'
+        ELSE 'rename' END
+    WHERE NOT success;
+    UPDATE file_records SET renamed_at = strftime('%Y-%m-%dT%H:%M:%SZ', renamed_at)
+    WHERE strftime('%Y-%m-%dT%H:%M:%SZ', renamed_at) IS NOT NULL;
+    CREATE INDEX IF NOT EXISTS idx_file_records_renamed_at ON file_records(renamed_at);`,
+	`
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id TEXT PRIMARY KEY,
+        webhook TEXT NOT NULL,
+        event TEXT NOT NULL,
+        run_id TEXT NOT NULL DEFAULT '',
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        response_code INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT '',
+        created_at TEXT NOT NULL,
+        updated_at TEXT NOT NULL,
+        next_attempt_at TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries(status);
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries(created_at);`,
+	// Tên do luật đặt không có dạng UUID nên cần tra new_name để không đổi tên lại
+	`
+    CREATE TABLE IF NOT EXISTS rule_counters (
+        name TEXT PRIMARY KEY,
+        value INTEGER NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_file_records_new_name ON file_records(new_name);`,
+	// Bản ghi cũ không có đường dẫn: file_path của bản ghi tạo trước khi có worker
+	// pool là thư mục quét, không phải thư mục chứa file, nên không suy ra được
+	`
+    ALTER TABLE file_records ADD COLUMN old_path TEXT NOT NULL DEFAULT '';
+    ALTER TABLE file_records ADD COLUMN new_path TEXT NOT NULL DEFAULT '';
+    ALTER TABLE file_records ADD COLUMN undone_at TEXT NOT NULL DEFAULT '';`,
+	// Trước phiên bản 8 file chỉ được đổi tên bằng rename(2)
+	`
+    ALTER TABLE file_records ADD COLUMN move_strategy TEXT NOT NULL DEFAULT '';
+    UPDATE file_records SET move_strategy = 'rename' WHERE success;`,
+	`
+    CREATE TABLE IF NOT EXISTS rename_retries (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        path TEXT NOT NULL,
+        root TEXT NOT NULL,
+        original_name TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT '',
+        created_at TEXT NOT NULL,
+        updated_at TEXT NOT NULL,
+        next_attempt_at TEXT NOT NULL
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_rename_retries_open_path ON rename_retries(path) WHERE status = 'pending';
+    CREATE INDEX IF NOT EXISTS idx_rename_retries_status ON rename_retries(status, next_attempt_at);`,
+	// Bản ghi cũ không được nhận loại file từ nội dung
+	`
+    ALTER TABLE file_records ADD COLUMN mime_type TEXT NOT NULL DEFAULT '';
+    ALTER TABLE file_records ADD COLUMN ext_mismatch BOOLEAN NOT NULL DEFAULT 0;`,
+	// Metadata ảnh/video chỉ có với một phần bản ghi nên lưu ở bảng riêng
+	`
+    CREATE TABLE IF NOT EXISTS file_metadata (
+        record_id INTEGER PRIMARY KEY REFERENCES file_records(id),
+        taken_at TEXT NOT NULL DEFAULT '',
+        camera_make TEXT NOT NULL DEFAULT '',
+        camera_model TEXT NOT NULL DEFAULT '',
+        width INTEGER NOT NULL DEFAULT 0,
+        height INTEGER NOT NULL DEFAULT 0,
+        duration REAL NOT NULL DEFAULT 0
+    );
+    CREATE INDEX IF NOT EXISTS idx_file_metadata_taken_at ON file_metadata(taken_at);
+    CREATE INDEX IF NOT EXISTS idx_file_metadata_camera_model ON file_metadata(camera_model);`,
+	// Bản ghi cũ không thuộc nhóm file đi kèm nào
+	`
+    ALTER TABLE file_records ADD COLUMN group_id TEXT NOT NULL DEFAULT '';
+    CREATE INDEX IF NOT EXISTS idx_file_records_group_id ON file_records(group_id) WHERE group_id != '';`,
+	// Lượt quét ở chế độ duyệt tra đề xuất đã từ chối theo path
+	`
+    CREATE INDEX IF NOT EXISTS idx_pending_renames_path ON pending_renames(path, status);`,
+}
+
+// fileRecordColumns là danh sách cột đọc ra domain.FileRecord, theo thứ tự của
+// scanFileRecord; đọc từ fileRecordTables để có cả metadata
+const fileRecordColumns = "original_name, new_name, file_path, file_size, file_mode, mod_time, success, error_msg, renamed_at, extension, error_type, old_path, new_path, undone_at, move_strategy, mime_type, ext_mismatch, group_id, m.record_id, m.taken_at, m.camera_make, m.camera_model, m.width, m.height, m.duration, id"
+
+// fileRecordTables là file_records kèm metadata (nếu có) của từng bản ghi
+const fileRecordTables = "file_records LEFT JOIN file_metadata m ON m.record_id = file_records.id"
+
+// insertFileRecordSQL thêm một bản ghi vào file_records
+const insertFileRecordSQL = `INSERT INTO file_records (original_name, new_name, file_path, file_size, file_mode, mod_time, success, error_msg, renamed_at, extension, error_type, old_path, new_path, move_strategy, mime_type, ext_mismatch, group_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// insertFileMetadataSQL lưu metadata ảnh/video của một bản ghi
+const insertFileMetadataSQL = `INSERT INTO file_metadata (record_id, taken_at, camera_make, camera_model, width, height, duration)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+func fileRecordArgs(r domain.FileRecord) []interface{} {
+	return []interface{}{r.OriginalName, r.NewName, r.FilePath, r.FileSize, r.FileMode, r.ModTime, r.Success, r.ErrorMsg, r.RenamedAt, r.Extension, r.ErrorType, r.OldPath, r.NewPath, r.MoveStrategy, r.MimeType, r.ExtMismatch, r.GroupID}
+}
+
+// rowScanner là *sql.Row hoặc *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFileRecord(row rowScanner) (domain.FileRecord, error) {
+	var r domain.FileRecord
+	var metaID sql.NullInt64
+	var takenAt, cameraMake, cameraModel sql.NullString
+	var width, height sql.NullInt64
+	var duration sql.NullFloat64
+	err := row.Scan(&r.OriginalName, &r.NewName, &r.FilePath, &r.FileSize, &r.FileMode, &r.ModTime, &r.Success, &r.ErrorMsg, &r.RenamedAt, &r.Extension, &r.ErrorType, &r.OldPath, &r.NewPath, &r.UndoneAt, &r.MoveStrategy, &r.MimeType, &r.ExtMismatch, &r.GroupID,
+		&metaID, &takenAt, &cameraMake, &cameraModel, &width, &height, &duration, &r.Id)
+	if err == nil && metaID.Valid {
+		r.Metadata = &domain.FileMetadata{
+			TakenAt:     takenAt.String,
+			CameraMake:  cameraMake.String,
+			CameraModel: cameraModel.String,
+			Width:       int(width.Int64),
+			Height:      int(height.Int64),
+			Duration:    duration.Float64,
+		}
+	}
+	return r, err
+}
+
+// NewDatabase khởi tạo kết nối database
+func NewDatabase(dbPath string) (*Database, error) {
+	// WAL + busy_timeout để các worker đọc song song trong khi ghi theo lô
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
 		return nil, err
 	}
 	return &Database{db: db}, nil
 }
 
-// HasOriginalName kiểm tra file đã có trong DB chưa
+// migrate áp dụng các migration chưa chạy và cập nhật user_version
+func migrate(db *sql.DB) error {
+	version, err := schemaVersionOf(db)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, SchemaVersion)
+	}
+	for v := version; v < SchemaVersion; v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", v+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersionOf đọc PRAGMA user_version của database
+func schemaVersionOf(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// SchemaVersion trả về phiên bản schema đang áp dụng
+func (d *Database) SchemaVersion() (int, error) {
+	return schemaVersionOf(d.db)
+}
+
+// Ping kiểm tra kết nối DB bằng một truy vấn thật
+func (d *Database) Ping(ctx context.Context) error {
+	var one int
+	return d.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// HasOriginalName kiểm tra file tên name đã được đổi tên thành công và chưa hoàn
+// tác; bản ghi lỗi không chặn lần đổi tên sau
 func (d *Database) HasOriginalName(name string) (bool, error) {
-	row := d.db.QueryRow("SELECT COUNT(*) FROM file_records WHERE original_name = ?", name)
+	row := d.db.QueryRow("SELECT COUNT(*) FROM file_records WHERE original_name = ? AND success AND undone_at = ''", name)
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// HasNewName kiểm tra file tại path (tuyệt đối) có phải là kết quả của một lần
+// đổi tên thành công. So sánh theo new_path vì file_path phụ thuộc cách viết thư
+// mục quét; bản ghi cũ không có new_path thì so theo file_path.
+func (d *Database) HasNewName(path string) (bool, error) {
+	name, dir := filepath.Base(path), filepath.Dir(path)
+	row := d.db.QueryRow(`SELECT COUNT(*) FROM file_records
+WHERE new_name = ? AND (new_path = ? OR (new_path = '' AND file_path = ?)) AND success AND undone_at = ''`, name, path, dir)
 	var count int
 	if err := row.Scan(&count); err != nil {
 		return false, err
@@ -49,26 +295,78 @@ func (d *Database) HasOriginalName(name string) (bool, error) {
 	return count > 0, nil
 }
 
-// InsertFileRecord thêm bản ghi file vào DB
+// NextRuleCounter tăng bộ đếm seq() của luật và trả về giá trị mới, bắt đầu từ 1
+func (d *Database) NextRuleCounter(name string) (int64, error) {
+	var value int64
+	err := d.db.QueryRow(`INSERT INTO rule_counters (name, value) VALUES (?, 1)
+ON CONFLICT(name) DO UPDATE SET value = value + 1 RETURNING value`, name).Scan(&value)
+	return value, err
+}
+
+// PeekRuleCounter trả về giá trị hiện tại của bộ đếm, 0 nếu chưa dùng
+func (d *Database) PeekRuleCounter(name string) (int64, error) {
+	var value int64
+	err := d.db.QueryRow("SELECT value FROM rule_counters WHERE name = ?", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return value, err
+}
+
+// InsertFileRecord thêm bản ghi file (kèm metadata nếu có) vào DB
 func (d *Database) InsertFileRecord(record domain.FileRecord) error {
-	_, err := d.db.Exec(
-		`INSERT INTO file_records (original_name, new_name, file_path, file_size, file_mode, mod_time, success, error_msg, renamed_at)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		record.OriginalName, record.NewName, record.FilePath, record.FileSize, record.FileMode, record.ModTime, record.Success, record.ErrorMsg, record.RenamedAt,
-	)
-	return err
+	return d.InsertFileRecords([]domain.FileRecord{record})
+}
+
+// InsertFileRecords thêm nhiều bản ghi, kèm metadata, trong một transaction
+func (d *Database) InsertFileRecords(records []domain.FileRecord) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(insertFileRecordSQL)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	metaStmt, err := tx.Prepare(insertFileMetadataSQL)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer metaStmt.Close()
+	for _, record := range records {
+		res, err := stmt.Exec(fileRecordArgs(record)...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		m := record.Metadata
+		if m == nil {
+			continue
+		}
+		id, err := res.LastInsertId()
+		if err == nil {
+			_, err = metaStmt.Exec(id, m.TakenAt, m.CameraMake, m.CameraModel, m.Width, m.Height, m.Duration)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (d *Database) GetAllFileRecords() ([]domain.FileRecord, error) {
-	rows, err := d.db.Query("SELECT original_name, new_name, file_path, file_size, file_mode, mod_time, success, error_msg, renamed_at, id FROM file_records ORDER BY id DESC")
+	rows, err := d.db.Query("SELECT " + fileRecordColumns + " FROM " + fileRecordTables + " ORDER BY id DESC")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var records []domain.FileRecord
 	for rows.Next() {
-		var r domain.FileRecord
-		err := rows.Scan(&r.OriginalName, &r.NewName, &r.FilePath, &r.FileSize, &r.FileMode, &r.ModTime, &r.Success, &r.ErrorMsg, &r.RenamedAt, &r.Id)
+		r, err := scanFileRecord(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -80,7 +378,7 @@ func (d *Database) GetAllFileRecords() ([]domain.FileRecord, error) {
 func (d *Database) GetFileRecordsPage(page, pageSize int) ([]domain.FileRecord, error) {
 	offset := (page - 1) * pageSize
 	rows, err := d.db.Query(
-		"SELECT original_name, new_name, file_path, file_size, file_mode, mod_time, success, error_msg, renamed_at, id FROM file_records ORDER BY id DESC LIMIT ? OFFSET ?",
+		"SELECT "+fileRecordColumns+" FROM "+fileRecordTables+" ORDER BY id DESC LIMIT ? OFFSET ?",
 		pageSize, offset,
 	)
 	if err != nil {
@@ -89,8 +387,7 @@ func (d *Database) GetFileRecordsPage(page, pageSize int) ([]domain.FileRecord,
 	defer rows.Close()
 	var records []domain.FileRecord
 	for rows.Next() {
-		var r domain.FileRecord
-		err := rows.Scan(&r.OriginalName, &r.NewName, &r.FilePath, &r.FileSize, &r.FileMode, &r.ModTime, &r.Success, &r.ErrorMsg, &r.RenamedAt, &r.Id)
+		r, err := scanFileRecord(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -99,6 +396,66 @@ func (d *Database) GetFileRecordsPage(page, pageSize int) ([]domain.FileRecord,
 	return records, nil
 }
 
+// GetFileRecordGroup đọc các bản ghi của một nhóm file đi kèm, theo thứ tự ghi
+func (d *Database) GetFileRecordGroup(groupID string) ([]domain.FileRecord, error) {
+	rows, err := d.db.Query("SELECT "+fileRecordColumns+" FROM "+fileRecordTables+" WHERE group_id = ? ORDER BY id", groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []domain.FileRecord
+	for rows.Next() {
+		r, err := scanFileRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// FindRenamedByStem đọc các bản ghi đổi tên thành công, chưa hoàn tác có
+// đường dẫn cũ bắt đầu bằng stem + "." (không phân biệt hoa thường), mới nhất trước
+func (d *Database) FindRenamedByStem(stem string) ([]domain.FileRecord, error) {
+	rows, err := d.db.Query("SELECT "+fileRecordColumns+" FROM "+fileRecordTables+
+		` WHERE success AND undone_at = '' AND new_path != '' AND old_path LIKE ? ESCAPE '\' ORDER BY id DESC`,
+		likePattern(stem + ".")[1:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []domain.FileRecord
+	for rows.Next() {
+		r, err := scanFileRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// SetFileRecordGroup gán group_id cho bản ghi
+func (d *Database) SetFileRecordGroup(id int, groupID string) error {
+	_, err := d.db.Exec("UPDATE file_records SET group_id = ? WHERE id = ?", groupID, id)
+	return err
+}
+
+// GetFileRecord đọc một bản ghi theo id; sql.ErrNoRows nếu không có
+func (d *Database) GetFileRecord(id int) (domain.FileRecord, error) {
+	return scanFileRecord(d.db.QueryRow("SELECT "+fileRecordColumns+" FROM "+fileRecordTables+" WHERE id = ?", id))
+}
+
+// MarkFileRecordUndone đánh dấu bản ghi đã được hoàn tác; false nếu bản ghi đã hoàn tác trước đó
+func (d *Database) MarkFileRecordUndone(id int, at string) (bool, error) {
+	res, err := d.db.Exec("UPDATE file_records SET undone_at = ? WHERE id = ? AND undone_at = ''", at, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
 func (d *Database) CountFileRecords() (int, error) {
 	row := d.db.QueryRow("SELECT COUNT(*) FROM file_records")
 	var count int
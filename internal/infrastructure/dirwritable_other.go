@@ -0,0 +1,11 @@
+//go:build !unix
+
+package infrastructure
+
+import "os"
+
+// DirWritable kiểm tra bit ghi của thư mục; trên hệ không có access(2) đây chỉ là ước lượng
+func DirWritable(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.Mode().Perm()&0200 != 0
+}
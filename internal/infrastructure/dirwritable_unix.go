@@ -0,0 +1,11 @@
+//go:build unix
+
+package infrastructure
+
+import "golang.org/x/sys/unix"
+
+// DirWritable kiểm tra tiến trình có quyền ghi vào thư mục (access(2) W_OK|X_OK),
+// không cần tạo file thử trong thư mục đang được quét
+func DirWritable(dir string) bool {
+	return unix.Access(dir, unix.W_OK|unix.X_OK) == nil
+}
@@ -0,0 +1,197 @@
+// Minimal EXIF reader for photo metadata
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+// exifHeaderSize là số byte đầu file được đọc để tìm EXIF; APP1 của JPEG tối đa 64KB
+const exifHeaderSize = 128 << 10
+
+// Tag EXIF cần đọc
+const (
+	exifTagImageWidth         = 0x0100
+	exifTagImageLength        = 0x0101
+	exifTagMake               = 0x010F
+	exifTagModel              = 0x0110
+	exifTagDateTime           = 0x0132
+	exifTagExifIFD            = 0x8769
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagPixelXDimension    = 0xA002
+	exifTagPixelYDimension    = 0xA003
+)
+
+// Kiểu giá trị của tag TIFF
+const (
+	tiffTypeASCII = 2
+	tiffTypeShort = 3
+	tiffTypeLong  = 4
+)
+
+// ifdEntry là một tag trong IFD; pos là vị trí 4 byte giá trị (hoặc offset tới giá trị)
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	pos   int64
+}
+
+// jpegMetadata đọc EXIF (segment APP1) và kích thước ảnh (segment SOF) của JPEG
+func jpegMetadata(data []byte) domain.FileMetadata {
+	var m domain.FileMetadata
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return m
+	}
+	width, height := 0, 0
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		// SOS hoặc EOI: đã qua phần metadata
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		start, end := i+4, i+2+size
+		if size < 2 || end > len(data) {
+			break
+		}
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(data[start:end], []byte("Exif\x00\x00")):
+			m = readExif(data[start+6 : end])
+		// SOF0..SOF15 trừ DHT (C4), JPG (C8) và DAC (CC)
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC && end-start >= 5:
+			height = int(binary.BigEndian.Uint16(data[start+1:]))
+			width = int(binary.BigEndian.Uint16(data[start+3:]))
+		}
+		i = end
+	}
+	// Kích thước trong SOF là kích thước thật của ảnh, EXIF có thể đã cũ sau khi sửa ảnh
+	if width > 0 && height > 0 {
+		m.Width, m.Height = width, height
+	}
+	return m
+}
+
+// readExif đọc ngày chụp, máy ảnh và kích thước từ dữ liệu TIFF chứa EXIF (cả
+// file TIFF, RAW dựa trên TIFF, hoặc phần EXIF của JPEG/HEIC). EXIF thường không
+// lưu múi giờ: khi không có OffsetTimeOriginal ngày được hiểu theo giờ địa phương.
+func readExif(tiff []byte) domain.FileMetadata {
+	var m domain.FileMetadata
+	if len(tiff) < 8 {
+		return m
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return m
+	}
+	ifd0 := readIFD(tiff, order, order.Uint32(tiff[4:]))
+	exif := map[uint16]ifdEntry{}
+	if off, ok := exifUint(tiff, order, ifd0, exifTagExifIFD); ok {
+		exif = readIFD(tiff, order, off)
+	}
+
+	m.CameraMake = exifText(tiff, order, ifd0, exifTagMake)
+	m.CameraModel = exifText(tiff, order, ifd0, exifTagModel)
+	raw := exifText(tiff, order, exif, exifTagDateTimeOriginal)
+	if !validExifDate(raw) {
+		raw = exifText(tiff, order, ifd0, exifTagDateTime)
+	}
+	if validExifDate(raw) {
+		loc := time.Local
+		if offset := exifText(tiff, order, exif, exifTagOffsetTimeOriginal); offset != "" {
+			if t, err := time.Parse("-07:00", offset); err == nil {
+				_, secs := t.Zone()
+				loc = time.FixedZone(offset, secs)
+			}
+		}
+		if t, err := time.ParseInLocation("2006:01:02 15:04:05", raw[:19], loc); err == nil {
+			m.TakenAt = t.Format(time.RFC3339)
+		}
+	}
+	w, okW := exifUint(tiff, order, exif, exifTagPixelXDimension)
+	h, okH := exifUint(tiff, order, exif, exifTagPixelYDimension)
+	if !okW || !okH {
+		w, okW = exifUint(tiff, order, ifd0, exifTagImageWidth)
+		h, okH = exifUint(tiff, order, ifd0, exifTagImageLength)
+	}
+	if okW && okH {
+		m.Width, m.Height = int(w), int(h)
+	}
+	return m
+}
+
+// readIFD trả về các tag của một IFD
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) map[uint16]ifdEntry {
+	tags := map[uint16]ifdEntry{}
+	if offset == 0 || int64(offset)+2 > int64(len(tiff)) {
+		return tags
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for k := 0; k < count; k++ {
+		entry := int64(offset) + 2 + int64(k)*12
+		if entry+12 > int64(len(tiff)) {
+			break
+		}
+		tags[order.Uint16(tiff[entry:])] = ifdEntry{
+			typ:   order.Uint16(tiff[entry+2:]),
+			count: order.Uint32(tiff[entry+4:]),
+			pos:   entry + 8,
+		}
+	}
+	return tags
+}
+
+// exifText đọc tag kiểu ASCII, bỏ NUL và khoảng trắng ở cuối
+func exifText(tiff []byte, order binary.ByteOrder, tags map[uint16]ifdEntry, tag uint16) string {
+	e, ok := tags[tag]
+	if !ok || e.typ != tiffTypeASCII || e.count == 0 {
+		return ""
+	}
+	start := e.pos
+	if e.count > 4 {
+		start = int64(order.Uint32(tiff[e.pos:]))
+	}
+	end := start + int64(e.count)
+	if end > int64(len(tiff)) {
+		return ""
+	}
+	s := string(tiff[start:end])
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// exifUint đọc tag kiểu SHORT hoặc LONG (phần tử đầu tiên)
+func exifUint(tiff []byte, order binary.ByteOrder, tags map[uint16]ifdEntry, tag uint16) (uint32, bool) {
+	e, ok := tags[tag]
+	if !ok || e.count == 0 {
+		return 0, false
+	}
+	switch e.typ {
+	case tiffTypeShort:
+		return uint32(order.Uint16(tiff[e.pos:])), true
+	case tiffTypeLong:
+		return order.Uint32(tiff[e.pos:]), true
+	}
+	return 0, false
+}
+
+// validExifDate kiểm tra chuỗi ngày dạng "2006:01:02 15:04:05"; máy ảnh chưa
+// đặt giờ thường ghi toàn số 0
+func validExifDate(s string) bool {
+	return len(s) >= 19 && !strings.HasPrefix(s, "0000")
+}
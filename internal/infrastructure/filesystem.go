@@ -2,9 +2,16 @@
 package infrastructure
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"os"
+	"path/filepath"
 )
 
+// walkChunkSize là số entry đọc mỗi lần từ một thư mục
+const walkChunkSize = 256
+
 func GetFileInfo(path string) (int64, string, string, error) {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -12,3 +19,78 @@ func GetFileInfo(path string) (int64, string, string, error) {
 	}
 	return info.Size(), info.Mode().String(), info.ModTime().Format("2006-01-02 15:04:05"), nil
 }
+
+// HashFile tính SHA-256 nội dung file dạng hex
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WalkFiles duyệt các file trong root và gọi fn ngay khi gặp mỗi file.
+// Entry được đọc theo từng phần nên bộ nhớ không phụ thuộc số file trong thư mục;
+// chỉ danh sách thư mục con đang chờ duyệt được giữ lại. Lỗi đọc thư mục con
+// được báo qua onDirError rồi bỏ qua; lỗi đọc root hoặc lỗi từ fn dừng việc duyệt.
+func WalkFiles(root string, recursive bool, fn func(path string) error, onDirError func(dir string, err error)) error {
+	dirs := []string{root}
+	for len(dirs) > 0 {
+		dir := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+		var fnErr error
+		err := readDirChunks(dir, func(e os.DirEntry) error {
+			path := filepath.Join(dir, e.Name())
+			if e.IsDir() {
+				if recursive {
+					dirs = append(dirs, path)
+				}
+				return nil
+			}
+			if fnErr = fn(path); fnErr != nil {
+				return fnErr
+			}
+			return nil
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			if dir == root {
+				return err
+			}
+			if onDirError != nil {
+				onDirError(dir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readDirChunks gọi fn cho từng entry của dir, đọc tối đa walkChunkSize entry mỗi lần
+func readDirChunks(dir string, fn func(entry os.DirEntry) error) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		entries, err := f.ReadDir(walkChunkSize)
+		for _, e := range entries {
+			if ferr := fn(e); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
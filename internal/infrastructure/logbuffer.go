@@ -0,0 +1,250 @@
+// In-memory ring buffer of recent log lines
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLogBufferSize là số dòng log giữ lại mặc định
+const DefaultLogBufferSize = 1000
+
+// LogEntry là một dòng log đã được ghi lại
+type LogEntry struct {
+	Seq     uint64            `json:"seq"`
+	Time    string            `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"msg"`
+	Source  string            `json:"source,omitempty"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+}
+
+// LogFilter lọc dòng log: mức tối thiểu, chuỗi con (không phân biệt hoa thường)
+// trong message hoặc thuộc tính, và chỉ các dòng sau After
+type LogFilter struct {
+	MinLevel slog.Level
+	Contains string
+	After    uint64
+}
+
+// Match kiểm tra dòng log có thỏa bộ lọc
+func (f LogFilter) Match(e LogEntry) bool {
+	if e.Seq <= f.After {
+		return false
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(e.Level)); err == nil && level < f.MinLevel {
+		return false
+	}
+	if f.Contains == "" {
+		return true
+	}
+	needle := strings.ToLower(f.Contains)
+	if strings.Contains(strings.ToLower(e.Message), needle) {
+		return true
+	}
+	for k, v := range e.Attrs {
+		if strings.Contains(strings.ToLower(k+"="+v), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// LogBuffer giữ các dòng log gần nhất trong vòng đệm cố định và phát dòng mới
+// tới subscriber; giống EventBus, subscriber đọc chậm sẽ bị bỏ dòng
+type LogBuffer struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	start   int
+	size    int
+	seq     uint64
+	subs    map[chan LogEntry]struct{}
+}
+
+// Logs là bộ đệm log dùng chung của ứng dụng
+var Logs = NewLogBuffer(DefaultLogBufferSize)
+
+// NewLogBuffer tạo bộ đệm chứa tối đa capacity dòng
+func NewLogBuffer(capacity int) *LogBuffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LogBuffer{entries: make([]LogEntry, capacity), subs: make(map[chan LogEntry]struct{})}
+}
+
+// Capacity trả về số dòng tối đa
+func (b *LogBuffer) Capacity() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+// SetCapacity đổi kích thước bộ đệm, giữ lại các dòng mới nhất
+func (b *LogBuffer) SetCapacity(capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := b.snapshotLocked()
+	if len(kept) > capacity {
+		kept = kept[len(kept)-capacity:]
+	}
+	b.entries = make([]LogEntry, capacity)
+	copy(b.entries, kept)
+	b.start = 0
+	b.size = len(kept)
+}
+
+// Append thêm một dòng, gán số thứ tự và phát tới subscriber
+func (b *LogBuffer) Append(e LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e.Seq = b.seq
+	if b.size < len(b.entries) {
+		b.entries[(b.start+b.size)%len(b.entries)] = e
+		b.size++
+	} else {
+		b.entries[b.start] = e
+		b.start = (b.start + 1) % len(b.entries)
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Entries trả về tối đa limit dòng mới nhất thỏa bộ lọc, cũ nhất trước; limit <= 0 là không giới hạn
+func (b *LogBuffer) Entries(filter LogFilter, limit int) []LogEntry {
+	b.mu.Lock()
+	all := b.snapshotLocked()
+	b.mu.Unlock()
+	matched := []LogEntry{}
+	for _, e := range all {
+		if filter.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+	return matched
+}
+
+func (b *LogBuffer) snapshotLocked() []LogEntry {
+	out := make([]LogEntry, b.size)
+	for i := 0; i < b.size; i++ {
+		out[i] = b.entries[(b.start+i)%len(b.entries)]
+	}
+	return out
+}
+
+// Subscribe đăng ký nhận dòng log mới, trả về channel và hàm hủy đăng ký
+func (b *LogBuffer) Subscribe(buffer int) (<-chan LogEntry, func()) {
+	ch := make(chan LogEntry, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// bufferHandler chuyển record cho handler chính và đồng thời lưu vào LogBuffer
+type bufferHandler struct {
+	next   slog.Handler
+	buf    *LogBuffer
+	attrs  []slog.Attr
+	prefix string
+}
+
+func newBufferHandler(next slog.Handler, buf *LogBuffer) slog.Handler {
+	return &bufferHandler{next: next, buf: buf}
+}
+
+func (h *bufferHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *bufferHandler) Handle(ctx context.Context, r slog.Record) error {
+	entry := LogEntry{
+		Time:    r.Time.UTC().Format(time.RFC3339Nano),
+		Level:   r.Level.String(),
+		Message: r.Message,
+		Attrs:   map[string]string{},
+	}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		entry.Source = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+	for _, a := range h.attrs {
+		flattenAttr(entry.Attrs, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		flattenAttr(entry.Attrs, h.prefix, a)
+		return true
+	})
+	if len(entry.Attrs) == 0 {
+		entry.Attrs = nil
+	}
+	h.buf.Append(entry)
+	return h.next.Handle(ctx, r)
+}
+
+func (h *bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		if h.prefix != "" {
+			a.Key = h.prefix + a.Key
+		}
+		c.attrs = append(c.attrs, a)
+	}
+	return &c
+}
+
+func (h *bufferHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// flattenAttr ghi thuộc tính vào map, nhóm được nối khóa bằng dấu chấm như text handler
+func flattenAttr(out map[string]string, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		p := prefix
+		if a.Key != "" {
+			p = prefix + a.Key + "."
+		}
+		for _, g := range a.Value.Group() {
+			flattenAttr(out, p, g)
+		}
+		return
+	}
+	out[prefix+a.Key] = a.Value.String()
+}
@@ -0,0 +1,56 @@
+// Structured logging setup for auto-rename
+package infrastructure
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Định dạng log hỗ trợ
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogHandler tạo slog handler theo định dạng; source chỉ giữ tên file:dòng
+// giống log.Lshortfile trước đây
+func NewLogHandler(w io.Writer, level slog.Leveler, format string) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.SourceKey && len(groups) == 0 {
+				if src, ok := a.Value.Any().(*slog.Source); ok {
+					a.Value = slog.StringValue(fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+				}
+			}
+			return a
+		},
+	}
+	switch format {
+	case LogFormatText, "":
+		return slog.NewTextHandler(w, opts), nil
+	case LogFormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// SetupLogging đặt logger mặc định ghi ra stderr và giữ bufferSize dòng gần nhất
+// trong Logs; package log chuẩn cũng đi qua handler này nên log của thư viện
+// (vd. net/http) cùng định dạng
+func SetupLogging(level slog.Leveler, format string, bufferSize int) error {
+	handler, err := NewLogHandler(os.Stderr, level, format)
+	if err != nil {
+		return err
+	}
+	Logs.SetCapacity(bufferSize)
+	slog.SetDefault(slog.New(newBufferHandler(handler, Logs)))
+	log.SetFlags(0)
+	return nil
+}
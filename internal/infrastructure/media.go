@@ -0,0 +1,438 @@
+// Media metadata: EXIF of photos and headers of HEIC, MP4/MOV files
+package infrastructure
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+// Giới hạn khi đọc ISO base media: số box mỗi cấp và kích thước một box được
+// đọc vào bộ nhớ (moov của video dài có thể vài MB)
+const (
+	maxBoxes     = 1024
+	maxBoxRead   = 16 << 20
+	mp4EpochDiff = 2082844800 // số giây từ 1904-01-01 (epoch của MP4) tới 1970-01-01
+)
+
+// box là một box ISO base media; start và end là phần nội dung sau header
+type box struct {
+	typ        string
+	start, end int64
+}
+
+// mp4DateLayouts là các dạng ngày trong ©day và com.apple.quicktime.creationdate
+var mp4DateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ReadMediaMetadata đọc metadata ảnh/video của file theo loại file nhận ra từ
+// nội dung: EXIF của JPEG, TIFF (và RAW dựa trên TIFF), HEIC/AVIF; kích thước
+// PNG, GIF; ngày quay, thời lượng, kích thước và máy quay của MP4/MOV.
+// ok false khi file không đọc được hoặc không có metadata.
+func ReadMediaMetadata(path string, fileType FileType) (m domain.FileMetadata, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return m, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return m, false
+	}
+
+	switch fileType.MIME {
+	case "image/jpeg":
+		m = jpegMetadata(readHeader(f, exifHeaderSize))
+	case "image/tiff":
+		m = readExif(readHeader(f, exifHeaderSize))
+	case "image/png":
+		if data := readHeader(f, 24); len(data) == 24 {
+			m.Width = int(binary.BigEndian.Uint32(data[16:]))
+			m.Height = int(binary.BigEndian.Uint32(data[20:]))
+		}
+	case "image/gif":
+		if data := readHeader(f, 10); len(data) == 10 {
+			m.Width = int(binary.LittleEndian.Uint16(data[6:]))
+			m.Height = int(binary.LittleEndian.Uint16(data[8:]))
+		}
+	case "image/heic", "image/heif", "image/avif":
+		m = heifMetadata(f, info.Size())
+	case "video/mp4", "video/quicktime", "video/3gpp", "video/3gpp2", "audio/mp4":
+		m = mp4Metadata(f, info.Size())
+	}
+	return m, m != domain.FileMetadata{}
+}
+
+// readHeader đọc tối đa n byte đầu file
+func readHeader(r io.ReaderAt, n int) []byte {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil
+	}
+	return buf[:read]
+}
+
+// readBytes đọc nội dung từ start tới end, nil khi quá lớn hoặc lỗi đọc
+func readBytes(r io.ReaderAt, start, end int64) []byte {
+	if end < start || end-start > maxBoxRead {
+		return nil
+	}
+	buf := make([]byte, end-start)
+	if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil
+	}
+	return buf
+}
+
+// readBoxes liệt kê các box nằm trong khoảng [start, end). Box có kích thước
+// vượt quá end (file bị cắt) được thu lại tới end.
+func readBoxes(r io.ReaderAt, start, end int64) []box {
+	var boxes []box
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end && len(boxes) < maxBoxes; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// Box cuối cùng kéo dài tới hết file
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return boxes
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if size < headerSize {
+			break
+		}
+		boxEnd := pos + size
+		if boxEnd > end || boxEnd < pos {
+			boxEnd = end
+		}
+		boxes = append(boxes, box{typ: typ, start: pos + headerSize, end: boxEnd})
+		pos = boxEnd
+	}
+	return boxes
+}
+
+// findBox trả về box đầu tiên có kiểu typ
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// mp4Metadata đọc moov của MP4/MOV: mvhd cho ngày tạo và thời lượng, tkhd của
+// track hình cho kích thước, udta và meta cho máy quay và ngày quay có múi giờ
+func mp4Metadata(r io.ReaderAt, size int64) domain.FileMetadata {
+	var m domain.FileMetadata
+	moov, ok := findBox(readBoxes(r, 0, size), "moov")
+	if !ok {
+		return m
+	}
+	children := readBoxes(r, moov.start, moov.end)
+	if mvhd, ok := findBox(children, "mvhd"); ok {
+		if data := readBytes(r, mvhd.start, mvhd.end); len(data) >= 20 {
+			var created, scale, duration uint64
+			if data[0] == 1 && len(data) >= 32 {
+				created = binary.BigEndian.Uint64(data[4:])
+				scale = uint64(binary.BigEndian.Uint32(data[20:]))
+				duration = binary.BigEndian.Uint64(data[24:])
+			} else {
+				created = uint64(binary.BigEndian.Uint32(data[4:]))
+				scale = uint64(binary.BigEndian.Uint32(data[12:]))
+				duration = uint64(binary.BigEndian.Uint32(data[16:]))
+			}
+			// mvhd không có múi giờ: ghi theo giờ địa phương như EXIF; 0 là máy quay không ghi
+			if created > mp4EpochDiff {
+				m.TakenAt = time.Unix(int64(created-mp4EpochDiff), 0).Format(time.RFC3339)
+			}
+			if scale > 0 {
+				m.Duration = float64(duration) / float64(scale)
+			}
+		}
+	}
+	for _, trak := range children {
+		if trak.typ != "trak" {
+			continue
+		}
+		tkhd, ok := findBox(readBoxes(r, trak.start, trak.end), "tkhd")
+		if !ok {
+			continue
+		}
+		if w, h := tkhdSize(readBytes(r, tkhd.start, tkhd.end)); w > 0 && h > 0 {
+			m.Width, m.Height = w, h
+			break
+		}
+	}
+
+	tags := map[string]string{}
+	if udta, ok := findBox(children, "udta"); ok {
+		for _, b := range readBoxes(r, udta.start, udta.end) {
+			switch b.typ {
+			case "\xA9mak", "\xA9mod", "\xA9day":
+				// Chuỗi kiểu QuickTime: độ dài 2 byte, mã ngôn ngữ 2 byte, nội dung
+				if data := readBytes(r, b.start, b.end); len(data) >= 4 {
+					n := int(binary.BigEndian.Uint16(data))
+					if 4+n <= len(data) {
+						tags[b.typ] = strings.TrimSpace(string(data[4 : 4+n]))
+					}
+				}
+			case "meta":
+				readMetaTags(r, b, tags)
+			}
+		}
+	}
+	if meta, ok := findBox(children, "meta"); ok {
+		readMetaTags(r, meta, tags)
+	}
+
+	m.CameraMake = firstTag(tags, "com.apple.quicktime.make", "\xA9mak")
+	m.CameraModel = firstTag(tags, "com.apple.quicktime.model", "\xA9mod")
+	// Ngày quay trong metadata có múi giờ của máy quay nên ưu tiên hơn mvhd
+	if raw := firstTag(tags, "com.apple.quicktime.creationdate", "\xA9day"); raw != "" {
+		for _, layout := range mp4DateLayouts {
+			if t, err := time.Parse(layout, raw); err == nil {
+				m.TakenAt = t.Format(time.RFC3339)
+				break
+			}
+		}
+	}
+	return m
+}
+
+// tkhdSize đọc kích thước hiển thị của track (số 16.16), đổi chiều khi track
+// được xoay 90 độ (video quay dọc)
+func tkhdSize(data []byte) (width, height int) {
+	matrix, size := 40, 76
+	if len(data) > 0 && data[0] == 1 {
+		matrix, size = 52, 88
+	}
+	if len(data) < size+8 {
+		return 0, 0
+	}
+	width = int(binary.BigEndian.Uint32(data[size:]) >> 16)
+	height = int(binary.BigEndian.Uint32(data[size+4:]) >> 16)
+	a := binary.BigEndian.Uint32(data[matrix:])
+	b := binary.BigEndian.Uint32(data[matrix+4:])
+	if a == 0 && b != 0 {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// readMetaTags đọc các tag trong box meta: kiểu QuickTime (keys + ilst theo số
+// thứ tự khóa) và kiểu iTunes (ilst theo tên box như ©day)
+func readMetaTags(r io.ReaderAt, meta box, tags map[string]string) {
+	start := meta.start
+	// meta của MP4 là full box (có 4 byte version/flags), của QuickTime thì không
+	if head := readBytes(r, start, min(start+12, meta.end)); len(head) == 12 && string(head[4:8]) != "hdlr" {
+		start += 4
+	}
+	children := readBoxes(r, start, meta.end)
+	var keys []string
+	if k, ok := findBox(children, "keys"); ok {
+		data := readBytes(r, k.start, k.end)
+		for pos := 8; pos+8 <= len(data); {
+			n := int(binary.BigEndian.Uint32(data[pos:]))
+			if n < 8 || pos+n > len(data) {
+				break
+			}
+			keys = append(keys, string(data[pos+8:pos+n]))
+			pos += n
+		}
+	}
+	ilst, ok := findBox(children, "ilst")
+	if !ok {
+		return
+	}
+	for _, item := range readBoxes(r, ilst.start, ilst.end) {
+		name := item.typ
+		if keys != nil {
+			index := int(binary.BigEndian.Uint32([]byte(item.typ)))
+			if index < 1 || index > len(keys) {
+				continue
+			}
+			name = keys[index-1]
+		}
+		data, ok := findBox(readBoxes(r, item.start, item.end), "data")
+		if !ok {
+			continue
+		}
+		// data: kiểu giá trị 4 byte, locale 4 byte, giá trị
+		if value := readBytes(r, data.start, data.end); len(value) > 8 {
+			tags[name] = strings.TrimSpace(string(value[8:]))
+		}
+	}
+}
+
+// firstTag trả về giá trị khác rỗng đầu tiên trong các tên tag
+func firstTag(tags map[string]string, names ...string) string {
+	for _, name := range names {
+		if v := tags[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// heifMetadata đọc HEIC/HEIF/AVIF: EXIF lưu thành một item trong meta (tìm qua
+// iinf và iloc), kích thước lấy từ ispe lớn nhất (ảnh chính, không phải thumbnail)
+// thay cho kích thước trong EXIF
+func heifMetadata(r io.ReaderAt, size int64) domain.FileMetadata {
+	var m domain.FileMetadata
+	meta, ok := findBox(readBoxes(r, 0, size), "meta")
+	if !ok {
+		return m
+	}
+	children := readBoxes(r, meta.start+4, meta.end)
+
+	if exifID, ok := heifExifItem(r, children); ok {
+		if offset, length, ok := heifItemLocation(r, children, exifID); ok && length > 4 {
+			data := readBytes(r, offset, offset+min(length, exifHeaderSize))
+			// Nội dung item Exif bắt đầu bằng khoảng cách 4 byte tới header TIFF
+			if len(data) > 4 {
+				skip := int64(binary.BigEndian.Uint32(data)) + 4
+				if skip < int64(len(data)) {
+					m = readExif(data[skip:])
+				}
+			}
+		}
+	}
+
+	if iprp, ok := findBox(children, "iprp"); ok {
+		if ipco, ok := findBox(readBoxes(r, iprp.start, iprp.end), "ipco"); ok {
+			width, height := 0, 0
+			for _, b := range readBoxes(r, ipco.start, ipco.end) {
+				if b.typ != "ispe" {
+					continue
+				}
+				if data := readBytes(r, b.start, b.end); len(data) >= 12 {
+					w := int(binary.BigEndian.Uint32(data[4:]))
+					h := int(binary.BigEndian.Uint32(data[8:]))
+					if w*h > width*height {
+						width, height = w, h
+					}
+				}
+			}
+			if width > 0 && height > 0 {
+				m.Width, m.Height = width, height
+			}
+		}
+	}
+	return m
+}
+
+// heifExifItem tìm id của item có kiểu "Exif" trong iinf
+func heifExifItem(r io.ReaderAt, meta []box) (uint32, bool) {
+	iinf, ok := findBox(meta, "iinf")
+	if !ok {
+		return 0, false
+	}
+	head := readBytes(r, iinf.start, min(iinf.start+4, iinf.end))
+	if len(head) < 4 {
+		return 0, false
+	}
+	// Số entry dài 2 byte với version 0, 4 byte với các version khác
+	start := iinf.start + 6
+	if head[0] != 0 {
+		start = iinf.start + 8
+	}
+	for _, infe := range readBoxes(r, start, iinf.end) {
+		data := readBytes(r, infe.start, infe.end)
+		if infe.typ != "infe" || len(data) < 4 {
+			continue
+		}
+		switch {
+		case data[0] == 2 && len(data) >= 12 && string(data[8:12]) == "Exif":
+			return uint32(binary.BigEndian.Uint16(data[4:])), true
+		case data[0] == 3 && len(data) >= 14 && string(data[10:14]) == "Exif":
+			return binary.BigEndian.Uint32(data[4:]), true
+		}
+	}
+	return 0, false
+}
+
+// heifItemLocation đọc vị trí (extent đầu tiên) của item trong iloc; chỉ hỗ trợ
+// item nằm trực tiếp trong file (construction method 0)
+func heifItemLocation(r io.ReaderAt, meta []box, id uint32) (offset, length int64, ok bool) {
+	iloc, found := findBox(meta, "iloc")
+	if !found {
+		return 0, 0, false
+	}
+	data := readBytes(r, iloc.start, iloc.end)
+	if len(data) < 8 {
+		return 0, 0, false
+	}
+	version := data[0]
+	offsetSize, lengthSize := int(data[4]>>4), int(data[4]&0x0F)
+	baseSize, indexSize := int(data[5]>>4), int(data[5]&0x0F)
+	if version == 0 {
+		indexSize = 0
+	}
+	pos := 6
+	// readN đọc số nguyên không dấu n byte (0, 4 hoặc 8), false khi hết dữ liệu
+	readN := func(n int) (uint64, bool) {
+		if pos+n > len(data) {
+			return 0, false
+		}
+		var v uint64
+		for _, c := range data[pos : pos+n] {
+			v = v<<8 | uint64(c)
+		}
+		pos += n
+		return v, true
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count, okCount := readN(idSize)
+	if !okCount {
+		return 0, 0, false
+	}
+	for k := uint64(0); k < count && k < maxBoxes; k++ {
+		itemID, _ := readN(idSize)
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method, _ = readN(2)
+			method &= 0x0F
+		}
+		readN(2) // data_reference_index
+		base, _ := readN(baseSize)
+		extents, okExt := readN(2)
+		if !okExt {
+			return 0, 0, false
+		}
+		for e := uint64(0); e < extents; e++ {
+			readN(indexSize)
+			extOffset, _ := readN(offsetSize)
+			extLength, okLen := readN(lengthSize)
+			if !okLen {
+				return 0, 0, false
+			}
+			if e == 0 && uint32(itemID) == id && method == 0 {
+				return int64(base + extOffset), int64(extLength), true
+			}
+		}
+	}
+	return 0, 0, false
+}
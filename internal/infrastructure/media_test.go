@@ -0,0 +1,403 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+// tiffEntry là một tag khi dựng dữ liệu TIFF mẫu: chuỗi ASCII hoặc số SHORT/LONG
+type tiffEntry struct {
+	tag  uint16
+	typ  uint16
+	text string
+	num  uint32
+}
+
+func asciiTag(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag: tag, typ: tiffTypeASCII, text: s}
+}
+func shortTag(tag uint16, n uint16) tiffEntry {
+	return tiffEntry{tag: tag, typ: tiffTypeShort, num: uint32(n)}
+}
+func longTag(tag uint16, n uint32) tiffEntry { return tiffEntry{tag: tag, typ: tiffTypeLong, num: n} }
+
+// tiffOrder là thứ tự byte dùng cả Put và Append khi dựng dữ liệu mẫu
+type tiffOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// buildTIFF dựng dữ liệu TIFF có IFD0 và (nếu có tag) Exif IFD
+func buildTIFF(order tiffOrder, ifd0, exif []tiffEntry) []byte {
+	ifdSize := func(n int) int { return 2 + 12*n + 4 }
+	if len(exif) > 0 {
+		ifd0 = append(append([]tiffEntry{}, ifd0...), longTag(exifTagExifIFD, uint32(8+ifdSize(len(ifd0)+1))))
+	}
+	dataOffset := 8 + ifdSize(len(ifd0))
+	if len(exif) > 0 {
+		dataOffset += ifdSize(len(exif))
+	}
+	out := make([]byte, 8, dataOffset)
+	if order == binary.LittleEndian {
+		copy(out, "II")
+	} else {
+		copy(out, "MM")
+	}
+	order.PutUint16(out[2:], 42)
+	order.PutUint32(out[4:], 8)
+	var data []byte
+	writeIFD := func(entries []tiffEntry) {
+		out = order.AppendUint16(out, uint16(len(entries)))
+		for _, e := range entries {
+			out = order.AppendUint16(out, e.tag)
+			out = order.AppendUint16(out, e.typ)
+			value := make([]byte, 4)
+			switch e.typ {
+			case tiffTypeASCII:
+				b := []byte(e.text + "\x00")
+				out = order.AppendUint32(out, uint32(len(b)))
+				if len(b) <= 4 {
+					copy(value, b)
+				} else {
+					order.PutUint32(value, uint32(dataOffset+len(data)))
+					data = append(data, b...)
+				}
+			case tiffTypeShort:
+				out = order.AppendUint32(out, 1)
+				order.PutUint16(value, uint16(e.num))
+			default:
+				out = order.AppendUint32(out, 1)
+				order.PutUint32(value, e.num)
+			}
+			out = append(out, value...)
+		}
+		out = order.AppendUint32(out, 0)
+	}
+	writeIFD(ifd0)
+	if len(exif) > 0 {
+		writeIFD(exif)
+	}
+	return append(out, data...)
+}
+
+// sampleTIFF là EXIF đầy đủ: máy ảnh, ngày chụp có múi giờ và kích thước
+func sampleTIFF(order tiffOrder) []byte {
+	return buildTIFF(order,
+		[]tiffEntry{asciiTag(exifTagMake, "Canon"), asciiTag(exifTagModel, "EOS R5 "), asciiTag(exifTagDateTime, "2022:01:01 00:00:00")},
+		[]tiffEntry{
+			asciiTag(exifTagDateTimeOriginal, "2021:07:04 10:20:30"),
+			asciiTag(exifTagOffsetTimeOriginal, "+09:00"),
+			longTag(exifTagPixelXDimension, 8192),
+			shortTag(exifTagPixelYDimension, 5464),
+		})
+}
+
+// jpegSegment dựng một segment JPEG có độ dài
+func jpegSegment(marker byte, payload []byte) []byte {
+	out := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(out[2:], uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+// buildJPEG dựng JPEG với APP1 chứa tiff (nếu có) và SOF0 width x height (nếu > 0)
+func buildJPEG(tiff []byte, width, height uint16) []byte {
+	out := []byte{0xFF, 0xD8}
+	if tiff != nil {
+		out = append(out, jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))...)
+	}
+	if width > 0 {
+		sof := []byte{8, 0, 0, 0, 0, 3, 1, 0x11, 0, 2, 0x11, 1, 3, 0x11, 1}
+		binary.BigEndian.PutUint16(sof[1:], height)
+		binary.BigEndian.PutUint16(sof[3:], width)
+		out = append(out, jpegSegment(0xC0, sof)...)
+	}
+	return append(out, 0xFF, 0xDA, 0, 2)
+}
+
+// mp4Box dựng một box ISO base media
+func mp4Box(typ string, children ...[]byte) []byte {
+	payload := bytes.Join(children, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+func u32(n uint32) []byte { return binary.BigEndian.AppendUint32(nil, n) }
+func u16(n uint16) []byte { return binary.BigEndian.AppendUint16(nil, n) }
+
+// mvhd dựng mvhd version 0 với thời điểm tạo (giây từ 1904), timescale và thời lượng
+func mvhd(created, scale, duration uint32) []byte {
+	return mp4Box("mvhd", u32(0), u32(created), u32(created), u32(scale), u32(duration), make([]byte, 80))
+}
+
+// tkhd dựng tkhd version 0 với kích thước hiển thị; rotated là ma trận xoay 90 độ
+func tkhd(width, height uint16, rotated bool) []byte {
+	data := make([]byte, 84)
+	a, b := uint32(0x10000), uint32(0)
+	if rotated {
+		a, b = 0, 0x10000
+	}
+	binary.BigEndian.PutUint32(data[40:], a)
+	binary.BigEndian.PutUint32(data[44:], b)
+	binary.BigEndian.PutUint32(data[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(data[80:], uint32(height)<<16)
+	return mp4Box("tkhd", data)
+}
+
+// quickTimeText dựng box chuỗi kiểu QuickTime trong udta
+func quickTimeText(typ, s string) []byte {
+	return mp4Box(typ, u16(uint16(len(s))), u16(0x55C4), []byte(s))
+}
+
+// quickTimeMeta dựng meta kiểu QuickTime (keys + ilst theo số thứ tự khóa)
+func quickTimeMeta(tags ...[2]string) []byte {
+	var keys, items [][]byte
+	for i, t := range tags {
+		keys = append(keys, mp4Box("mdta", []byte(t[0])))
+		items = append(items, mp4Box(string(u32(uint32(i+1))), mp4Box("data", u32(1), u32(0), []byte(t[1]))))
+	}
+	return mp4Box("meta",
+		mp4Box("hdlr", make([]byte, 24)),
+		mp4Box("keys", u32(0), u32(uint32(len(tags))), bytes.Join(keys, nil)),
+		mp4Box("ilst", items...))
+}
+
+// mp4Seconds đổi thời điểm sang số giây từ epoch của MP4
+func mp4Seconds(t time.Time) uint32 {
+	return uint32(t.Unix() + mp4EpochDiff)
+}
+
+func sampleMP4() []byte {
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("qt  "), u32(0)),
+		mp4Box("moov",
+			mvhd(mp4Seconds(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), 600, 1500),
+			mp4Box("trak", tkhd(0, 0, false)),
+			mp4Box("trak", tkhd(1920, 1080, true)),
+			mp4Box("udta", quickTimeText("\xA9mod", "iPhone 14"), quickTimeText("\xA9day", "2019-01-01")),
+			quickTimeMeta([2]string{"com.apple.quicktime.make", "Apple"}, [2]string{"com.apple.quicktime.creationdate", "2023-06-01T12:00:00+0200"})),
+		mp4Box("mdat", make([]byte, 16)),
+	}, nil)
+}
+
+// buildHEIF dựng HEIC có item Exif (qua iinf và iloc) và hai ispe (thumbnail và ảnh chính)
+func buildHEIF(tiff []byte) []byte {
+	exifItem := append(u32(0), tiff...)
+	build := func(exifOffset uint32) []byte {
+		return bytes.Join([][]byte{
+			mp4Box("ftyp", []byte("heic"), u32(0)),
+			mp4Box("meta", u32(0),
+				mp4Box("hdlr", make([]byte, 24)),
+				mp4Box("iinf", u32(0), u16(2),
+					mp4Box("infe", []byte{2, 0, 0, 0}, u16(1), u16(0), []byte("hvc1")),
+					mp4Box("infe", []byte{2, 0, 0, 0}, u16(2), u16(0), []byte("Exif"))),
+				mp4Box("iloc", u32(0), []byte{0x44, 0x00}, u16(1),
+					u16(2), u16(0), u16(1), u32(exifOffset), u32(uint32(len(exifItem)))),
+				mp4Box("iprp", mp4Box("ipco",
+					mp4Box("ispe", u32(0), u32(320), u32(240)),
+					mp4Box("ispe", u32(0), u32(4032), u32(3024))))),
+			mp4Box("mdat", exifItem),
+		}, nil)
+	}
+	// Vị trí item Exif là cuối file trừ nội dung của mdat
+	size := len(build(0))
+	return build(uint32(size - len(exifItem)))
+}
+
+func TestReadExif(t *testing.T) {
+	localDate := func(s string) string {
+		d, _ := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+		return d.Format(time.RFC3339)
+	}
+	tests := []struct {
+		name string
+		tiff []byte
+		want domain.FileMetadata
+	}{
+		{"little endian", sampleTIFF(binary.LittleEndian),
+			domain.FileMetadata{TakenAt: "2021-07-04T10:20:30+09:00", CameraMake: "Canon", CameraModel: "EOS R5", Width: 8192, Height: 5464}},
+		{"big endian", sampleTIFF(binary.BigEndian),
+			domain.FileMetadata{TakenAt: "2021-07-04T10:20:30+09:00", CameraMake: "Canon", CameraModel: "EOS R5", Width: 8192, Height: 5464}},
+		{"no offset is local time", buildTIFF(binary.LittleEndian, nil,
+			[]tiffEntry{asciiTag(exifTagDateTimeOriginal, "2021:07:04 10:20:30")}),
+			domain.FileMetadata{TakenAt: localDate("2021:07:04 10:20:30")}},
+		{"unset date falls back to DateTime", buildTIFF(binary.BigEndian,
+			[]tiffEntry{asciiTag(exifTagDateTime, "2018:02:03 04:05:06"), shortTag(exifTagImageWidth, 640), shortTag(exifTagImageLength, 480)},
+			[]tiffEntry{asciiTag(exifTagDateTimeOriginal, "0000:00:00 00:00:00")}),
+			domain.FileMetadata{TakenAt: localDate("2018:02:03 04:05:06"), Width: 640, Height: 480}},
+		{"short text stored inline", buildTIFF(binary.LittleEndian, []tiffEntry{asciiTag(exifTagMake, "GO")}, nil),
+			domain.FileMetadata{CameraMake: "GO"}},
+		{"not TIFF", []byte("XX*\x00\x08\x00\x00\x00"), domain.FileMetadata{}},
+		{"IFD offset out of range", []byte("II*\x00\xff\xff\x00\x00"), domain.FileMetadata{}},
+		{"too short", []byte("II*"), domain.FileMetadata{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readExif(tt.tiff); got != tt.want {
+				t.Errorf("readExif() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJPEGMetadata(t *testing.T) {
+	exifOnly := domain.FileMetadata{TakenAt: "2021-07-04T10:20:30+09:00", CameraMake: "Canon", CameraModel: "EOS R5", Width: 8192, Height: 5464}
+	tests := []struct {
+		name string
+		data []byte
+		want domain.FileMetadata
+	}{
+		{"exif and SOF size", buildJPEG(sampleTIFF(binary.LittleEndian), 4000, 3000),
+			domain.FileMetadata{TakenAt: exifOnly.TakenAt, CameraMake: "Canon", CameraModel: "EOS R5", Width: 4000, Height: 3000}},
+		{"exif only", buildJPEG(sampleTIFF(binary.BigEndian), 0, 0), exifOnly},
+		{"SOF only", buildJPEG(nil, 800, 600), domain.FileMetadata{Width: 800, Height: 600}},
+		{"not JPEG", []byte("\x89PNG\r\n\x1a\n"), domain.FileMetadata{}},
+		{"segment longer than data", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 'E', 'x'}, domain.FileMetadata{}},
+		{"bad segment length", []byte{0xFF, 0xD8, 0xFF, 0xC0, 0x00, 0x01, 0, 0, 0, 0}, domain.FileMetadata{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegMetadata(tt.data); got != tt.want {
+				t.Errorf("jpegMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMP4Metadata(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		data []byte
+		want domain.FileMetadata
+	}{
+		{"QuickTime tags, rotated track", sampleMP4(),
+			domain.FileMetadata{TakenAt: "2023-06-01T12:00:00+02:00", CameraMake: "Apple", CameraModel: "iPhone 14", Width: 1080, Height: 1920, Duration: 2.5}},
+		{"mvhd only", mp4Box("moov", mvhd(mp4Seconds(created), 1000, 90500)),
+			domain.FileMetadata{TakenAt: created.Local().Format(time.RFC3339), Duration: 90.5}},
+		{"udta date", mp4Box("moov", mvhd(0, 0, 0), mp4Box("udta", quickTimeText("\xA9day", "2019-01-01"))),
+			domain.FileMetadata{TakenAt: "2019-01-01T00:00:00Z"}},
+		{"no moov", mp4Box("ftyp", []byte("isom")), domain.FileMetadata{}},
+		{"box size smaller than header", []byte("\x00\x00\x00\x04moov"), domain.FileMetadata{}},
+		{"largesize box past the end", append([]byte("\x00\x00\x00\x01moov"), 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF), domain.FileMetadata{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mp4Metadata(bytes.NewReader(tt.data), int64(len(tt.data))); got != tt.want {
+				t.Errorf("mp4Metadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHEIFMetadata(t *testing.T) {
+	data := buildHEIF(sampleTIFF(binary.BigEndian))
+	want := domain.FileMetadata{TakenAt: "2021-07-04T10:20:30+09:00", CameraMake: "Canon", CameraModel: "EOS R5", Width: 4032, Height: 3024}
+	if got := heifMetadata(bytes.NewReader(data), int64(len(data))); got != want {
+		t.Errorf("heifMetadata() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadMediaMetadata(t *testing.T) {
+	dir := t.TempDir()
+	png := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), 0, 0, 0x01, 0x2C, 0, 0, 0, 0xC8)
+	gif := []byte("GIF89a\x40\x01\xF0\x00")
+	tests := []struct {
+		name   string
+		mime   string
+		data   []byte
+		want   domain.FileMetadata
+		wantOK bool
+	}{
+		{"jpeg", "image/jpeg", buildJPEG(sampleTIFF(binary.LittleEndian), 4000, 3000),
+			domain.FileMetadata{TakenAt: "2021-07-04T10:20:30+09:00", CameraMake: "Canon", CameraModel: "EOS R5", Width: 4000, Height: 3000}, true},
+		{"tiff", "image/tiff", sampleTIFF(binary.BigEndian),
+			domain.FileMetadata{TakenAt: "2021-07-04T10:20:30+09:00", CameraMake: "Canon", CameraModel: "EOS R5", Width: 8192, Height: 5464}, true},
+		{"png", "image/png", png, domain.FileMetadata{Width: 300, Height: 200}, true},
+		{"gif", "image/gif", gif, domain.FileMetadata{Width: 320, Height: 240}, true},
+		{"truncated png", "image/png", png[:20], domain.FileMetadata{}, false},
+		{"other type", "text/plain", []byte("hello"), domain.FileMetadata{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := ReadMediaMetadata(path, FileType{MIME: tt.mime})
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ReadMediaMetadata() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+	if _, ok := ReadMediaMetadata(filepath.Join(dir, "missing"), FileType{MIME: "image/jpeg"}); ok {
+		t.Error("ReadMediaMetadata of a missing file returned ok")
+	}
+}
+
+// TestTruncatedMedia đọc mọi phần đầu của các file mẫu như file bị cắt; không được panic
+func TestTruncatedMedia(t *testing.T) {
+	samples := map[string][]byte{
+		"jpeg": buildJPEG(sampleTIFF(binary.LittleEndian), 4000, 3000),
+		"mp4":  sampleMP4(),
+		"heif": buildHEIF(sampleTIFF(binary.BigEndian)),
+	}
+	for name, data := range samples {
+		t.Run(name, func(t *testing.T) {
+			for n := 0; n <= len(data); n++ {
+				parseMedia(data[:n])
+			}
+			// Từng byte bị đổi thành 0xFF (độ dài, offset hỏng)
+			for i := range data {
+				broken := append([]byte{}, data...)
+				broken[i] = 0xFF
+				parseMedia(broken)
+			}
+		})
+	}
+}
+
+// parseMedia chạy mọi parser trên dữ liệu bất kỳ
+func parseMedia(data []byte) {
+	jpegMetadata(data)
+	readExif(data)
+	r := bytes.NewReader(data)
+	mp4Metadata(r, int64(len(data)))
+	heifMetadata(r, int64(len(data)))
+}
+
+func FuzzParseJPEG(f *testing.F) {
+	f.Add(buildJPEG(sampleTIFF(binary.LittleEndian), 4000, 3000))
+	f.Add(buildJPEG(sampleTIFF(binary.BigEndian), 0, 0))
+	f.Add(buildJPEG(nil, 800, 600))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		jpegMetadata(data)
+	})
+}
+
+func FuzzParseExif(f *testing.F) {
+	f.Add(sampleTIFF(binary.LittleEndian))
+	f.Add(sampleTIFF(binary.BigEndian))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		readExif(data)
+	})
+}
+
+func FuzzParseMP4(f *testing.F) {
+	f.Add(sampleMP4())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		mp4Metadata(bytes.NewReader(data), int64(len(data)))
+	})
+}
+
+func FuzzParseHEIF(f *testing.F) {
+	f.Add(buildHEIF(sampleTIFF(binary.BigEndian)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		heifMetadata(bytes.NewReader(data), int64(len(data)))
+	})
+}
@@ -0,0 +1,97 @@
+// Record search with photo/video metadata filters
+package infrastructure
+
+import (
+	"strings"
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+// likePattern tạo mẫu LIKE tìm chuỗi con s, với ký tự đặc biệt được escape bằng \
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// SearchFileRecords tìm bản ghi theo tên, loại file và metadata ảnh/video, mới
+// nhất trước. Thời điểm chụp được so sánh theo UTC vì taken_at lưu kèm múi giờ.
+func (d *Database) SearchFileRecords(q domain.RecordQuery) ([]domain.FileRecord, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, values ...interface{}) {
+		conds = append(conds, cond)
+		args = append(args, values...)
+	}
+	if q.Name != "" {
+		p := likePattern(q.Name)
+		add(`(original_name LIKE ? ESCAPE '\' OR new_name LIKE ? ESCAPE '\')`, p, p)
+	}
+	if q.Camera != "" {
+		p := likePattern(q.Camera)
+		add(`(m.camera_make LIKE ? ESCAPE '\' OR m.camera_model LIKE ? ESCAPE '\')`, p, p)
+	}
+	if !q.TakenFrom.IsZero() {
+		add("datetime(m.taken_at) >= ?", q.TakenFrom.UTC().Format(time.DateTime))
+	}
+	if !q.TakenTo.IsZero() {
+		add("datetime(m.taken_at) < ?", q.TakenTo.UTC().Format(time.DateTime))
+	}
+	if q.MinWidth > 0 {
+		add("m.width >= ?", q.MinWidth)
+	}
+	if q.MinHeight > 0 {
+		add("m.height >= ?", q.MinHeight)
+	}
+	if q.MinDuration > 0 {
+		add("m.duration >= ?", q.MinDuration)
+	}
+	if q.MaxDuration > 0 {
+		add("m.duration <= ?", q.MaxDuration)
+	}
+	if q.MimeType != "" {
+		if strings.HasSuffix(q.MimeType, "/") {
+			add("mime_type LIKE ? ESCAPE '\\'", likePattern(q.MimeType)[1:])
+		} else {
+			add("mime_type = ?", q.MimeType)
+		}
+	}
+	if q.Extension != "" {
+		add("extension = ?", strings.ToLower(q.Extension))
+	}
+	if q.Success != nil {
+		add("success = ?", *q.Success)
+	}
+	if q.ExtMismatch {
+		add("ext_mismatch")
+	}
+	if q.HasMetadata {
+		add("m.record_id IS NOT NULL")
+	}
+
+	query := "SELECT " + fileRecordColumns + " FROM " + fileRecordTables
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// LIMIT âm là không giới hạn trong SQLite
+	if q.Limit <= 0 {
+		q.Limit = -1
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []domain.FileRecord{}
+	for rows.Next() {
+		r, err := scanFileRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,307 @@
+// Minimal Prometheus metrics (text exposition format) for auto-rename
+package infrastructure
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets là các mốc histogram (giây) dùng chung, giống client Prometheus
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricCollector ghi một metric family theo định dạng text của Prometheus
+type metricCollector interface {
+	name() string
+	writeTo(w *bufio.Writer)
+}
+
+// MetricsRegistry giữ các metric của ứng dụng và xuất chúng cho /metrics
+type MetricsRegistry struct {
+	mu         sync.Mutex
+	collectors []metricCollector
+}
+
+// Metrics là registry dùng chung của ứng dụng
+var Metrics = NewMetricsRegistry()
+
+// NewMetricsRegistry tạo registry rỗng
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{}
+}
+
+func (r *MetricsRegistry) register(c metricCollector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("metrics: duplicate metric " + c.name())
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText xuất mọi metric theo thứ tự tên
+func (r *MetricsRegistry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]metricCollector(nil), r.collectors...)
+	r.mu.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.writeTo(bw)
+	}
+	return bw.Flush()
+}
+
+// labelSet lưu giá trị nhãn của một series; key nối các giá trị để tra map
+type labelSet struct {
+	key    string
+	values []string
+}
+
+func newLabelSet(names, values []string) labelSet {
+	if len(values) != len(names) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(names), len(values)))
+	}
+	return labelSet{key: strings.Join(values, "\xff"), values: append([]string(nil), values...)}
+}
+
+// formatLabels tạo chuỗi {a="x",b="y"}; extra là cặp nhãn thêm vào cuối (vd. le)
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", n, escapeLabel(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra[i], escapeLabel(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escape giá trị nhãn theo định dạng text của Prometheus
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(strings.ToValidUTF8(v, "?"))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sortedSeries trả về key của map theo thứ tự để output ổn định
+func sortedSeries[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec là counter có nhãn
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+	mu         sync.Mutex
+	series     map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels labelSet
+	value  float64
+}
+
+// NewCounterVec đăng ký một counter mới
+func (r *MetricsRegistry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metricName: name, help: help, labels: labels, series: make(map[string]*counterSeries)}
+	r.register(c)
+	return c
+}
+
+// Add cộng delta (>= 0) vào series có các giá trị nhãn cho trước
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	ls := newLabelSet(c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[ls.key]
+	if !ok {
+		s = &counterSeries{labels: ls}
+		c.series[ls.key] = s
+	}
+	s.value += delta
+}
+
+// Inc tăng series lên 1
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+
+func (c *CounterVec) writeTo(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.metricName, c.help, "counter")
+	for _, k := range sortedSeries(c.series) {
+		s := c.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labels, s.labels.values), formatFloat(s.value))
+	}
+}
+
+// GaugeVec là gauge có nhãn
+type GaugeVec struct {
+	metricName string
+	help       string
+	labels     []string
+	mu         sync.Mutex
+	series     map[string]*counterSeries
+}
+
+// NewGaugeVec đăng ký một gauge mới
+func (r *MetricsRegistry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{metricName: name, help: help, labels: labels, series: make(map[string]*counterSeries)}
+	r.register(g)
+	return g
+}
+
+// Set gán giá trị cho series
+func (g *GaugeVec) Set(value float64, values ...string) {
+	ls := newLabelSet(g.labels, values)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.series[ls.key]
+	if !ok {
+		s = &counterSeries{labels: ls}
+		g.series[ls.key] = s
+	}
+	s.value = value
+}
+
+func (g *GaugeVec) name() string { return g.metricName }
+
+func (g *GaugeVec) writeTo(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeHeader(w, g.metricName, g.help, "gauge")
+	for _, k := range sortedSeries(g.series) {
+		s := g.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, formatLabels(g.labels, s.labels.values), formatFloat(s.value))
+	}
+}
+
+// gaugeFunc là gauge không nhãn, giá trị được đọc lúc scrape
+type gaugeFunc struct {
+	metricName string
+	help       string
+	fn         func() (float64, bool)
+}
+
+// NewGaugeFunc đăng ký gauge đọc giá trị từ fn mỗi lần scrape; fn trả về false
+// khi không lấy được giá trị, khi đó series bị bỏ qua
+func (r *MetricsRegistry) NewGaugeFunc(name, help string, fn func() (float64, bool)) {
+	r.register(&gaugeFunc{metricName: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) name() string { return g.metricName }
+
+func (g *gaugeFunc) writeTo(w *bufio.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	if v, ok := g.fn(); ok {
+		fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(v))
+	}
+}
+
+// HistogramVec là histogram có nhãn
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels labelSet
+	counts []uint64 // số quan sát <= buckets[i] (chưa cộng dồn)
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec đăng ký một histogram mới; buckets phải tăng dần
+func (r *MetricsRegistry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{metricName: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.register(h)
+	return h
+}
+
+// Observe ghi một quan sát vào series
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	ls := newLabelSet(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[ls.key]
+	if !ok {
+		s = &histogramSeries{labels: ls, counts: make([]uint64, len(h.buckets))}
+		h.series[ls.key] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+
+func (h *HistogramVec) writeTo(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.metricName, h.help, "histogram")
+	for _, k := range sortedSeries(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, s.labels.values, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, s.labels.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labels, s.labels.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, s.labels.values), s.count)
+	}
+}
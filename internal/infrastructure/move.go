@@ -0,0 +1,195 @@
+// Moving files, with a copy fallback across file systems
+package infrastructure
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Cách file được chuyển, lưu vào cột move_strategy của bản ghi
+const (
+	MoveRename = "rename"
+	MoveCopy   = "copy"
+)
+
+// ErrTargetExists báo đích đổi tên đã tồn tại; file ở đích không bị ghi đè
+var ErrTargetExists = errors.New("target already exists")
+
+// renameFile và copyContent là các bước của MoveFile, thay được trong test để
+// giả lập EXDEV hoặc bản sao hỏng
+var (
+	renameFile  = renameNoReplace
+	copyContent = copyFile
+)
+
+func targetExists(path string) error {
+	return fmt.Errorf("%w: %s", ErrTargetExists, path)
+}
+
+// MoveFile chuyển file mà không bao giờ ghi đè đích đã có (lỗi ErrTargetExists);
+// khi đích nằm trên file system khác (EXDEV) thì sao chép, kiểm tra rồi xóa
+// file nguồn. Trả về cách đã dùng.
+func MoveFile(oldPath, newPath string) (string, error) {
+	err := renameFile(oldPath, newPath)
+	if err == nil {
+		return MoveRename, nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return MoveRename, err
+	}
+	return MoveCopy, copyVerifyDelete(oldPath, newPath)
+}
+
+// copyVerifyDelete sao chép file sang file tạm cạnh đích với fsync, so kích
+// thước và SHA-256, giữ quyền, thời gian và xattr, đổi tên file tạm thành đích
+// rồi mới xóa nguồn. Lỗi ở bất kỳ bước nào đều xóa bản sao dở dang và giữ nguyên nguồn.
+func copyVerifyDelete(oldPath, newPath string) (err error) {
+	info, err := os.Lstat(oldPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("cross-device move of %s: not a regular file", oldPath)
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return fmt.Errorf("cross-device move: %w", targetExists(newPath))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(newPath), "."+filepath.Base(newPath)+".partial-*")
+	if err != nil {
+		return fmt.Errorf("cross-device move: %w", err)
+	}
+	tmpPath := tmp.Name()
+	placed := false
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			if placed {
+				os.Remove(newPath)
+			}
+		}
+	}()
+
+	srcSum, err := copyContent(tmp, oldPath)
+	if err != nil {
+		return fmt.Errorf("cross-device copy: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("cross-device copy: fsync: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("cross-device copy: %w", err)
+	}
+	if err = verifyCopy(tmpPath, info.Size(), srcSum); err != nil {
+		return err
+	}
+	if err = copyAttributes(oldPath, tmpPath, info); err != nil {
+		return fmt.Errorf("cross-device copy: %w", err)
+	}
+
+	if err = renameFile(tmpPath, newPath); err != nil {
+		return fmt.Errorf("cross-device move: %w", err)
+	}
+	placed = true
+	if err = syncDir(filepath.Dir(newPath)); err != nil {
+		return fmt.Errorf("cross-device move: fsync dir: %w", err)
+	}
+	if err = os.Remove(oldPath); err != nil {
+		return fmt.Errorf("cross-device move: remove source: %w", err)
+	}
+	return nil
+}
+
+// renameNoReplace đổi tên như os.Rename nhưng trả về ErrTargetExists thay vì
+// ghi đè đích. Trên Linux dùng renameat2(RENAME_NOREPLACE); khi kernel hoặc file
+// system không hỗ trợ thì tạo hard link (thất bại nguyên tử nếu đích đã có) rồi
+// xóa tên cũ. File system không có hard link chỉ còn cách kiểm tra rồi đổi tên.
+func renameNoReplace(oldPath, newPath string) error {
+	if ok, err := renameat2NoReplace(oldPath, newPath); ok {
+		return err
+	}
+	err := os.Link(oldPath, newPath)
+	switch {
+	case err == nil:
+		if err := os.Remove(oldPath); err != nil {
+			os.Remove(newPath)
+			return err
+		}
+		return nil
+	case errors.Is(err, fs.ErrExist):
+		return targetExists(newPath)
+	case errors.Is(err, syscall.EXDEV):
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EXDEV}
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return targetExists(newPath)
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// copyFile chép nội dung file nguồn vào dst, trả về SHA-256 của dữ liệu đã đọc
+func copyFile(dst *os.File, srcPath string) ([]byte, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	h := sha256.New()
+	if _, err := io.Copy(dst, io.TeeReader(src, h)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyCopy đọc lại bản sao từ đĩa và so kích thước, SHA-256 với file nguồn
+func verifyCopy(path string, size int64, sum []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("cross-device copy: verify: %w", err)
+	}
+	if n != size {
+		return fmt.Errorf("cross-device copy: size mismatch, copied %d of %d bytes", n, size)
+	}
+	if !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("cross-device copy: checksum mismatch")
+	}
+	return nil
+}
+
+// copyAttributes giữ quyền, thời gian truy cập/sửa và xattr của file nguồn
+func copyAttributes(src, dst string, info os.FileInfo) error {
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, accessTime(info), info.ModTime())
+}
+
+// syncDir fsync thư mục để mục mới trong thư mục được ghi xuống đĩa
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
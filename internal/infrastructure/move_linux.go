@@ -0,0 +1,74 @@
+//go:build linux
+
+package infrastructure
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameat2NoReplace đổi tên bằng renameat2(RENAME_NOREPLACE). ok false khi
+// kernel (ENOSYS) hoặc file system (EINVAL) không hỗ trợ cờ này.
+func renameat2NoReplace(oldPath, newPath string) (ok bool, err error) {
+	err = unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_NOREPLACE)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EINVAL):
+		return false, nil
+	case errors.Is(err, unix.EEXIST):
+		return true, targetExists(newPath)
+	}
+	return true, &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+}
+
+// accessTime lấy atime từ stat của file nguồn
+func accessTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Unix())
+	}
+	return info.ModTime()
+}
+
+// copyXattrs chép extended attribute của src sang dst. File system đích không
+// hỗ trợ xattr, hoặc namespace cần quyền root (security., trusted.), được bỏ qua.
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil || size == 0 {
+		if err != nil && !ignorableXattrError(err) {
+			return err
+		}
+		return nil
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(src, buf)
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		n, err := syscall.Getxattr(src, name, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(src, name, value); err != nil {
+			return err
+		}
+		if err := syscall.Setxattr(dst, name, value[:n], 0); err != nil && !ignorableXattrError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func ignorableXattrError(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package infrastructure
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime trả về mtime vì atime không có sẵn trên mọi hệ điều hành
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// renameat2NoReplace không có ngoài Linux; renameNoReplace dùng hard link thay thế
+func renameat2NoReplace(oldPath, newPath string) (ok bool, err error) {
+	return false, nil
+}
+
+// copyXattrs không làm gì: xattr chỉ được giữ trên Linux
+func copyXattrs(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,170 @@
+package infrastructure
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// crossDevice làm MoveFile gặp EXDEV khi đổi tên src, như khi đích ở mount khác
+func crossDevice(t *testing.T, src string) {
+	t.Helper()
+	old := renameFile
+	renameFile = func(oldPath, newPath string) error {
+		if oldPath == src {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EXDEV}
+		}
+		return old(oldPath, newPath)
+	}
+	t.Cleanup(func() { renameFile = old })
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertOnly kiểm tra thư mục chỉ còn các file names với đúng nội dung
+func assertOnly(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != len(files) {
+		t.Errorf("%s has %v, want %d files", dir, names, len(files))
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFile(t, src, "data")
+
+	strategy, err := MoveFile(src, dst)
+	if err != nil || strategy != MoveRename {
+		t.Fatalf("MoveFile = %s, %v, want %s", strategy, err, MoveRename)
+	}
+	assertOnly(t, dir, map[string]string{"b.txt": "data"})
+
+	// Đích đã có thì không ghi đè
+	writeFile(t, src, "new")
+	if _, err := MoveFile(src, dst); !errors.Is(err, ErrTargetExists) {
+		t.Errorf("MoveFile onto existing file = %v, want ErrTargetExists", err)
+	}
+	assertOnly(t, dir, map[string]string{"a.txt": "new", "b.txt": "data"})
+}
+
+func TestMoveFileCrossDevice(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	src, dst := filepath.Join(srcDir, "a.txt"), filepath.Join(dstDir, "b.txt")
+	writeFile(t, src, "cross-device data")
+	modTime := time.Date(2020, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	crossDevice(t, src)
+
+	strategy, err := MoveFile(src, dst)
+	if err != nil || strategy != MoveCopy {
+		t.Fatalf("MoveFile = %s, %v, want %s", strategy, err, MoveCopy)
+	}
+	assertOnly(t, srcDir, map[string]string{})
+	assertOnly(t, dstDir, map[string]string{"b.txt": "cross-device data"})
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 || !info.ModTime().Equal(modTime) {
+		t.Errorf("copy has mode %v and mod time %v, want %v and %v", info.Mode().Perm(), info.ModTime(), os.FileMode(0o640), modTime)
+	}
+
+	// Đích đã có thì không sao chép
+	writeFile(t, src, "new")
+	if _, err := MoveFile(src, dst); !errors.Is(err, ErrTargetExists) {
+		t.Errorf("cross-device move onto existing file = %v, want ErrTargetExists", err)
+	}
+	assertOnly(t, dstDir, map[string]string{"b.txt": "cross-device data"})
+}
+
+func TestMoveFileCrossDeviceFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// copy thay copyContent; nil là sao chép bình thường
+		copy func(dst *os.File, srcPath string) ([]byte, error)
+		// placeFails làm bước đổi tên file tạm thành đích thất bại
+		placeFails bool
+		want       string
+	}{
+		{"checksum mismatch", func(dst *os.File, srcPath string) ([]byte, error) {
+			sum, err := copyFile(dst, srcPath)
+			if err == nil {
+				_, err = dst.WriteAt([]byte("X"), 0)
+			}
+			return sum, err
+		}, false, "checksum mismatch"},
+		{"short copy", func(dst *os.File, srcPath string) ([]byte, error) {
+			sum, err := copyFile(dst, srcPath)
+			if err == nil {
+				err = dst.Truncate(3)
+			}
+			return sum, err
+		}, false, "size mismatch"},
+		{"read error after partial copy", func(dst *os.File, srcPath string) ([]byte, error) {
+			if _, err := dst.WriteString("part"); err != nil {
+				return nil, err
+			}
+			return nil, syscall.EIO
+		}, false, "input/output error"},
+		{"target taken before the copy is placed", nil, true, ErrTargetExists.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir, dstDir := t.TempDir(), t.TempDir()
+			src, dst := filepath.Join(srcDir, "a.txt"), filepath.Join(dstDir, "b.txt")
+			writeFile(t, src, "cross-device data")
+			crossDevice(t, src)
+			if tt.copy != nil {
+				old := copyContent
+				copyContent = tt.copy
+				t.Cleanup(func() { copyContent = old })
+			}
+			if tt.placeFails {
+				old := renameFile
+				renameFile = func(oldPath, newPath string) error {
+					if strings.Contains(filepath.Base(oldPath), ".partial-") {
+						return targetExists(newPath)
+					}
+					return old(oldPath, newPath)
+				}
+				t.Cleanup(func() { renameFile = old })
+			}
+
+			_, err := MoveFile(src, dst)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("MoveFile = %v, want error %q", err, tt.want)
+			}
+			// Nguồn giữ nguyên, không còn bản sao dở dang
+			assertOnly(t, srcDir, map[string]string{"a.txt": "cross-device data"})
+			assertOnly(t, dstDir, map[string]string{})
+		})
+	}
+}
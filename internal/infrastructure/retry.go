@@ -0,0 +1,77 @@
+// Rename retry queue storage for auto-rename
+package infrastructure
+
+import (
+	"auto-rename/internal/domain"
+)
+
+const retryColumns = "id, path, root, original_name, status, attempts, last_error, created_at, updated_at, next_attempt_at"
+
+// ScheduleRenameRetry đưa file vào hàng đợi thử lại. Nếu path đã có lượt thử
+// đang chờ thì lượt đó được cập nhật số lần thử, lỗi và thời điểm thử tiếp.
+func (d *Database) ScheduleRenameRetry(r domain.RenameRetry) (domain.RenameRetry, error) {
+	return scanRenameRetry(d.db.QueryRow(
+		`INSERT INTO rename_retries (path, root, original_name, status, attempts, last_error, created_at, updated_at, next_attempt_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(path) WHERE status = 'pending' DO UPDATE SET
+    root = excluded.root, attempts = excluded.attempts, last_error = excluded.last_error,
+    updated_at = excluded.updated_at, next_attempt_at = excluded.next_attempt_at
+RETURNING `+retryColumns,
+		r.Path, r.Root, r.OriginalName, domain.RetryStatusPending, r.Attempts, r.LastError, r.CreatedAt, r.UpdatedAt, r.NextAttemptAt,
+	))
+}
+
+// HasPendingRenameRetry kiểm tra path có lượt thử lại đang chờ
+func (d *Database) HasPendingRenameRetry(path string) (bool, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM rename_retries WHERE path = ? AND status = ?", path, domain.RetryStatusPending).Scan(&count)
+	return count > 0, err
+}
+
+// UpdateRenameRetry ghi kết quả lần thử gần nhất
+func (d *Database) UpdateRenameRetry(r domain.RenameRetry) error {
+	_, err := d.db.Exec(
+		"UPDATE rename_retries SET status = ?, attempts = ?, last_error = ?, updated_at = ?, next_attempt_at = ? WHERE id = ?",
+		r.Status, r.Attempts, r.LastError, r.UpdatedAt, r.NextAttemptAt, r.ID,
+	)
+	return err
+}
+
+// GetDueRenameRetries lấy tối đa limit lượt thử đang chờ đã tới hạn, sớm nhất trước
+func (d *Database) GetDueRenameRetries(now string, limit int) ([]domain.RenameRetry, error) {
+	return d.queryRenameRetries(
+		"SELECT "+retryColumns+" FROM rename_retries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?",
+		domain.RetryStatusPending, now, limit,
+	)
+}
+
+// GetRenameRetries lấy các lượt thử mới cập nhật nhất, lọc theo trạng thái (rỗng = tất cả)
+func (d *Database) GetRenameRetries(status string, limit int) ([]domain.RenameRetry, error) {
+	return d.queryRenameRetries(
+		"SELECT "+retryColumns+" FROM rename_retries WHERE (? = '' OR status = ?) ORDER BY updated_at DESC, id DESC LIMIT ?",
+		status, status, limit,
+	)
+}
+
+func (d *Database) queryRenameRetries(query string, args ...interface{}) ([]domain.RenameRetry, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	retries := []domain.RenameRetry{}
+	for rows.Next() {
+		r, err := scanRenameRetry(rows)
+		if err != nil {
+			return nil, err
+		}
+		retries = append(retries, r)
+	}
+	return retries, rows.Err()
+}
+
+func scanRenameRetry(row rowScanner) (domain.RenameRetry, error) {
+	var r domain.RenameRetry
+	err := row.Scan(&r.ID, &r.Path, &r.Root, &r.OriginalName, &r.Status, &r.Attempts, &r.LastError, &r.CreatedAt, &r.UpdatedAt, &r.NextAttemptAt)
+	return r, err
+}
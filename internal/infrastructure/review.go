@@ -0,0 +1,135 @@
+// Review queue storage for auto-rename
+package infrastructure
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"auto-rename/internal/domain"
+)
+
+const pendingColumns = "id, path, original_name, new_name, file_size, mod_time, status, COALESCE(error_msg, ''), created_at, expires_at, COALESCE(decided_at, '')"
+
+// InsertPendingRename thêm đề xuất đổi tên; trả về false nếu path đã có đề xuất đang mở
+func (d *Database) InsertPendingRename(p domain.PendingRename) (bool, error) {
+	res, err := d.db.Exec(
+		`INSERT OR IGNORE INTO pending_renames (path, original_name, new_name, file_size, mod_time, status, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Path, p.OriginalName, p.NewName, p.FileSize, p.ModTime, domain.PendingStatusPending, p.CreatedAt, p.ExpiresAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// BlockingPendingRename trả về trạng thái của đề xuất khiến path không được đề
+// xuất lại: đang chờ duyệt hoặc chờ thực hiện, hay đã bị từ chối khi file vẫn
+// cùng kích thước và thời điểm sửa. Rỗng khi có thể đề xuất.
+func (d *Database) BlockingPendingRename(path string, size int64, modTime string) (string, error) {
+	var status string
+	err := d.db.QueryRow(
+		`SELECT status FROM pending_renames
+WHERE path = ? AND (status IN (?, ?) OR (status = ? AND file_size = ? AND mod_time = ?))
+ORDER BY id DESC LIMIT 1`,
+		path, domain.PendingStatusPending, domain.PendingStatusApproved, domain.PendingStatusRejected, size, modTime,
+	).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return status, err
+}
+
+// GetPendingRenamesPage lấy đề xuất theo trạng thái (rỗng = tất cả), mới nhất trước
+func (d *Database) GetPendingRenamesPage(status string, page, pageSize int) ([]domain.PendingRename, error) {
+	offset := (page - 1) * pageSize
+	query := "SELECT " + pendingColumns + " FROM pending_renames"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, pageSize, offset)
+	return d.queryPendingRenames(query, args...)
+}
+
+// CountPendingRenames đếm đề xuất theo trạng thái (rỗng = tất cả)
+func (d *Database) CountPendingRenames(status string) (int, error) {
+	query := "SELECT COUNT(*) FROM pending_renames"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	var count int
+	if err := d.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// DecidePendingRenames chuyển các đề xuất đang chờ sang trạng thái mới (approved/rejected)
+func (d *Database) DecidePendingRenames(ids []int, status, decidedAt string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := []interface{}{status, decidedAt}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, domain.PendingStatusPending)
+	res, err := d.db.Exec(
+		"UPDATE pending_renames SET status = ?, decided_at = ? WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+") AND status = ?",
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ExpirePendingRenames đánh dấu hết hạn các đề xuất chưa được duyệt quá expires_at
+func (d *Database) ExpirePendingRenames(now string) (int64, error) {
+	res, err := d.db.Exec(
+		"UPDATE pending_renames SET status = ?, decided_at = ? WHERE status = ? AND expires_at <= ?",
+		domain.PendingStatusExpired, now, domain.PendingStatusPending, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetApprovedRenames lấy các đề xuất đã duyệt đang chờ thực hiện, cũ nhất trước
+func (d *Database) GetApprovedRenames(limit int) ([]domain.PendingRename, error) {
+	return d.queryPendingRenames(
+		"SELECT "+pendingColumns+" FROM pending_renames WHERE status = ? ORDER BY id LIMIT ?",
+		domain.PendingStatusApproved, limit,
+	)
+}
+
+// CompletePendingRename cập nhật kết quả thực hiện một đề xuất (done/failed)
+func (d *Database) CompletePendingRename(id int, status, errorMsg string) error {
+	_, err := d.db.Exec("UPDATE pending_renames SET status = ?, error_msg = ? WHERE id = ?", status, errorMsg, id)
+	return err
+}
+
+func (d *Database) queryPendingRenames(query string, args ...interface{}) ([]domain.PendingRename, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []domain.PendingRename{}
+	for rows.Next() {
+		var p domain.PendingRename
+		if err := rows.Scan(&p.Id, &p.Path, &p.OriginalName, &p.NewName, &p.FileSize, &p.ModTime, &p.Status, &p.ErrorMsg, &p.CreatedAt, &p.ExpiresAt, &p.DecidedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, p)
+	}
+	return items, rows.Err()
+}
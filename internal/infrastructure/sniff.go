@@ -0,0 +1,231 @@
+// Content sniffing: detect the real file type from magic bytes
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffHeaderSize là số byte đầu file được đọc để nhận loại file; đủ để thấy
+// tên các entry đầu tiên của file zip (docx, odt, epub...)
+const sniffHeaderSize = 4 << 10
+
+// FileType là loại file nhận ra từ nội dung. Exts là các đuôi hợp với nội dung
+// (chữ thường, có dấu chấm), đuôi đầu tiên là đuôi chuẩn; Exts rỗng khi không
+// suy ra được đuôi (vd văn bản). MIME rỗng là không nhận ra loại file.
+type FileType struct {
+	MIME string
+	Exts []string
+}
+
+// Ext trả về đuôi chuẩn của loại file, rỗng khi không suy ra được
+func (t FileType) Ext() string {
+	if len(t.Exts) == 0 {
+		return ""
+	}
+	return t.Exts[0]
+}
+
+// MatchesExt kiểm tra đuôi ext (không phân biệt hoa thường) có hợp với nội dung;
+// luôn đúng khi không suy ra được đuôi từ nội dung
+func (t FileType) MatchesExt(ext string) bool {
+	if len(t.Exts) == 0 {
+		return true
+	}
+	ext = strings.ToLower(ext)
+	for _, e := range t.Exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// magic là chữ ký ở đầu file của một loại file
+type magic struct {
+	sig  string
+	kind FileType
+}
+
+// Các loại file có nhiều biến thể (RIFF, ISO BMFF, zip, Ogg, Matroska, BMP...)
+// được nhận trong SniffType trước khi dò bảng này
+var magics = []magic{
+	{"\xFF\xD8\xFF", FileType{"image/jpeg", []string{".jpg", ".jpeg", ".jpe", ".jfif"}}},
+	{"\x89PNG\r\n\x1A\n", FileType{"image/png", []string{".png"}}},
+	{"GIF87a", FileType{"image/gif", []string{".gif"}}},
+	{"GIF89a", FileType{"image/gif", []string{".gif"}}},
+	// RAW của nhiều hãng máy ảnh dựa trên TIFF
+	{"II*\x00", FileType{"image/tiff", []string{".tif", ".tiff", ".dng", ".nef", ".nrw", ".cr2", ".arw", ".srf", ".sr2", ".orf", ".pef", ".srw", ".3fr", ".erf", ".kdc", ".dcr", ".mos", ".raw"}}},
+	{"MM\x00*", FileType{"image/tiff", []string{".tif", ".tiff", ".dng", ".nef", ".pef", ".3fr", ".mos", ".raw"}}},
+	{"IIU\x00", FileType{"image/x-panasonic-rw2", []string{".rw2", ".raw"}}},
+	{"FUJIFILMCCD-RAW", FileType{"image/x-fuji-raf", []string{".raf"}}},
+	{"8BPS", FileType{"image/vnd.adobe.photoshop", []string{".psd", ".psb"}}},
+	{"\x00\x00\x01\x00", FileType{"image/x-icon", []string{".ico"}}},
+	{"%PDF-", FileType{"application/pdf", []string{".pdf", ".ai"}}},
+	{"{\\rtf", FileType{"application/rtf", []string{".rtf"}}},
+	{"\x1F\x8B", FileType{"application/gzip", []string{".gz", ".tgz", ".svgz"}}},
+	{"\xFD7zXZ\x00", FileType{"application/x-xz", []string{".xz", ".txz"}}},
+	{"7z\xBC\xAF\x27\x1C", FileType{"application/x-7z-compressed", []string{".7z"}}},
+	{"Rar!\x1A\x07", FileType{"application/vnd.rar", []string{".rar", ".cbr"}}},
+	{"\x28\xB5\x2F\xFD", FileType{"application/zstd", []string{".zst", ".tzst"}}},
+	{"SQLite format 3\x00", FileType{"application/vnd.sqlite3", []string{".sqlite", ".sqlite3", ".db", ".db3"}}},
+	{"fLaC", FileType{"audio/flac", []string{".flac"}}},
+	{"ID3\x02", FileType{"audio/mpeg", []string{".mp3"}}},
+	{"ID3\x03", FileType{"audio/mpeg", []string{".mp3"}}},
+	{"ID3\x04", FileType{"audio/mpeg", []string{".mp3"}}},
+	{"\xFF\xFB", FileType{"audio/mpeg", []string{".mp3"}}},
+	{"\xFF\xF3", FileType{"audio/mpeg", []string{".mp3"}}},
+	{"\xFF\xF2", FileType{"audio/mpeg", []string{".mp3"}}},
+	{"MThd", FileType{"audio/midi", []string{".mid", ".midi"}}},
+	{"FLV\x01", FileType{"video/x-flv", []string{".flv"}}},
+	{"\x00\x00\x01\xBA", FileType{"video/mpeg", []string{".mpg", ".mpeg", ".vob"}}},
+	{"\x30\x26\xB2\x75\x8E\x66\xCF\x11", FileType{"video/x-ms-asf", []string{".wmv", ".wma", ".asf"}}},
+	{"wOFF", FileType{"font/woff", []string{".woff"}}},
+	{"wOF2", FileType{"font/woff2", []string{".woff2"}}},
+	// File thực thi không có đuôi chuẩn
+	{"\x7FELF", FileType{"application/x-elf", nil}},
+}
+
+// zipExts là các định dạng dựa trên zip, dùng khi không nhận ra định dạng cụ thể
+var zipExts = []string{".zip", ".docx", ".docm", ".dotx", ".xlsx", ".xlsm", ".pptx", ".pptm",
+	".odt", ".ods", ".odp", ".odg", ".epub", ".jar", ".war", ".apk", ".aab", ".ipa", ".xpi",
+	".cbz", ".whl", ".kmz", ".vsix", ".nupkg"}
+
+// zipMimeTypes là định dạng zip ghi loại file trong entry "mimetype" đầu tiên
+// (ODF, EPUB). Đuôi .zip vẫn hợp với mọi định dạng dựa trên zip.
+var zipMimeTypes = map[string][]string{
+	"application/epub+zip":                            {".epub", ".zip"},
+	"application/vnd.oasis.opendocument.text":         {".odt", ".zip"},
+	"application/vnd.oasis.opendocument.spreadsheet":  {".ods", ".zip"},
+	"application/vnd.oasis.opendocument.presentation": {".odp", ".zip"},
+	"application/vnd.oasis.opendocument.graphics":     {".odg", ".zip"},
+}
+
+// SniffFile đọc phần đầu file và nhận loại file từ nội dung
+func SniffFile(path string) (FileType, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileType{}, err
+	}
+	defer f.Close()
+	buf := make([]byte, sniffHeaderSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FileType{}, err
+	}
+	return SniffType(buf[:n]), nil
+}
+
+// SniffType nhận loại file từ các byte đầu file bằng chữ ký (magic bytes). Văn
+// bản (text, HTML, XML...) chỉ có MIME theo http.DetectContentType; chữ ký nhị
+// phân của http.DetectContentType thì bỏ qua vì có loại quá ngắn ("BM").
+func SniffType(data []byte) FileType {
+	if len(data) == 0 {
+		return FileType{}
+	}
+	if t, ok := sniffContainer(data); ok {
+		return t
+	}
+	for _, m := range magics {
+		if bytes.HasPrefix(data, []byte(m.sig)) {
+			return m.kind
+		}
+	}
+	mime, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if !strings.HasPrefix(mime, "text/") {
+		return FileType{}
+	}
+	return FileType{MIME: mime}
+}
+
+// sniffContainer nhận các định dạng cần đọc thêm sau chữ ký chung
+func sniffContainer(data []byte) (FileType, bool) {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF":
+		switch string(data[8:12]) {
+		case "WEBP":
+			return FileType{"image/webp", []string{".webp"}}, true
+		case "WAVE":
+			return FileType{"audio/wav", []string{".wav"}}, true
+		case "AVI ":
+			return FileType{"video/x-msvideo", []string{".avi"}}, true
+		}
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return sniffFtyp(string(data[8:12])), true
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return sniffZip(data), true
+	case bytes.HasPrefix(data, []byte("OggS")):
+		if bytes.Contains(data[:min(len(data), 64)], []byte("\x80theora")) {
+			return FileType{"video/ogg", []string{".ogv", ".ogg"}}, true
+		}
+		return FileType{"audio/ogg", []string{".ogg", ".oga", ".opus", ".spx"}}, true
+	case bytes.HasPrefix(data, []byte("\x1A\x45\xDF\xA3")):
+		if bytes.Contains(data[:min(len(data), 64)], []byte("webm")) {
+			return FileType{"video/webm", []string{".webm"}}, true
+		}
+		return FileType{"video/x-matroska", []string{".mkv", ".mka", ".mks", ".mk3d"}}, true
+	case len(data) >= 18 && string(data[:2]) == "BM":
+		// "BM" quá ngắn, phải kiểm tra thêm kích thước DIB header
+		switch binary.LittleEndian.Uint32(data[14:18]) {
+		case 12, 40, 52, 56, 64, 108, 124:
+			return FileType{"image/bmp", []string{".bmp", ".dib"}}, true
+		}
+	case len(data) >= 10 && string(data[:3]) == "BZh" && string(data[4:10]) == "1AY&SY":
+		return FileType{"application/x-bzip2", []string{".bz2", ".tbz2", ".tbz"}}, true
+	}
+	return FileType{}, false
+}
+
+// sniffFtyp nhận định dạng ISO base media (MP4, MOV, HEIC...) theo major brand
+func sniffFtyp(brand string) FileType {
+	switch brand {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis", "hevm", "hevs":
+		return FileType{"image/heic", []string{".heic", ".heif"}}
+	case "mif1", "msf1":
+		return FileType{"image/heif", []string{".heif", ".heic", ".avif"}}
+	case "avif", "avis":
+		return FileType{"image/avif", []string{".avif"}}
+	case "crx ":
+		return FileType{"image/x-canon-cr3", []string{".cr3"}}
+	case "qt  ":
+		return FileType{"video/quicktime", []string{".mov", ".qt"}}
+	case "M4A ", "M4B ", "M4P ":
+		return FileType{"audio/mp4", []string{".m4a", ".m4b", ".m4p", ".mp4"}}
+	}
+	if strings.HasPrefix(brand, "3g2") {
+		return FileType{"video/3gpp2", []string{".3g2", ".3gp"}}
+	}
+	if strings.HasPrefix(brand, "3gp") {
+		return FileType{"video/3gpp", []string{".3gp", ".3g2"}}
+	}
+	return FileType{"video/mp4", []string{".mp4", ".m4v", ".m4a", ".mov"}}
+}
+
+// sniffZip phân biệt ODF/EPUB (entry "mimetype" đầu tiên) và Office Open XML
+// (thư mục word/, xl/, ppt/) với file zip thường
+func sniffZip(data []byte) FileType {
+	const nameOffset = 30
+	if len(data) > nameOffset+8 && string(data[nameOffset:nameOffset+8]) == "mimetype" {
+		rest := data[nameOffset+8:]
+		for mime, exts := range zipMimeTypes {
+			if bytes.HasPrefix(rest, []byte(mime)) {
+				return FileType{mime, exts}
+			}
+		}
+	}
+	if bytes.Contains(data, []byte("[Content_Types].xml")) {
+		switch {
+		case bytes.Contains(data, []byte("word/")):
+			return FileType{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", []string{".docx", ".docm", ".dotx", ".dotm", ".zip"}}
+		case bytes.Contains(data, []byte("xl/")):
+			return FileType{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []string{".xlsx", ".xlsm", ".xltx", ".xltm", ".zip"}}
+		case bytes.Contains(data, []byte("ppt/")):
+			return FileType{"application/vnd.openxmlformats-officedocument.presentationml.presentation", []string{".pptx", ".pptm", ".potx", ".ppsx", ".zip"}}
+		}
+	}
+	return FileType{"application/zip", zipExts}
+}
@@ -0,0 +1,115 @@
+// Aggregate statistics over file_records
+package infrastructure
+
+import (
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+// recordDirSQL là thư mục gốc của file trước khi đổi tên (không phải thư mục
+// shard khi có layout); bản ghi cũ không có old_path dùng file_path
+const recordDirSQL = "CASE WHEN old_path = '' THEN file_path ELSE rtrim(rtrim(old_path, replace(old_path, '/', '')), '/') END"
+
+// GetStats tính thống kê bằng truy vấn gộp trên file_records. renamed_at lưu theo
+// RFC3339 UTC nên được so sánh trực tiếp với mốc cùng định dạng để dùng được
+// idx_file_records_renamed_at.
+func (d *Database) GetStats(q domain.StatsQuery) (domain.Stats, error) {
+	stats := domain.Stats{
+		To:             q.To.UTC().Format(time.RFC3339),
+		Interval:       q.Interval,
+		FailuresByType: []domain.StatCount{},
+		ByExtension:    []domain.StatCount{},
+		ByDirectory:    []domain.StatCount{},
+		Series:         []domain.StatsPoint{},
+	}
+	where := " WHERE renamed_at < ?"
+	args := []interface{}{stats.To}
+	if !q.From.IsZero() {
+		stats.From = q.From.UTC().Format(time.RFC3339)
+		where = " WHERE renamed_at >= ? AND renamed_at < ?"
+		args = []interface{}{stats.From, stats.To}
+	}
+
+	err := d.db.QueryRow(
+		`SELECT COUNT(*),
+       COALESCE(SUM(CASE WHEN success THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN success THEN file_size ELSE 0 END), 0)
+FROM file_records`+where, args...,
+	).Scan(&stats.TotalRecords, &stats.SuccessfulRenames, &stats.BytesProcessed)
+	if err != nil {
+		return stats, err
+	}
+	stats.FailedRenames = stats.TotalRecords - stats.SuccessfulRenames
+	if stats.TotalRecords > 0 {
+		stats.SuccessRate = float64(stats.SuccessfulRenames) / float64(stats.TotalRecords)
+	}
+
+	recentFrom := q.To.Add(-24 * time.Hour).UTC().Format(time.RFC3339)
+	if err := d.db.QueryRow(
+		"SELECT COUNT(*) FROM file_records WHERE renamed_at >= ? AND renamed_at < ?",
+		recentFrom, stats.To,
+	).Scan(&stats.RecentActivity); err != nil {
+		return stats, err
+	}
+
+	if stats.FailuresByType, err = d.statCounts(
+		"SELECT error_type, COUNT(*), COALESCE(SUM(file_size), 0) FROM file_records"+where+
+			" AND NOT success GROUP BY error_type ORDER BY COUNT(*) DESC", args...,
+	); err != nil {
+		return stats, err
+	}
+	if stats.ByExtension, err = d.statCounts(
+		"SELECT extension, COUNT(*), COALESCE(SUM(file_size), 0) FROM file_records"+where+
+			" GROUP BY extension ORDER BY COUNT(*) DESC, extension LIMIT ?", append(args, q.Limit)...,
+	); err != nil {
+		return stats, err
+	}
+	if stats.ByDirectory, err = d.statCounts(
+		"SELECT "+recordDirSQL+" AS dir, COUNT(*), COALESCE(SUM(file_size), 0) FROM file_records"+where+
+			" GROUP BY dir ORDER BY COUNT(*) DESC, dir LIMIT ?", append(args, q.Limit)...,
+	); err != nil {
+		return stats, err
+	}
+
+	bucket := "%Y-%m-%dT%H:00:00Z"
+	if q.Interval == domain.StatsIntervalDay {
+		bucket = "%Y-%m-%dT00:00:00Z"
+	}
+	rows, err := d.db.Query(
+		`SELECT strftime('`+bucket+`', renamed_at) AS bucket,
+       SUM(CASE WHEN success THEN 1 ELSE 0 END),
+       SUM(CASE WHEN success THEN 0 ELSE 1 END)
+FROM file_records`+where+` AND bucket IS NOT NULL GROUP BY bucket ORDER BY bucket`, args...,
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p domain.StatsPoint
+		if err := rows.Scan(&p.Time, &p.Renamed, &p.Failed); err != nil {
+			return stats, err
+		}
+		stats.Series = append(stats.Series, p)
+	}
+	return stats, rows.Err()
+}
+
+// statCounts đọc các dòng (key, count, bytes) của một truy vấn GROUP BY
+func (d *Database) statCounts(query string, args ...interface{}) ([]domain.StatCount, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := []domain.StatCount{}
+	for rows.Next() {
+		var c domain.StatCount
+		if err := rows.Scan(&c.Key, &c.Count, &c.Bytes); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
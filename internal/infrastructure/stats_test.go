@@ -0,0 +1,104 @@
+package infrastructure
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"auto-rename/internal/domain"
+)
+
+func TestGetStats(t *testing.T) {
+	d, err := NewDatabase(filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	// Với layout, file ở /in/photos được chuyển vào thư mục shard /out/ab
+	records := []domain.FileRecord{
+		{OriginalName: "a.jpg", FilePath: "/out/ab", OldPath: "/in/photos/a.jpg", FileSize: 10, Success: true, Extension: ".jpg", RenamedAt: "2026-03-01T10:15:00Z"},
+		{OriginalName: "b.jpg", FilePath: "/out/cd", OldPath: "/in/photos/b.jpg", FileSize: 20, Success: true, Extension: ".jpg", RenamedAt: "2026-03-01T10:45:00Z"},
+		{OriginalName: "c.txt", FilePath: "/in/docs", OldPath: "/in/docs/c.txt", FileSize: 5, Extension: ".txt", ErrorType: domain.ErrorTypeRename, RenamedAt: "2026-03-01T11:00:00Z"},
+		// Bản ghi cũ không có old_path
+		{OriginalName: "d.txt", FilePath: "/in/legacy", FileSize: 1, Success: true, Extension: ".txt", RenamedAt: "2026-03-02T09:00:00Z"},
+		// Ngoài khoảng hỏi
+		{OriginalName: "e.txt", FilePath: "/in/docs", OldPath: "/in/docs/e.txt", FileSize: 100, Success: true, Extension: ".txt", RenamedAt: "2026-02-01T00:00:00Z"},
+		{OriginalName: "f.txt", FilePath: "/in/docs", OldPath: "/in/docs/f.txt", FileSize: 100, Success: true, Extension: ".txt", RenamedAt: "2026-03-03T00:00:00Z"},
+	}
+	if err := d.InsertFileRecords(records); err != nil {
+		t.Fatalf("InsertFileRecords: %v", err)
+	}
+
+	q := domain.StatsQuery{
+		// Mốc ở múi giờ khác vẫn được so sánh theo UTC
+		From:     time.Date(2026, 3, 1, 17, 0, 0, 0, time.FixedZone("ICT", 7*3600)),
+		To:       time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC),
+		Interval: domain.StatsIntervalHour,
+		Limit:    10,
+	}
+	stats, err := d.GetStats(q)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.From != "2026-03-01T10:00:00Z" || stats.To != "2026-03-03T00:00:00Z" {
+		t.Errorf("range = %s .. %s", stats.From, stats.To)
+	}
+	if stats.TotalRecords != 4 || stats.SuccessfulRenames != 3 || stats.FailedRenames != 1 || stats.BytesProcessed != 31 {
+		t.Errorf("totals = %d records, %d renamed, %d failed, %d bytes, want 4, 3, 1, 31",
+			stats.TotalRecords, stats.SuccessfulRenames, stats.FailedRenames, stats.BytesProcessed)
+	}
+	if stats.RecentActivity != 1 {
+		t.Errorf("recent activity = %d, want 1", stats.RecentActivity)
+	}
+	wantDirs := []domain.StatCount{{Key: "/in/photos", Count: 2, Bytes: 30}, {Key: "/in/docs", Count: 1, Bytes: 5}, {Key: "/in/legacy", Count: 1, Bytes: 1}}
+	if !reflect.DeepEqual(stats.ByDirectory, wantDirs) {
+		t.Errorf("by directory = %+v, want %+v", stats.ByDirectory, wantDirs)
+	}
+	wantSeries := []domain.StatsPoint{
+		{Time: "2026-03-01T10:00:00Z", Renamed: 2},
+		{Time: "2026-03-01T11:00:00Z", Failed: 1},
+		{Time: "2026-03-02T09:00:00Z", Renamed: 1},
+	}
+	if !reflect.DeepEqual(stats.Series, wantSeries) {
+		t.Errorf("series = %+v, want %+v", stats.Series, wantSeries)
+	}
+
+	// Không có From thì tính từ đầu
+	all, err := d.GetStats(domain.StatsQuery{To: q.To, Interval: domain.StatsIntervalDay, Limit: 10})
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if all.TotalRecords != 5 || all.From != "" {
+		t.Errorf("stats without from = %d records from %q, want 5 from the start", all.TotalRecords, all.From)
+	}
+}
+
+func TestGetStatsUsesRenamedAtIndex(t *testing.T) {
+	d, err := NewDatabase(filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	for _, where := range []string{"renamed_at < ?", "renamed_at >= ? AND renamed_at < ?"} {
+		rows, err := d.db.Query("EXPLAIN QUERY PLAN SELECT COUNT(*) FROM file_records WHERE "+where, "2026-01-01T00:00:00Z", "2026-02-01T00:00:00Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var plan []string
+		for rows.Next() {
+			var id, parent, notUsed int
+			var detail string
+			if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+				t.Fatal(err)
+			}
+			plan = append(plan, detail)
+		}
+		rows.Close()
+		if !strings.Contains(strings.Join(plan, "; "), "idx_file_records_renamed_at") {
+			t.Errorf("plan for %q = %v, want idx_file_records_renamed_at", where, plan)
+		}
+	}
+}
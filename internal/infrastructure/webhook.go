@@ -0,0 +1,178 @@
+// Outbound webhook delivery log and HTTP sender
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"auto-rename/internal/domain"
+)
+
+const webhookColumns = "id, webhook, event, run_id, payload, status, attempts, response_code, last_error, created_at, updated_at, next_attempt_at"
+
+// Header gửi kèm mỗi webhook
+const (
+	WebhookHeaderEvent     = "X-Auto-Rename-Event"
+	WebhookHeaderDelivery  = "X-Auto-Rename-Delivery"
+	WebhookHeaderTimestamp = "X-Auto-Rename-Timestamp"
+	WebhookHeaderSignature = "X-Auto-Rename-Signature"
+)
+
+// InsertWebhookDelivery lưu một lần gửi mới
+func (d *Database) InsertWebhookDelivery(w domain.WebhookDelivery) error {
+	_, err := d.db.Exec(
+		"INSERT INTO webhook_deliveries ("+webhookColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		w.ID, w.Webhook, w.Event, w.RunID, w.Payload, w.Status, w.Attempts, w.ResponseCode, w.LastError, w.CreatedAt, w.UpdatedAt, w.NextAttemptAt,
+	)
+	return err
+}
+
+// InsertWebhookDeliveries lưu nhiều lần gửi mới trong một transaction
+func (d *Database) InsertWebhookDeliveries(deliveries []domain.WebhookDelivery) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO webhook_deliveries (" + webhookColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, w := range deliveries {
+		if _, err := stmt.Exec(w.ID, w.Webhook, w.Event, w.RunID, w.Payload, w.Status, w.Attempts, w.ResponseCode, w.LastError, w.CreatedAt, w.UpdatedAt, w.NextAttemptAt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateWebhookDelivery ghi kết quả lần thử gần nhất
+func (d *Database) UpdateWebhookDelivery(w domain.WebhookDelivery) error {
+	_, err := d.db.Exec(
+		"UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, last_error = ?, updated_at = ?, next_attempt_at = ? WHERE id = ?",
+		w.Status, w.Attempts, w.ResponseCode, w.LastError, w.UpdatedAt, w.NextAttemptAt, w.ID,
+	)
+	return err
+}
+
+// GetWebhookDelivery lấy một lần gửi theo id; trả về sql.ErrNoRows nếu không có
+func (d *Database) GetWebhookDelivery(id string) (domain.WebhookDelivery, error) {
+	return scanWebhookDelivery(d.db.QueryRow("SELECT "+webhookColumns+" FROM webhook_deliveries WHERE id = ?", id))
+}
+
+// GetWebhookDeliveries lấy các lần gửi mới nhất, lọc theo webhook và trạng thái (rỗng = tất cả)
+func (d *Database) GetWebhookDeliveries(webhook, status string, limit int) ([]domain.WebhookDelivery, error) {
+	query := "SELECT " + webhookColumns + " FROM webhook_deliveries WHERE (? = '' OR webhook = ?) AND (? = '' OR status = ?) ORDER BY created_at DESC, rowid DESC LIMIT ?"
+	rows, err := d.db.Query(query, webhook, webhook, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []domain.WebhookDelivery{}
+	for rows.Next() {
+		w, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, w)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetPendingWebhookDeliveries lấy các lần gửi chưa xong, cũ nhất trước
+func (d *Database) GetPendingWebhookDeliveries() ([]domain.WebhookDelivery, error) {
+	rows, err := d.db.Query("SELECT "+webhookColumns+" FROM webhook_deliveries WHERE status = ? ORDER BY created_at, rowid", domain.WebhookStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		w, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, w)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetDueWebhookDeliveries lấy tối đa limit lần gửi pending đã tới lúc thử (next_attempt_at <= now, RFC3339 UTC)
+func (d *Database) GetDueWebhookDeliveries(now string, limit int) ([]domain.WebhookDelivery, error) {
+	rows, err := d.db.Query("SELECT "+webhookColumns+" FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, rowid LIMIT ?",
+		domain.WebhookStatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		w, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, w)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookDelivery(row rowScanner) (domain.WebhookDelivery, error) {
+	var w domain.WebhookDelivery
+	err := row.Scan(&w.ID, &w.Webhook, &w.Event, &w.RunID, &w.Payload, &w.Status, &w.Attempts, &w.ResponseCode, &w.LastError, &w.CreatedAt, &w.UpdatedAt, &w.NextAttemptAt)
+	return w, err
+}
+
+// SignWebhook tính chữ ký HMAC-SHA256 của "timestamp.body" theo dạng sha256=<hex>
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookStatusError là phản hồi không phải 2xx của webhook
+type WebhookStatusError struct {
+	Code int
+}
+
+func (e *WebhookStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status %d", e.Code)
+}
+
+// PostWebhook gửi payload JSON tới url, ký bằng secret nếu có. Trả về status code
+// (0 nếu không nhận được phản hồi); phản hồi không phải 2xx là *WebhookStatusError.
+func PostWebhook(ctx context.Context, client *http.Client, url, secret string, d domain.WebhookDelivery, timestamp int64) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "auto-rename-webhook/1")
+	req.Header.Set(WebhookHeaderEvent, d.Event)
+	req.Header.Set(WebhookHeaderDelivery, d.ID)
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if secret != "" {
+		req.Header.Set(WebhookHeaderSignature, SignWebhook(secret, timestamp, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Đọc bỏ một phần body để connection được tái sử dụng
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &WebhookStatusError{Code: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
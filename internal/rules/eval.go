@@ -0,0 +1,512 @@
+// Expression evaluation and built-in functions of the rule language
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// value là một giá trị khi chạy: string, int64, bool, time.Time hoặc []value
+type value = interface{}
+
+// env là ngữ cảnh đánh giá một file
+type env struct {
+	vars    map[string]value
+	counter Counter
+}
+
+type node interface {
+	eval(e *env) (value, error)
+	position() Pos
+}
+
+type literalNode struct {
+	pos Pos
+	v   value
+}
+
+type varNode struct {
+	pos  Pos
+	name string
+}
+
+type listNode struct {
+	pos   Pos
+	items []node
+}
+
+type unaryNode struct {
+	pos Pos
+	op  string
+	x   node
+}
+
+type binaryNode struct {
+	pos         Pos
+	op          string
+	left, right node
+}
+
+type ternaryNode struct {
+	pos                   Pos
+	cond, then, otherwise node
+}
+
+type callNode struct {
+	pos  Pos
+	name string
+	fn   function
+	args []node
+	re   *regexp.Regexp // pattern hằng của matches(), biên dịch lúc nạp
+}
+
+func (n *literalNode) position() Pos { return n.pos }
+func (n *varNode) position() Pos     { return n.pos }
+func (n *listNode) position() Pos    { return n.pos }
+func (n *unaryNode) position() Pos   { return n.pos }
+func (n *binaryNode) position() Pos  { return n.pos }
+func (n *ternaryNode) position() Pos { return n.pos }
+func (n *callNode) position() Pos    { return n.pos }
+
+// evalError gắn vị trí vào lỗi khi chạy
+func evalError(pos Pos, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...))
+}
+
+func typeName(v value) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "int"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "time"
+	case []value:
+		return "list"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func (n *literalNode) eval(e *env) (value, error) {
+	return n.v, nil
+}
+
+func (n *varNode) eval(e *env) (value, error) {
+	return e.vars[n.name], nil
+}
+
+func (n *listNode) eval(e *env) (value, error) {
+	items := make([]value, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (n *unaryNode) eval(e *env) (value, error) {
+	x, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		if b, ok := x.(bool); ok {
+			return !b, nil
+		}
+	case "-":
+		if i, ok := x.(int64); ok {
+			return -i, nil
+		}
+	}
+	return nil, evalError(n.pos, "cannot apply %s to %s", n.op, typeName(x))
+}
+
+func (n *ternaryNode) eval(e *env) (value, error) {
+	c, err := evalBool(n.cond, e)
+	if err != nil {
+		return nil, err
+	}
+	if c {
+		return n.then.eval(e)
+	}
+	return n.otherwise.eval(e)
+}
+
+// evalBool đánh giá biểu thức phải trả về bool
+func evalBool(n node, e *env) (bool, error) {
+	v, err := n.eval(e)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, evalError(n.position(), "expected bool, got %s", typeName(v))
+	}
+	return b, nil
+}
+
+func (n *binaryNode) eval(e *env) (value, error) {
+	// && và || dừng sớm
+	if n.op == "&&" || n.op == "||" {
+		l, err := evalBool(n.left, e)
+		if err != nil {
+			return nil, err
+		}
+		if (n.op == "&&" && !l) || (n.op == "||" && l) {
+			return l, nil
+		}
+		return evalBool(n.right, e)
+	}
+	l, err := n.left.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	mismatch := func() error {
+		return evalError(n.pos, "cannot apply %s to %s and %s", n.op, typeName(l), typeName(r))
+	}
+	switch n.op {
+	case "in":
+		switch container := r.(type) {
+		case []value:
+			for _, item := range container {
+				if equal(l, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			if s, ok := l.(string); ok {
+				return strings.Contains(container, s), nil
+			}
+		}
+		return nil, mismatch()
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		c, ok := compare(l, r)
+		if !ok {
+			return nil, mismatch()
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+	if ls, ok := l.(string); ok && n.op == "+" {
+		if rs, ok := r.(string); ok {
+			return ls + rs, nil
+		}
+		return nil, mismatch()
+	}
+	li, lok := l.(int64)
+	ri, rok := r.(int64)
+	if !lok || !rok {
+		return nil, mismatch()
+	}
+	switch n.op {
+	case "+":
+		return li + ri, nil
+	case "-":
+		return li - ri, nil
+	case "*":
+		return li * ri, nil
+	case "/", "%":
+		if ri == 0 {
+			return nil, evalError(n.pos, "division by zero")
+		}
+		if n.op == "/" {
+			return li / ri, nil
+		}
+		return li % ri, nil
+	}
+	return nil, mismatch()
+}
+
+func equal(a, b value) bool {
+	switch x := a.(type) {
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	case []value:
+		return false
+	}
+	if _, isList := b.([]value); isList {
+		return false
+	}
+	return a == b
+}
+
+// compare so sánh hai giá trị cùng kiểu int, string hoặc time
+func compare(a, b value) (int, bool) {
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	}
+	return 0, false
+}
+
+func (n *callNode) eval(e *env) (value, error) {
+	args := make([]value, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	c := &call{node: n, env: e, args: args}
+	v, err := n.fn.impl(c)
+	if err != nil {
+		return nil, evalError(n.pos, "%s(): %v", n.name, err)
+	}
+	return v, nil
+}
+
+// call là một lần gọi hàm built-in với tham số đã đánh giá
+type call struct {
+	node *callNode
+	env  *env
+	args []value
+}
+
+func (c *call) str(i int) (string, error) {
+	s, ok := c.args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d must be a string, got %s", i+1, typeName(c.args[i]))
+	}
+	return s, nil
+}
+
+func (c *call) int(i int) (int64, error) {
+	n, ok := c.args[i].(int64)
+	if !ok {
+		return 0, fmt.Errorf("argument %d must be an int, got %s", i+1, typeName(c.args[i]))
+	}
+	return n, nil
+}
+
+func (c *call) time(i int) (time.Time, error) {
+	t, ok := c.args[i].(time.Time)
+	if !ok {
+		return time.Time{}, fmt.Errorf("argument %d must be a time, got %s", i+1, typeName(c.args[i]))
+	}
+	return t, nil
+}
+
+// function mô tả một hàm built-in; sideEffect là hàm không được dùng trong điều kiện
+type function struct {
+	minArgs, maxArgs int
+	sideEffect       bool
+	impl             func(c *call) (value, error)
+}
+
+// regexpCache giữ pattern không phải hằng của matches()
+var regexpCache sync.Map
+
+func stringFunc(f func(string) string) function {
+	return function{1, 1, false, func(c *call) (value, error) {
+		s, err := c.str(0)
+		if err != nil {
+			return nil, err
+		}
+		return f(s), nil
+	}}
+}
+
+func stringPredicate(f func(s, sub string) bool) function {
+	return function{2, 2, false, func(c *call) (value, error) {
+		s, err := c.str(0)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := c.str(1)
+		if err != nil {
+			return nil, err
+		}
+		return f(s, sub), nil
+	}}
+}
+
+func timePart(f func(time.Time) int) function {
+	return function{1, 1, false, func(c *call) (value, error) {
+		t, err := c.time(0)
+		if err != nil {
+			return nil, err
+		}
+		return int64(f(t)), nil
+	}}
+}
+
+// functions là các hàm built-in
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"lower":     stringFunc(strings.ToLower),
+		"upper":     stringFunc(strings.ToUpper),
+		"trim":      stringFunc(strings.TrimSpace),
+		"contains":  stringPredicate(strings.Contains),
+		"hasprefix": stringPredicate(strings.HasPrefix),
+		"hassuffix": stringPredicate(strings.HasSuffix),
+		"year":      timePart(func(t time.Time) int { return t.Year() }),
+		"month":     timePart(func(t time.Time) int { return int(t.Month()) }),
+		"day":       timePart(func(t time.Time) int { return t.Day() }),
+		"matches": {2, 2, false, func(c *call) (value, error) {
+			s, err := c.str(0)
+			if err != nil {
+				return nil, err
+			}
+			re := c.node.re
+			if re == nil {
+				pattern, err := c.str(1)
+				if err != nil {
+					return nil, err
+				}
+				cached, ok := regexpCache.Load(pattern)
+				if !ok {
+					compiled, err := regexp.Compile(pattern)
+					if err != nil {
+						return nil, err
+					}
+					cached, _ = regexpCache.LoadOrStore(pattern, compiled)
+				}
+				re = cached.(*regexp.Regexp)
+			}
+			return re.MatchString(s), nil
+		}},
+		"replace": {3, 3, false, func(c *call) (value, error) {
+			s, err := c.str(0)
+			if err != nil {
+				return nil, err
+			}
+			old, err := c.str(1)
+			if err != nil {
+				return nil, err
+			}
+			repl, err := c.str(2)
+			if err != nil {
+				return nil, err
+			}
+			return strings.ReplaceAll(s, old, repl), nil
+		}},
+		"pad": {2, 2, false, func(c *call) (value, error) {
+			n, err := c.int(0)
+			if err != nil {
+				return nil, err
+			}
+			width, err := c.int(1)
+			if err != nil {
+				return nil, err
+			}
+			if width < 0 || width > 64 {
+				return nil, fmt.Errorf("width must be between 0 and 64")
+			}
+			return fmt.Sprintf("%0*d", int(width), n), nil
+		}},
+		"str": {1, 1, false, func(c *call) (value, error) {
+			switch v := c.args[0].(type) {
+			case string:
+				return v, nil
+			case int64:
+				return strconv.FormatInt(v, 10), nil
+			case bool:
+				return strconv.FormatBool(v), nil
+			case time.Time:
+				return v.Format(time.RFC3339), nil
+			}
+			return nil, fmt.Errorf("cannot convert %s to string", typeName(c.args[0]))
+		}},
+		"int": {1, 1, false, func(c *call) (value, error) {
+			switch v := c.args[0].(type) {
+			case int64:
+				return v, nil
+			case string:
+				n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%q is not a number", v)
+				}
+				return n, nil
+			}
+			return nil, fmt.Errorf("cannot convert %s to int", typeName(c.args[0]))
+		}},
+		"len": {1, 1, false, func(c *call) (value, error) {
+			switch v := c.args[0].(type) {
+			case string:
+				return int64(len(v)), nil
+			case []value:
+				return int64(len(v)), nil
+			}
+			return nil, fmt.Errorf("cannot take length of %s", typeName(c.args[0]))
+		}},
+		"date": {1, 2, false, func(c *call) (value, error) {
+			t, err := c.time(0)
+			if err != nil {
+				return nil, err
+			}
+			layout := "2006-01-02"
+			if len(c.args) == 2 {
+				if layout, err = c.str(1); err != nil {
+					return nil, err
+				}
+			}
+			return t.Format(layout), nil
+		}},
+		"now": {0, 0, false, func(c *call) (value, error) {
+			return time.Now(), nil
+		}},
+		"uuid": {0, 0, false, func(c *call) (value, error) {
+			return uuid.New().String(), nil
+		}},
+		"seq": {1, 1, true, func(c *call) (value, error) {
+			name, err := c.str(0)
+			if err != nil {
+				return nil, err
+			}
+			if c.env.counter == nil {
+				return nil, fmt.Errorf("no counter available")
+			}
+			return c.env.counter.Next(name)
+		}},
+	}
+}
@@ -0,0 +1,191 @@
+// Tokenizer for the naming rule language
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+	tokIdent
+	tokString
+	tokInt
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // tên, chuỗi đã bỏ escape hoặc toán tử
+	num  int64
+	pos  Pos
+}
+
+// Pos là vị trí trong file luật, dùng cho thông báo lỗi
+type Pos struct {
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// sizeUnits là hậu tố kích thước cho số nguyên, vd 10MB
+var sizeUnits = map[string]int64{
+	"B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40,
+}
+
+// operators xếp toán tử dài trước để khớp tham lam
+var operators = []string{"=>", "==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "?", ":", "(", ")", "[", "]", ","}
+
+// lex tách mã nguồn thành token. Xuống dòng chỉ kết thúc luật khi không nằm
+// trong ngoặc và không đứng sau toán tử hay dấu phẩy, nên một luật dài có thể
+// xuống dòng bên trong ( ) hoặc sau "=>", "&&", ",".
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line, col := 1, 1
+	depth := 0
+	i := 0
+	advance := func(n int) {
+		for k := 0; k < n; k++ {
+			if src[i] == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+			i++
+		}
+	}
+	for i < len(src) {
+		c := src[i]
+		pos := Pos{line, col}
+		switch {
+		case c == '\n':
+			if depth == 0 && len(tokens) > 0 && endsLine(tokens[len(tokens)-1]) {
+				tokens = append(tokens, token{kind: tokNewline, pos: pos})
+			}
+			advance(1)
+		case c == ' ' || c == '\t' || c == '\r':
+			advance(1)
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				advance(1)
+			}
+		case c == '"' || c == '\'':
+			text, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", pos, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: pos})
+			advance(n)
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			n, err := strconv.ParseInt(src[i:j], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid number %q", pos, src[i:j])
+			}
+			k := j
+			for k < len(src) && isLetter(src[k]) {
+				k++
+			}
+			if k > j {
+				unit, ok := sizeUnits[strings.ToUpper(src[j:k])]
+				if !ok {
+					return nil, fmt.Errorf("%s: unknown size unit %q", pos, src[j:k])
+				}
+				n *= unit
+			}
+			tokens = append(tokens, token{kind: tokInt, num: n, text: src[i:k], pos: pos})
+			advance(k - i)
+		case c == '_' || isLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || isLetter(src[j]) || (src[j] >= '0' && src[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[i:j], pos: pos})
+			advance(j - i)
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%s: unexpected character %q", pos, c)
+			}
+			switch op {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				if depth > 0 {
+					depth--
+				}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: pos})
+			advance(len(op))
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: Pos{line, col}})
+	return tokens, nil
+}
+
+// endsLine cho biết xuống dòng sau token t có kết thúc luật không
+func endsLine(t token) bool {
+	switch t.kind {
+	case tokNewline:
+		return false
+	case tokOp:
+		return t.text == ")" || t.text == "]"
+	}
+	return true
+}
+
+// isLetter chỉ nhận chữ ASCII; tên biến và hàm không dùng Unicode
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// lexString đọc chuỗi trong nháy đơn hoặc kép với escape \\ \" \' \n \t,
+// trả về nội dung và số byte đã đọc
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch c {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			i++
+			if i >= len(src) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '\\', '"', '\'':
+				b.WriteByte(src[i])
+			default:
+				return "", 0, fmt.Errorf("unknown escape \\%c", src[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
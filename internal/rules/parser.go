@@ -0,0 +1,351 @@
+// Parser for the naming rule language
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// rule là một dòng "điều kiện => hành động, ..."
+type rule struct {
+	pos    Pos
+	cond   node
+	name   node
+	dir    node
+	skip   bool
+	reason node
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	// inCondition chặn các hàm có tác dụng phụ (seq) trong điều kiện
+	inCondition bool
+}
+
+// parse dịch toàn bộ file luật
+func parse(src string) ([]*rule, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	var rules []*rule
+	for {
+		for p.peek().kind == tokNewline {
+			p.next()
+		}
+		if p.peek().kind == tokEOF {
+			return rules, nil
+		}
+		r, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+		if t := p.next(); t.kind != tokNewline && t.kind != tokEOF {
+			return nil, fmt.Errorf("%s: expected end of rule, got %s", t.pos, describe(t))
+		}
+	}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) expectOp(op string) error {
+	t := p.next()
+	if t.kind != tokOp || t.text != op {
+		return fmt.Errorf("%s: expected %q, got %s", t.pos, op, describe(t))
+	}
+	return nil
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "end of line"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// parseRule: expr "=>" action {"," action}
+func (p *parser) parseRule() (*rule, error) {
+	r := &rule{pos: p.peek().pos}
+	p.inCondition = true
+	cond, err := p.parseExpr()
+	p.inCondition = false
+	if err != nil {
+		return nil, err
+	}
+	r.cond = cond
+	if err := p.expectOp("=>"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.parseAction(r); err != nil {
+			return nil, err
+		}
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if r.skip && (r.name != nil || r.dir != nil) {
+		return nil, fmt.Errorf("%s: skip() cannot be combined with name() or dir()", r.pos)
+	}
+	return r, nil
+}
+
+// parseAction: name(expr) | dir(expr) | skip([expr])
+func (p *parser) parseAction(r *rule) error {
+	t := p.next()
+	if t.kind != tokIdent {
+		return fmt.Errorf("%s: expected name(), dir() or skip(), got %s", t.pos, describe(t))
+	}
+	if err := p.expectOp("("); err != nil {
+		return err
+	}
+	var arg node
+	if !p.isOp(")") {
+		var err error
+		if arg, err = p.parseExpr(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return err
+	}
+	twice := fmt.Errorf("%s: %s() given twice", t.pos, t.text)
+	switch t.text {
+	case "name":
+		if r.name != nil {
+			return twice
+		}
+		r.name = arg
+	case "dir":
+		if r.dir != nil {
+			return twice
+		}
+		r.dir = arg
+	case "skip":
+		if r.skip {
+			return twice
+		}
+		r.skip, r.reason = true, arg
+		return nil
+	default:
+		return fmt.Errorf("%s: unknown action %q, expected name(), dir() or skip()", t.pos, t.text)
+	}
+	if arg == nil {
+		return fmt.Errorf("%s: %s() needs an argument", t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseExpr() (node, error) {
+	return p.parseTernary()
+}
+
+// parseTernary: or ["?" expr ":" expr]
+func (p *parser) parseTernary() (node, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("?") {
+		return cond, nil
+	}
+	pos := p.next().pos
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectOp(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &ternaryNode{pos: pos, cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+// precedence của toán tử hai ngôi, thấp tới cao
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binaryOp(level int) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && !(t.kind == tokIdent && t.text == "in") {
+		return "", false
+	}
+	for _, op := range precedence[level] {
+		if t.text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.binaryOp(level)
+		if !ok {
+			return left, nil
+		}
+		pos := p.next().pos
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{pos: pos, op: op, left: left, right: right}
+		// So sánh không nối chuỗi: a < b < c là lỗi cú pháp
+		if level == 2 {
+			if _, again := p.binaryOp(level); again {
+				return nil, fmt.Errorf("%s: comparisons cannot be chained, use &&", p.peek().pos)
+			}
+		}
+	}
+}
+
+// parseUnary: ("!" | "-") unary | primary
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!") || p.isOp("-") {
+		t := p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{pos: t.pos, op: t.text, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		return &literalNode{pos: t.pos, v: t.num}, nil
+	case tokString:
+		return &literalNode{pos: t.pos, v: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &literalNode{pos: t.pos, v: t.text == "true"}, nil
+		}
+		if p.isOp("(") {
+			return p.parseCall(t)
+		}
+		if _, ok := variables[t.text]; !ok {
+			return nil, fmt.Errorf("%s: unknown variable %q", t.pos, t.text)
+		}
+		return &varNode{pos: t.pos, name: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expectOp(")")
+		case "[":
+			list := &listNode{pos: t.pos}
+			for !p.isOp("]") {
+				x, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, x)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			return list, p.expectOp("]")
+		}
+	}
+	return nil, fmt.Errorf("%s: unexpected %s", t.pos, describe(t))
+}
+
+// parseCall kiểm tra tên hàm, số tham số và biên dịch sẵn regexp hằng
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		if name.text == "name" || name.text == "dir" || name.text == "skip" {
+			return nil, fmt.Errorf("%s: %s() is an action and can only follow =>", name.pos, name.text)
+		}
+		return nil, fmt.Errorf("%s: unknown function %q", name.pos, name.text)
+	}
+	if fn.sideEffect && p.inCondition {
+		return nil, fmt.Errorf("%s: %s() cannot be used in a condition", name.pos, name.text)
+	}
+	p.next() // (
+	call := &callNode{pos: name.pos, name: name.text, fn: fn}
+	for !p.isOp(")") {
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, x)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	if len(call.args) < fn.minArgs || len(call.args) > fn.maxArgs {
+		want := fmt.Sprint(fn.minArgs)
+		if fn.maxArgs != fn.minArgs {
+			want = fmt.Sprintf("%d to %d", fn.minArgs, fn.maxArgs)
+		}
+		return nil, fmt.Errorf("%s: %s() takes %s arguments, got %d", name.pos, name.text, want, len(call.args))
+	}
+	if name.text == "matches" {
+		if lit, ok := call.args[1].(*literalNode); ok {
+			pattern, isString := lit.v.(string)
+			if !isString {
+				return nil, fmt.Errorf("%s: matches() pattern must be a string", lit.pos)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern: %v", lit.pos, strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+			}
+			call.re = re
+		}
+	}
+	return call, nil
+}
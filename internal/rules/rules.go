@@ -0,0 +1,276 @@
+// Package rules implements a small expression language for naming decisions.
+//
+// A rules file has one rule per line: a condition, "=>", then one or more
+// actions separated by commas. The first rule whose condition is true decides:
+//
+//	ext == ".pdf" && hasprefix(rel_dir, "invoices") && size <= 10MB => name("INV-" + pad(seq("invoice"), 5) + ext)
+//	size > 2GB => skip("too large")
+//	ext in [".jpg", ".jpeg"] => dir("photos/" + str(year(mod_time)))
+package rules
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// variables là các biến mô tả file mà luật có thể dùng
+var variables = map[string]string{
+	"name":         "file name, e.g. Report.PDF",
+	"base":         "file name without extension, e.g. Report or backup for backup.tar.gz",
+	"ext":          "lower-case extension with dot, e.g. .pdf or .tar.gz, after extension fixes",
+	"mime":         "content type detected from the file content, \"\" if unknown",
+	"path":         "absolute path of the file",
+	"dir":          "absolute directory of the file",
+	"rel_path":     "path relative to the scan root, with / separators",
+	"rel_dir":      "directory relative to the scan root, \"\" for the root itself",
+	"root":         "scan root directory",
+	"size":         "size in bytes",
+	"mod_time":     "modification time",
+	"age_days":     "whole days since the last modification",
+	"mode":         "permission string, e.g. -rw-r--r--",
+	"taken_at":     "capture time from EXIF or video metadata, mod_time if unknown",
+	"camera_make":  "camera maker, e.g. Apple",
+	"camera_model": "camera model, e.g. iPhone 15 Pro",
+	"width":        "image or video width in pixels",
+	"height":       "image or video height in pixels",
+	"duration":     "video or audio duration in whole seconds",
+}
+
+// FileVars trả về giá trị các biến của file dưới dạng chuỗi, để hiển thị khi thử luật
+func FileVars(f File) map[string]string {
+	out := map[string]string{}
+	for k, v := range fileVars(f) {
+		switch x := v.(type) {
+		case string:
+			out[k] = fmt.Sprintf("%q", x)
+		case time.Time:
+			out[k] = x.Format(time.RFC3339)
+		default:
+			out[k] = fmt.Sprint(x)
+		}
+	}
+	return out
+}
+
+// Counter cấp số thứ tự cho seq(name)
+type Counter interface {
+	Next(name string) (int64, error)
+}
+
+// File là metadata của file truyền cho luật
+type File struct {
+	Path    string
+	Root    string
+	Size    int64
+	ModTime time.Time
+	Mode    string
+	// Base là tên không có đuôi, Ext là đuôi đã sửa theo nội dung; đuôi ghép như
+	// .tar.gz tính là một đuôi. Rỗng là tính từ tên file.
+	Base string
+	Ext  string
+	// MimeType là loại file nhận ra từ nội dung
+	MimeType string
+	// Metadata ảnh/video; TakenAt zero là không biết thời điểm chụp
+	TakenAt     time.Time
+	CameraMake  string
+	CameraModel string
+	Width       int64
+	Height      int64
+	Duration    float64
+}
+
+// Decision là kết quả áp dụng luật cho một file. Khi không luật nào khớp
+// (Matched false) file được đặt tên mặc định.
+type Decision struct {
+	Matched bool
+	// Rule là vị trí luật khớp, vd rules.txt:3
+	Rule string
+	// Name là tên mới; rỗng là giữ cách đặt tên mặc định
+	Name string
+	// Dir là thư mục đích tương đối so với root; rỗng là giữ nguyên thư mục
+	Dir    string
+	Skip   bool
+	Reason string
+}
+
+// Set là tập luật đã được kiểm tra cú pháp
+type Set struct {
+	file  string
+	rules []*rule
+}
+
+// Load đọc và kiểm tra file luật
+func Load(filename string) (*Set, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filename, string(data))
+}
+
+// Parse kiểm tra mã nguồn luật; filename chỉ dùng trong thông báo lỗi
+func Parse(filename, src string) (*Set, error) {
+	rules, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", filepath.Base(filename), err)
+	}
+	return &Set{file: filepath.Base(filename), rules: rules}, nil
+}
+
+// Len trả về số luật; Set nil (không cấu hình luật) có 0 luật
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.rules)
+}
+
+// Evaluate áp dụng luật đầu tiên khớp với file. Lỗi khi chạy (sai kiểu,
+// tên không hợp lệ...) được trả về kèm vị trí luật.
+func (s *Set) Evaluate(f File, counter Counter) (Decision, error) {
+	e := &env{vars: fileVars(f), counter: counter}
+	for _, r := range s.rules {
+		label := fmt.Sprintf("%s:%d", s.file, r.pos.Line)
+		matched, err := evalBool(r.cond, e)
+		if err != nil {
+			return Decision{}, fmt.Errorf("%s:%v", s.file, err)
+		}
+		if !matched {
+			continue
+		}
+		d, err := r.decide(e)
+		if err != nil {
+			return Decision{}, fmt.Errorf("%s:%v", s.file, err)
+		}
+		d.Matched, d.Rule = true, label
+		return d, nil
+	}
+	return Decision{}, nil
+}
+
+// decide đánh giá các hành động của luật đã khớp
+func (r *rule) decide(e *env) (Decision, error) {
+	var d Decision
+	if r.skip {
+		d.Skip, d.Reason = true, "skipped by rule"
+		if r.reason != nil {
+			reason, err := evalString(r.reason, e)
+			if err != nil {
+				return d, err
+			}
+			d.Reason = reason
+		}
+		return d, nil
+	}
+	if r.dir != nil {
+		dir, err := evalString(r.dir, e)
+		if err != nil {
+			return d, err
+		}
+		if d.Dir, err = cleanDir(dir); err != nil {
+			return d, evalError(r.dir.position(), "%v", err)
+		}
+	}
+	if r.name != nil {
+		name, err := evalString(r.name, e)
+		if err != nil {
+			return d, err
+		}
+		if err := checkName(name); err != nil {
+			return d, evalError(r.name.position(), "%v", err)
+		}
+		d.Name = name
+	}
+	return d, nil
+}
+
+func evalString(n node, e *env) (string, error) {
+	v, err := n.eval(e)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", evalError(n.position(), "expected string, got %s", typeName(v))
+	}
+	return s, nil
+}
+
+// checkName từ chối tên rỗng hoặc chứa dấu phân cách thư mục
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	if strings.ContainsAny(name, `/\`) || strings.ContainsRune(name, 0) {
+		return fmt.Errorf("file name %q must not contain path separators", name)
+	}
+	return nil
+}
+
+// cleanDir chuẩn hóa thư mục đích và chặn thoát ra ngoài root
+func cleanDir(dir string) (string, error) {
+	dir = strings.ReplaceAll(dir, `\`, "/")
+	if strings.HasPrefix(dir, "/") {
+		return "", fmt.Errorf("target directory %q must be relative to the scan root", dir)
+	}
+	cleaned := path.Clean(dir)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("target directory %q leaves the scan root", dir)
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// fileVars tính các biến của file
+func fileVars(f File) map[string]value {
+	name := filepath.Base(f.Path)
+	ext := filepath.Ext(name)
+	dir := filepath.Dir(f.Path)
+	relPath := name
+	if rel, err := filepath.Rel(f.Root, f.Path); err == nil && !strings.HasPrefix(rel, "..") {
+		relPath = filepath.ToSlash(rel)
+	}
+	base, fixedExt := strings.TrimSuffix(name, ext), ext
+	if f.Base != "" {
+		base = f.Base
+	}
+	if f.Ext != "" {
+		fixedExt = f.Ext
+	}
+	relDir := path.Dir(relPath)
+	if relDir == "." {
+		relDir = ""
+	}
+	takenAt := f.TakenAt
+	if takenAt.IsZero() {
+		takenAt = f.ModTime
+	}
+	return map[string]value{
+		"name":         name,
+		"base":         base,
+		"ext":          strings.ToLower(fixedExt),
+		"mime":         f.MimeType,
+		"path":         f.Path,
+		"dir":          dir,
+		"rel_path":     relPath,
+		"rel_dir":      relDir,
+		"root":         f.Root,
+		"size":         f.Size,
+		"mod_time":     f.ModTime,
+		"age_days":     int64(time.Since(f.ModTime) / (24 * time.Hour)),
+		"mode":         f.Mode,
+		"taken_at":     takenAt,
+		"camera_make":  f.CameraMake,
+		"camera_model": f.CameraModel,
+		"width":        f.Width,
+		"height":       f.Height,
+		"duration":     int64(math.Round(f.Duration)),
+	}
+}
@@ -0,0 +1,242 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCounter cấp số tăng dần theo tên trong bộ nhớ
+type testCounter map[string]int64
+
+func (c testCounter) Next(name string) (int64, error) {
+	c[name]++
+	return c[name], nil
+}
+
+// testFile là file mẫu ở thư mục con của root
+func testFile() File {
+	return File{
+		Path:    "/data/invoices/2024/Report.PDF",
+		Root:    "/data",
+		Size:    3 << 20,
+		ModTime: time.Date(2024, 3, 7, 10, 30, 0, 0, time.UTC),
+		Mode:    "-rw-r--r--",
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		rules int
+	}{
+		{"empty", "", 0},
+		{"comments and blank lines", "# nothing\n\n   # here\n", 0},
+		{"one rule", `ext == ".pdf" => skip()`, 1},
+		{"several rules", "ext == \".pdf\" => skip()\nsize > 1GB => skip(\"big\")\ntrue => name(uuid() + ext)", 3},
+		{"continued after operator", "ext == \".pdf\" &&\n  size > 0 =>\n  name(\"a\" + ext),\n  dir(\"docs\")", 1},
+		{"continued in brackets", "ext in [\n  \".jpg\",\n  \".png\"\n] => dir(\"img\")", 1},
+		{"trailing comment", `true => skip() # keep everything`, 1},
+		{"size units", `size >= 1KB && size < 2TB => skip()`, 1},
+		{"ternary and functions", `true => name((size > 10MB ? "big-" : "small-") + lower(base) + pad(seq("n"), 3) + ext)`, 1},
+		{"escapes and quotes", `name == 'it\'s' || name == "tab\there" => skip("quoted \"x\"")`, 1},
+		{"regexp literal", `matches(name, "^IMG_[0-9]+") => dir("photos")`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Parse("test.rules", tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if set.Len() != tt.rules {
+				t.Errorf("Len() = %d, want %d", set.Len(), tt.rules)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`ext == ".pdf" =>`, `test.rules:1:17: expected name(), dir() or skip(), got end of file`},
+		{`true => name("a"), name("b")`, `test.rules:1:20: name() given twice`},
+		{`true => skip(), name("a")`, `skip() cannot be combined with name() or dir()`},
+		{"true => skip()\nfoo == 1 => skip()", `test.rules:2:1: unknown variable "foo"`},
+		{`true => bogus("x")`, `unknown action "bogus"`},
+		{`nope(1) => skip()`, `unknown function "nope"`},
+		{`1 < 2 < 3 => skip()`, `comparisons cannot be chained`},
+		{`size > 10XB => skip()`, `unknown size unit "XB"`},
+		{`name == "abc => skip()`, `test.rules:1:9: unterminated string`},
+		{`name == "a\q" => skip()`, `unknown escape \q`},
+		{`seq("x") > 1 => skip()`, `seq() cannot be used in a condition`},
+		{`true => name()`, `name() needs an argument`},
+		{`matches(name, "(") => skip()`, `invalid pattern`},
+		{`pad(1) == "1" => skip()`, `pad() takes 2 arguments, got 1`},
+		{`true => name("a") name("b")`, `expected end of rule`},
+		{`size $ 1 => skip()`, `unexpected character '$'`},
+		{`name("a") => skip()`, `name() is an action and can only follow =>`},
+	}
+	for _, tt := range tests {
+		_, err := Parse("dir/test.rules", tt.src)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want error %q", tt.src, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %q, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		file func(f *File)
+		want Decision
+	}{
+		{"no rule matches", `ext == ".jpg" => skip()`, nil, Decision{}},
+		{"skip with default reason", `ext == ".pdf" => skip()`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Skip: true, Reason: "skipped by rule"}},
+		{"first matching rule wins", "ext == \".jpg\" => skip(\"jpg\")\next == \".pdf\" => skip(\"pdf\")\ntrue => skip(\"any\")", nil,
+			Decision{Matched: true, Rule: "test.rules:2", Skip: true, Reason: "pdf"}},
+		{"variables", `name == "Report.PDF" && base == "Report" && ext == ".pdf" && rel_dir == "invoices/2024" && rel_path == "invoices/2024/Report.PDF" && root == "/data" && dir == "/data/invoices/2024" && mode == "-rw-r--r--" => skip()`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Skip: true, Reason: "skipped by rule"}},
+		{"rel_dir is empty at the root", `rel_dir == "" => skip()`, func(f *File) { f.Path = "/data/Report.PDF" },
+			Decision{Matched: true, Rule: "test.rules:1", Skip: true, Reason: "skipped by rule"}},
+		{"name and dir", `hasprefix(rel_dir, "invoices") => name("INV-" + pad(seq("invoice"), 5) + ext), dir("archive/" + str(year(mod_time)))`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Name: "INV-00001.pdf", Dir: "archive/2024"}},
+		{"dir is cleaned", `true => dir("./a//b/../c/")`, nil, Decision{Matched: true, Rule: "test.rules:1", Dir: "a/c"}},
+		{"dir at the root", `true => dir(".")`, nil, Decision{Matched: true, Rule: "test.rules:1"}},
+		{"size units and arithmetic", `size == 3MB && size / 1MB * 2 - 1 == 5 && size % 2 == 0 => skip()`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Skip: true, Reason: "skipped by rule"}},
+		{"lists and in", `ext in [".doc", ".pdf"] && !(ext in [".txt"]) => skip()`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Skip: true, Reason: "skipped by rule"}},
+		{"string functions", `true => name(upper(replace(trim("  a-b "), "-", "_")) + str(len(base)) + date(mod_time, "20060102") + str(month(mod_time)) + str(day(mod_time)))`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Name: "A_B62024030737"}},
+		{"ternary", `true => name(size > 1GB ? "big" : "small")`, nil, Decision{Matched: true, Rule: "test.rules:1", Name: "small"}},
+		{"matches and int", `matches(base, "^Rep") && int("42") == 42 && contains(name, "port") && hassuffix(name, ".PDF") => skip()`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Skip: true, Reason: "skipped by rule"}},
+		{"taken_at falls back to mod_time", `year(taken_at) == 2024 && camera_model == "" && width == 0 => skip()`, nil,
+			Decision{Matched: true, Rule: "test.rules:1", Skip: true, Reason: "skipped by rule"}},
+		{"photo metadata", `year(taken_at) == 2019 && camera_make == "Apple" && width > height && duration == 3 => name(camera_model + ext)`,
+			func(f *File) {
+				f.TakenAt = time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+				f.CameraMake, f.CameraModel = "Apple", "iPhone"
+				f.Width, f.Height, f.Duration = 4032, 3024, 2.6
+			},
+			Decision{Matched: true, Rule: "test.rules:1", Name: "iPhone.pdf"}},
+		{"fixed extension and mime", `ext == ".png" && mime == "image/png" => name(base + ext)`,
+			func(f *File) { f.Path, f.Ext, f.MimeType = "/data/picture", ".png", "image/png" },
+			Decision{Matched: true, Rule: "test.rules:1", Name: "picture.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Parse("test.rules", tt.src)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			f := testFile()
+			if tt.file != nil {
+				tt.file(&f)
+			}
+			got, err := set.Evaluate(f, testCounter{})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`size + "x" == "" => skip()`, `test.rules:1:6: cannot apply + to int and string`},
+		{`name => skip()`, `expected bool, got string`},
+		{`size / 0 > 1 => skip()`, `division by zero`},
+		{`true => name(size)`, `expected string, got int`},
+		{`true => name("a/b")`, `must not contain path separators`},
+		{`true => name("..")`, `invalid file name ".."`},
+		{`true => dir("../out")`, `leaves the scan root`},
+		{`true => dir("/abs")`, `must be relative to the scan root`},
+		{`int(name) == 1 => skip()`, `int(): "Report.PDF" is not a number`},
+		{`true => name(pad(1, 100))`, `width must be between 0 and 64`},
+		{`-name == "" => skip()`, `cannot apply - to string`},
+	}
+	for _, tt := range tests {
+		set, err := Parse("test.rules", tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		_, err = set.Evaluate(testFile(), testCounter{})
+		if err == nil {
+			t.Errorf("Evaluate(%q) succeeded, want error %q", tt.src, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Evaluate(%q) = %q, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestCompoundExtensions(t *testing.T) {
+	set, err := Parse("test.rules", "ext == \".tar.gz\" => name(base + \"-\" + pad(seq(\"backup\"), 2) + ext)\ntrue => name(base + \"!\" + ext)")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	tests := []struct {
+		name     string
+		path     string
+		base     string
+		ext      string
+		wantName string
+	}{
+		{"compound extension counts as one", "/data/backup.tar.gz", "backup", ".tar.gz", "backup-01.tar.gz"},
+		{"upper-case compound extension is lowered", "/data/DB.TAR.GZ", "DB", ".TAR.GZ", "DB-01.tar.gz"},
+		{"without Base and Ext only the last extension counts", "/data/backup.tar.gz", "", "", "backup.tar!.gz"},
+		{"dotted base name", "/data/v1.2.tar.gz", "v1.2", ".tar.gz", "v1.2-01.tar.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testFile()
+			f.Path, f.Base, f.Ext = tt.path, tt.base, tt.ext
+			d, err := set.Evaluate(f, testCounter{})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if d.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", d.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestSeqCountsPerName(t *testing.T) {
+	set, err := Parse("test.rules", `true => name(str(seq("a")) + "-" + str(seq("b")) + "-" + str(seq("a")))`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	counter := testCounter{}
+	for _, want := range []string{"1-1-2", "3-2-4"} {
+		d, err := set.Evaluate(testFile(), counter)
+		if err != nil {
+			t.Fatalf("Evaluate: %v", err)
+		}
+		if d.Name != want {
+			t.Errorf("name = %q, want %q", d.Name, want)
+		}
+	}
+	// seq() cần bộ đếm
+	if _, err := set.Evaluate(testFile(), nil); err == nil || !strings.Contains(err.Error(), "no counter available") {
+		t.Errorf("Evaluate without counter = %v, want no counter error", err)
+	}
+}
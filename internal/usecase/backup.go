@@ -0,0 +1,49 @@
+// Business logic for database backups
+package usecase
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/infrastructure"
+)
+
+// BackupDatabase tạo một bản backup mới trong BackupDir và xoay vòng các bản cũ
+func BackupDatabase(config config.Config, db *infrastructure.Database) (string, error) {
+	if config.BackupDir == "" {
+		return "", fmt.Errorf("backup directory is not configured")
+	}
+	if err := os.MkdirAll(config.BackupDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	path := filepath.Join(config.BackupDir, infrastructure.BackupFileName(time.Now()))
+	if err := db.Backup(path); err != nil {
+		return "", err
+	}
+	removed, err := infrastructure.RotateBackups(config.BackupDir, config.BackupKeep)
+	if err != nil {
+		slog.Error("backup rotation failed", "dir", config.BackupDir, "error", err)
+	}
+	for _, name := range removed {
+		slog.Info("old backup removed", "file", name)
+	}
+	return path, nil
+}
+
+// StartBackupScheduler sao lưu database định kỳ theo BackupInterval
+func StartBackupScheduler(config config.Config, db *infrastructure.Database) {
+	slog.Info("backup scheduler initialized", "interval", config.BackupInterval, "dir", config.BackupDir, "keep", config.BackupKeep)
+	ticker := time.NewTicker(config.BackupInterval)
+	for range ticker.C {
+		path, err := BackupDatabase(config, db)
+		if err != nil {
+			slog.Error("scheduled backup failed", "error", err)
+			continue
+		}
+		slog.Info("backup created", "path", path)
+	}
+}
@@ -0,0 +1,77 @@
+// Name collisions: pick another target instead of overwriting an existing file
+package usecase
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// collisionErrorPrefix mở đầu lý do bỏ qua hoặc lỗi khi đích đổi tên đã có file
+const collisionErrorPrefix = "name collision"
+
+// maxCollisionAttempts giới hạn số tên thử cho một file trước khi báo lỗi
+const maxCollisionAttempts = 1000
+
+var nameCollisions = infrastructure.Metrics.NewCounterVec(
+	"auto_rename_name_collisions_total",
+	"Renames whose target name was already taken, by root and collision policy.",
+	"root", "policy")
+
+// avoidCollision trả về target nếu đích còn trống, nếu không thì chọn đích khác
+// theo config.CollisionPolicy; đích của các file đi kèm trong group (nếu có)
+// cũng phải còn trống. collisions là số đích đã bị chiếm gặp phải; skip
+// khác rỗng là lý do bỏ qua file; err bọc infrastructure.ErrTargetExists khi
+// chính sách là fail hoặc không tìm được tên trống.
+func avoidCollision(config config.Config, run runInfo, path string, size int64, content fileContent, group *renameGroup, target ruleTarget, logger *slog.Logger) (_ ruleTarget, collisions int, skip string, err error) {
+	policy := config.CollisionPolicy
+	base, suffix := target, 0
+	for {
+		taken, err := takenTarget(config, target, group)
+		if err != nil {
+			return target, collisions, "", err
+		}
+		if taken == "" {
+			return target, collisions, "", nil
+		}
+		collisions++
+		logger.Info("name collision", "path", path, "target", taken, "policy", policy)
+		switch {
+		case policy == domain.CollisionSkip:
+			return target, collisions, fmt.Sprintf("%s: %s exists", collisionErrorPrefix, taken), nil
+		case policy == domain.CollisionFail:
+			return target, collisions, "", fmt.Errorf("%s: %w: %s", collisionErrorPrefix, infrastructure.ErrTargetExists, taken)
+		case collisions > maxCollisionAttempts:
+			return target, collisions, "", fmt.Errorf("%s: %w: no free name for %s after %d attempts",
+				collisionErrorPrefix, infrastructure.ErrTargetExists, base.Path, maxCollisionAttempts)
+		}
+
+		if policy == domain.CollisionRegenerate {
+			// UUID mới giữ đuôi của tên đích đầu tiên, tức đuôi đã sửa theo nội dung
+			next, planSkip, _, err := planTarget(config, run, path, GenerateUUIDName(config, base.Name), size, content, logger)
+			if err != nil || planSkip != "" {
+				return target, collisions, planSkip, err
+			}
+			if next.Path != target.Path {
+				target = next
+				continue
+			}
+			// Luật cho ra tên cố định: tạo lại vô ích, chuyển sang thêm hậu tố
+			policy = domain.CollisionSuffix
+		}
+		suffix++
+		target = suffixTarget(config, base, suffix)
+	}
+}
+
+// suffixTarget thêm "-n" vào trước đuôi file (kể cả đuôi ghép) của tên đích
+func suffixTarget(config config.Config, target ruleTarget, n int) ruleTarget {
+	name, ext := splitExt(config, target.Name)
+	target.Name = fmt.Sprintf("%s-%d%s", name, n, ext)
+	target.Path = filepath.Join(filepath.Dir(target.Path), target.Name)
+	return target
+}
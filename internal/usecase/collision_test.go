@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+	"auto-rename/internal/rules"
+)
+
+func TestAvoidCollision(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		target     string
+		existing   []string
+		wantName   string
+		wantSkip   bool
+		wantErr    bool
+		collisions int
+	}{
+		{"free target is kept", domain.CollisionSuffix, "a.txt", nil, "a.txt", false, false, 0},
+		{"skip", domain.CollisionSkip, "a.txt", []string{"a.txt"}, "a.txt", true, false, 1},
+		{"fail", domain.CollisionFail, "a.txt", []string{"a.txt"}, "a.txt", false, true, 1},
+		{"suffix", domain.CollisionSuffix, "a.txt", []string{"a.txt"}, "a-1.txt", false, false, 1},
+		{"suffix skips taken suffixes", domain.CollisionSuffix, "a.txt", []string{"a.txt", "a-1.txt", "a-2.txt"}, "a-3.txt", false, false, 3},
+		{"suffix before compound extension", domain.CollisionSuffix, "a.tar.gz", []string{"a.tar.gz"}, "a-1.tar.gz", false, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.existing {
+				writeTestFile(t, dir, name, "taken")
+			}
+			db := newTestDatabase(t)
+			cfg := config.Config{Dir: dir, CollisionPolicy: tt.policy, CompoundExtensions: []string{".tar.gz"}}
+			path := writeTestFile(t, dir, "source", "new")
+			target := ruleTarget{Name: tt.target, Path: filepath.Join(dir, tt.target)}
+			got, collisions, skip, err := avoidCollision(cfg, testRun(cfg, db), path, 3, fileContent{Name: "source"}, nil, target, discardLogger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, infrastructure.ErrTargetExists) {
+				t.Errorf("err = %v, want ErrTargetExists", err)
+			}
+			if (skip != "") != tt.wantSkip {
+				t.Errorf("skip = %q, want skip %v", skip, tt.wantSkip)
+			}
+			if skip != "" && !strings.HasPrefix(skip, collisionErrorPrefix) {
+				t.Errorf("skip = %q, want %s prefix", skip, collisionErrorPrefix)
+			}
+			if got.Name != tt.wantName || got.Path != filepath.Join(dir, tt.wantName) {
+				t.Errorf("target = %s (%s), want %s", got.Name, got.Path, tt.wantName)
+			}
+			if collisions != tt.collisions {
+				t.Errorf("collisions = %d, want %d", collisions, tt.collisions)
+			}
+		})
+	}
+}
+
+func TestAvoidCollisionRegenerate(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	cfg := config.Config{Dir: dir, CollisionPolicy: domain.CollisionRegenerate, CompoundExtensions: []string{".tar.gz"}}
+	taken := "0f8fad5b-d9cb-469f-a165-70867728950e.tar.gz"
+	writeTestFile(t, dir, taken, "taken")
+	path := writeTestFile(t, dir, "backup.tar.gz", "new")
+
+	target := ruleTarget{Name: taken, Path: filepath.Join(dir, taken)}
+	got, collisions, skip, err := avoidCollision(cfg, testRun(cfg, db), path, 3, fileContent{Name: "backup.tar.gz"}, nil, target, discardLogger)
+	if err != nil || skip != "" {
+		t.Fatalf("avoidCollision: skip %q, err %v", skip, err)
+	}
+	if collisions != 1 || got.Name == taken || !LooksLikeUUID(cfg, got.Name) || !strings.HasSuffix(got.Name, ".tar.gz") {
+		t.Errorf("target = %s after %d collisions, want a new UUID name with .tar.gz after 1", got.Name, collisions)
+	}
+}
+
+func TestAvoidCollisionRegenerateFixedRuleName(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	set, err := rules.Parse("rules", `true => name("fixed.txt")`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	cfg := config.Config{Dir: dir, Rules: set, CollisionPolicy: domain.CollisionRegenerate}
+	writeTestFile(t, dir, "fixed.txt", "taken")
+	writeTestFile(t, dir, "fixed-1.txt", "taken")
+	path := writeTestFile(t, dir, "a.txt", "new")
+
+	// Luật luôn cho cùng tên nên tạo lại không giúp được: chuyển sang thêm hậu tố
+	target := ruleTarget{Name: "fixed.txt", Path: filepath.Join(dir, "fixed.txt"), Rule: "rules:1"}
+	got, collisions, skip, err := avoidCollision(cfg, testRun(cfg, db), path, 3, fileContent{Name: "a.txt"}, nil, target, discardLogger)
+	if err != nil || skip != "" {
+		t.Fatalf("avoidCollision: skip %q, err %v", skip, err)
+	}
+	if got.Name != "fixed-2.txt" || collisions != 2 {
+		t.Errorf("target = %s after %d collisions, want fixed-2.txt after 2", got.Name, collisions)
+	}
+}
+
+func TestAvoidCollisionGivesUp(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	cfg := config.Config{Dir: dir, CollisionPolicy: domain.CollisionSuffix}
+	writeTestFile(t, dir, "a.txt", "taken")
+	for i := 1; i <= maxCollisionAttempts; i++ {
+		writeTestFile(t, dir, fmt.Sprintf("a-%d.txt", i), "taken")
+	}
+	path := writeTestFile(t, dir, "source", "new")
+
+	target := ruleTarget{Name: "a.txt", Path: filepath.Join(dir, "a.txt")}
+	_, collisions, _, err := avoidCollision(cfg, testRun(cfg, db), path, 3, fileContent{Name: "source"}, nil, target, discardLogger)
+	if !errors.Is(err, infrastructure.ErrTargetExists) || !strings.Contains(err.Error(), fmt.Sprintf("after %d attempts", maxCollisionAttempts)) {
+		t.Errorf("err = %v, want no free name after %d attempts", err, maxCollisionAttempts)
+	}
+	if collisions != maxCollisionAttempts+1 {
+		t.Errorf("collisions = %d, want %d", collisions, maxCollisionAttempts+1)
+	}
+}
+
+func TestAvoidCollisionGroup(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	cfg := config.Config{Dir: dir, CollisionPolicy: domain.CollisionSuffix, SidecarExtensions: []string{".xmp"}}
+	path := writeTestFile(t, dir, "IMG.CR2", "raw")
+	sidecar := writeTestFile(t, dir, "IMG.xmp", "xmp")
+	// Chỉ đích của file đi kèm đã có file: cả nhóm lấy tên có hậu tố
+	writeTestFile(t, dir, "new.xmp", "taken")
+	group := &renameGroup{LeaderExt: ".CR2", Members: []groupMember{{Path: sidecar, Content: fileContent{Name: "IMG.xmp"}, prefix: 3}}}
+
+	target := ruleTarget{Name: "new.CR2", Path: filepath.Join(dir, "new.CR2")}
+	got, collisions, _, err := avoidCollision(cfg, testRun(cfg, db), path, 3, fileContent{Name: "IMG.CR2"}, group, target, discardLogger)
+	if err != nil {
+		t.Fatalf("avoidCollision: %v", err)
+	}
+	if got.Name != "new-1.CR2" || collisions != 1 {
+		t.Errorf("target = %s after %d collisions, want new-1.CR2 after 1", got.Name, collisions)
+	}
+	if paths := group.memberPaths(cfg, got); len(paths) != 1 || paths[0] != filepath.Join(dir, "new-1.xmp") {
+		t.Errorf("member paths = %v, want new-1.xmp", paths)
+	}
+}
@@ -0,0 +1,97 @@
+// Event bus for scan lifecycle and per-file events
+package usecase
+
+import (
+	"sync"
+	"time"
+)
+
+// Các loại event phát ra trong một lượt quét
+const (
+	EventRunStarted  = "run-started"
+	EventFileRenamed = "file-renamed"
+	EventFileSkipped = "file-skipped"
+	EventFileFailed  = "file-failed"
+	EventFileQueued  = "file-queued"
+	EventRunFinished = "run-finished"
+)
+
+// Event là một sự kiện của lượt quét; File có với event theo file, Summary có với run-finished
+type Event struct {
+	Type    string      `json:"type"`
+	RunID   string      `json:"run_id"`
+	Root    string      `json:"root"`
+	Time    string      `json:"time"`
+	DryRun  bool        `json:"dry_run,omitempty"`
+	File    *FileResult `json:"file,omitempty"`
+	Summary *RunSummary `json:"summary,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// EventBus phân phát event tới các subscriber. Publish không bao giờ chặn:
+// subscriber đọc chậm sẽ bị bỏ event khi buffer đầy.
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// Events là event bus dùng chung của ứng dụng
+var Events = NewEventBus()
+
+// NewEventBus tạo event bus rỗng
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe đăng ký nhận event, trả về channel và hàm hủy đăng ký
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish gửi event tới mọi subscriber
+func (b *EventBus) Publish(e Event) {
+	if e.Time == "" {
+		e.Time = time.Now().Format(time.RFC3339)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publishEvent phát event của lượt quét: webhook nhận trước và đồng bộ để không
+// mất lần gửi nào, sau đó tới event bus (có thể bỏ event cho subscriber chậm)
+func publishEvent(e Event) {
+	notifyWebhooks(e)
+	Events.Publish(e)
+}
+
+// fileEventType chuyển trạng thái kết quả sang loại event tương ứng
+func fileEventType(status string) string {
+	switch status {
+	case StatusRenamed:
+		return EventFileRenamed
+	case StatusSkipped:
+		return EventFileSkipped
+	case StatusQueued:
+		return EventFileQueued
+	default:
+		return EventFileFailed
+	}
+}
@@ -0,0 +1,84 @@
+// Extension fixes: correct file extensions from the detected content type
+package usecase
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// splitExt tách tên file thành phần tên và đuôi. Đuôi ghép trong
+// config.CompoundExtensions (vd .tar.gz) được tính là một đuôi; đuôi giữ nguyên
+// hoa thường như trong tên.
+func splitExt(config config.Config, name string) (base, ext string) {
+	lower := strings.ToLower(name)
+	for _, compound := range config.CompoundExtensions {
+		if len(name) > len(compound) && strings.HasSuffix(lower, compound) {
+			return name[:len(name)-len(compound)], name[len(name)-len(compound):]
+		}
+	}
+	ext = filepath.Ext(name)
+	return name[:len(name)-len(ext)], ext
+}
+
+// fixExtension trả về name với đuôi đã sửa theo config.ExtensionFixes và loại
+// file nhận ra từ nội dung. mismatch cho biết đuôi gốc không khớp nội dung,
+// kể cả khi không được bật sửa.
+func fixExtension(config config.Config, name string, fileType infrastructure.FileType) (fixed string, mismatch bool) {
+	base, ext := splitExt(config, name)
+	// Nội dung chỉ cho biết phần cuối của đuôi ghép: .tar.gz là file gzip
+	mismatch = ext != "" && !fileType.MatchesExt(filepath.Ext(ext))
+	switch {
+	case ext == "" && config.FixesExtension(domain.ExtFixMissing):
+		ext = fileType.Ext()
+	case mismatch && config.FixesExtension(domain.ExtFixMismatch):
+		ext = fileType.Ext()
+	case config.FixesExtension(domain.ExtFixCase):
+		ext = strings.ToLower(ext)
+	}
+	return base + ext, mismatch
+}
+
+// fileContent là những gì đọc được từ nội dung file khi quét
+type fileContent struct {
+	Type infrastructure.FileType
+	// Name là tên file với đuôi đã sửa theo config.ExtensionFixes
+	Name string
+	// Mismatch cho biết đuôi gốc không khớp nội dung
+	Mismatch bool
+	// Metadata là metadata ảnh/video, nil khi không có
+	Metadata *domain.FileMetadata
+}
+
+// inspectFile nhận loại file từ nội dung, sửa đuôi tên file theo cấu hình và
+// đọc metadata ảnh/video. File không đọc được (vd thiếu quyền đọc) vẫn đổi tên
+// được, chỉ không có loại file và metadata.
+func inspectFile(config config.Config, path string, logger *slog.Logger) fileContent {
+	fileType, err := infrastructure.SniffFile(path)
+	if err != nil {
+		logger.Debug("content sniffing failed", "path", path, "error", err)
+	}
+	content := fileContent{Type: fileType}
+	content.Name, content.Mismatch = fixExtension(config, filepath.Base(path), fileType)
+	if content.Mismatch {
+		logger.Info("extension does not match content", "path", path, "mime_type", fileType.MIME, "fixed_name", content.Name)
+	}
+	if m, ok := infrastructure.ReadMediaMetadata(path, fileType); ok {
+		content.Metadata = &m
+	}
+	return content
+}
+
+// takenAt trả về thời điểm chụp trong metadata, ok false khi không có
+func (c fileContent) takenAt() (t time.Time, ok bool) {
+	if c.Metadata == nil || c.Metadata.TakenAt == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, c.Metadata.TakenAt)
+	return t, err == nil
+}
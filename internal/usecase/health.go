@@ -0,0 +1,259 @@
+// Health, readiness and cron liveness checks
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/infrastructure"
+)
+
+// CronInterval là chu kỳ quét của cron scanner
+const CronInterval = time.Minute
+
+// healthCheckTimeout giới hạn thời gian của mỗi kiểm tra
+const healthCheckTimeout = 2 * time.Second
+
+// Trạng thái của một kiểm tra sức khỏe
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// cronState lưu nhịp của vòng lặp cron để kiểm tra liveness
+type cronState struct {
+	mu        sync.Mutex
+	enabled   bool
+	startedAt time.Time
+	lastTick  time.Time
+	lastRun   time.Time
+	running   bool
+	// lastProgress là lần gần nhất lượt quét cron đang chạy xử lý xong một file
+	lastProgress time.Time
+}
+
+var cron cronState
+
+func (c *cronState) start(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = true
+	c.startedAt = now
+}
+
+func (c *cronState) tick(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastTick = now
+	c.running = true
+}
+
+func (c *cronState) finish(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRun = now
+	c.running = false
+}
+
+// progress ghi nhịp từ lượt quét cron đang chạy, để lượt quét dài hơn giới hạn
+// liveness không bị coi là treo khi vẫn đang xử lý file
+func (c *cronState) progress(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		c.lastProgress = now
+	}
+}
+
+// lastBeat là lần gần nhất vòng lặp còn chạy: lúc khởi động, tick cuối hoặc
+// file cuối cùng lượt quét đang chạy xử lý xong
+func (c *cronState) lastBeat() time.Time {
+	beat := c.startedAt
+	if c.lastTick.After(beat) {
+		beat = c.lastTick
+	}
+	if c.running && c.lastProgress.After(beat) {
+		beat = c.lastProgress
+	}
+	return beat
+}
+
+// CronStatus là trạng thái cron scanner trả về cho dashboard
+type CronStatus struct {
+	Enabled   bool   `json:"enabled"`
+	Interval  string `json:"interval"`
+	IsRunning bool   `json:"is_running"`
+	LastTick  string `json:"last_tick,omitempty"`
+	LastRun   string `json:"last_run,omitempty"`
+	NextRun   string `json:"next_run,omitempty"`
+}
+
+// GetCronStatus trả về trạng thái hiện tại của cron scanner
+func GetCronStatus() CronStatus {
+	cron.mu.Lock()
+	defer cron.mu.Unlock()
+	status := CronStatus{Enabled: cron.enabled, Interval: CronInterval.String(), IsRunning: cron.running}
+	if !cron.enabled {
+		return status
+	}
+	if !cron.lastTick.IsZero() {
+		status.LastTick = cron.lastTick.Format(time.RFC3339)
+	}
+	if !cron.lastRun.IsZero() {
+		status.LastRun = cron.lastRun.Format(time.RFC3339)
+	}
+	if !cron.running {
+		status.NextRun = cron.lastBeat().Add(CronInterval).Format(time.RFC3339)
+	}
+	return status
+}
+
+// CheckResult là kết quả một kiểm tra, kèm thời gian thực hiện
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthReport tổng hợp các kiểm tra; Status là fail nếu có kiểm tra lỗi
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// OK cho biết mọi kiểm tra đều đạt
+func (h HealthReport) OK() bool {
+	return h.Status == HealthOK
+}
+
+// runChecks chạy từng kiểm tra và đo thời gian
+func runChecks(checks []namedCheck) HealthReport {
+	report := HealthReport{Status: HealthOK, Checks: make([]CheckResult, 0, len(checks))}
+	for _, c := range checks {
+		start := time.Now()
+		err := c.fn()
+		result := CheckResult{Name: c.name, Status: HealthOK, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+		if err != nil {
+			result.Status, result.Error = HealthFail, err.Error()
+			report.Status = HealthFail
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+type namedCheck struct {
+	name string
+	fn   func() error
+}
+
+// Liveness kiểm tra tiến trình còn sống; khi bật cron thì vòng lặp cron phải
+// tick trong vòng LivenessIntervals chu kỳ
+func Liveness(config config.Config) HealthReport {
+	checks := []namedCheck{{"process", func() error { return nil }}}
+	if config.Cron {
+		checks = append(checks, namedCheck{"scanner", func() error { return checkCronLiveness(config, time.Now()) }})
+	}
+	return runChecks(checks)
+}
+
+func checkCronLiveness(config config.Config, now time.Time) error {
+	return cron.checkLiveness(config, now)
+}
+
+func (c *cronState) checkLiveness(config config.Config, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return errors.New("cron loop has not started")
+	}
+	limit := time.Duration(config.LivenessIntervals) * CronInterval
+	if since := now.Sub(c.lastBeat()); since > limit {
+		return fmt.Errorf("cron loop has not ticked for %s (limit %s)", since.Round(time.Second), limit)
+	}
+	return nil
+}
+
+// Readiness kiểm tra DB truy cập được, schema đã migrate và các thư mục theo
+// dõi đọc ghi được. Lỗi không chứa đường dẫn vì endpoint không cần đăng nhập.
+func Readiness(config config.Config, db *infrastructure.Database) HealthReport {
+	checks := []namedCheck{
+		{"database", func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+			defer cancel()
+			if err := db.Ping(ctx); err != nil {
+				return errors.New("database not reachable")
+			}
+			return nil
+		}},
+		{"migrations", func() error {
+			version, err := db.SchemaVersion()
+			if err != nil {
+				return errors.New("cannot read schema version")
+			}
+			if version != infrastructure.SchemaVersion {
+				return fmt.Errorf("schema version %d, expected %d", version, infrastructure.SchemaVersion)
+			}
+			return nil
+		}},
+	}
+	for _, d := range watchedDirs(config) {
+		dir := d.dir
+		checks = append(checks, namedCheck{"directory:" + d.name, func() error { return checkDirWritable(dir) }})
+	}
+	return runChecks(checks)
+}
+
+type watchedDir struct {
+	name string
+	dir  string
+}
+
+// watchedDirs trả về thư mục chính và thư mục của các profile
+func watchedDirs(config config.Config) []watchedDir {
+	var dirs []watchedDir
+	if config.Dir != "" {
+		dirs = append(dirs, watchedDir{"dir", config.Dir})
+	}
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dirs = append(dirs, watchedDir{"profile:" + name, config.Profiles[name].Dir})
+	}
+	return dirs
+}
+
+// checkDirWritable kiểm tra thư mục tồn tại và tiến trình có quyền ghi vào đó
+func checkDirWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.New("not accessible")
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return errors.New("not readable")
+	}
+	_, err = f.ReadDir(1)
+	f.Close()
+	if err != nil && err != io.EOF {
+		return errors.New("not readable")
+	}
+	if !infrastructure.DirWritable(dir) {
+		return errors.New("not writable")
+	}
+	return nil
+}
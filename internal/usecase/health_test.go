@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"auto-rename/internal/config"
+)
+
+func TestCronLiveness(t *testing.T) {
+	cfg := config.Config{LivenessIntervals: 3}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		state   func(c *cronState)
+		now     time.Duration
+		wantErr bool
+	}{
+		{"not started", func(c *cronState) {}, 0, true},
+		{"just started", func(c *cronState) { c.start(start) }, time.Minute, false},
+		{"no tick", func(c *cronState) { c.start(start) }, 4 * time.Minute, true},
+		{"idle after scan", func(c *cronState) {
+			c.start(start)
+			c.tick(start.Add(time.Minute))
+			c.finish(start.Add(time.Minute))
+		}, 3 * time.Minute, false},
+		{"long scan finishing files", func(c *cronState) {
+			c.start(start)
+			c.tick(start.Add(time.Minute))
+			c.progress(start.Add(9 * time.Minute))
+		}, 10 * time.Minute, false},
+		{"long scan stuck", func(c *cronState) {
+			c.start(start)
+			c.tick(start.Add(time.Minute))
+			c.progress(start.Add(2 * time.Minute))
+		}, 10 * time.Minute, true},
+		{"progress after scan is ignored", func(c *cronState) {
+			c.start(start)
+			c.tick(start.Add(time.Minute))
+			c.finish(start.Add(time.Minute))
+			c.progress(start.Add(9 * time.Minute))
+		}, 10 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c cronState
+			tt.state(&c)
+			err := c.checkLiveness(cfg, start.Add(tt.now))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkLiveness() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Hook commands run around renames and scan runs
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/infrastructure"
+	"auto-rename/internal/rules"
+)
+
+// Các thời điểm chạy hook
+const (
+	HookPreRename  = "pre-rename"
+	HookPostRename = "post-rename"
+	HookRunStart   = "run-start"
+	HookRunEnd     = "run-end"
+)
+
+// hookVetoPrefix mở đầu lý do bỏ qua file khi pre-rename hook từ chối
+const hookVetoPrefix = "vetoed by pre-rename hook"
+
+// maxHookMessage giới hạn độ dài thông báo lỗi của hook trong lý do bỏ qua
+const maxHookMessage = 200
+
+var hookRuns = infrastructure.Metrics.NewCounterVec(
+	"auto_rename_hook_runs_total",
+	"Hook commands executed, by stage and result (ok, failed).",
+	"stage", "result")
+
+// runInfo xác định lượt quét đang chạy, truyền cho hook và luật đặt tên
+type runInfo struct {
+	ID      string
+	Root    string
+	Trigger string
+	// Counter cấp số seq() cho luật, dùng chung trong cả lượt quét
+	Counter rules.Counter
+	// Sidecars nhớ nhóm file đi kèm theo thư mục; nil là đọc lại thư mục mỗi lần
+	Sidecars *sidecarIndex
+	// Targets nhớ đích đổi tên của lượt quét, nil khi không cần
+	Targets *targetSet
+}
+
+// HookFile mô tả file được đổi tên trong payload của hook
+type HookFile struct {
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path"`
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name"`
+	Size    int64  `json:"size"`
+	Status  string `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HookPayload là JSON ghi vào stdin của hook. File có với pre-rename và
+// post-rename, Summary với run-end.
+type HookPayload struct {
+	Hook    string      `json:"hook"`
+	RunID   string      `json:"run_id"`
+	Root    string      `json:"root"`
+	Trigger string      `json:"trigger"`
+	File    *HookFile   `json:"file,omitempty"`
+	Summary *RunSummary `json:"summary,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+func newHookPayload(hook string, run runInfo) HookPayload {
+	return HookPayload{Hook: hook, RunID: run.ID, Root: run.Root, Trigger: run.Trigger}
+}
+
+// env trả về biến môi trường AUTO_RENAME_* tương ứng với payload
+func (p HookPayload) env() []string {
+	env := []string{
+		"AUTO_RENAME_HOOK=" + p.Hook,
+		"AUTO_RENAME_RUN_ID=" + p.RunID,
+		"AUTO_RENAME_ROOT=" + p.Root,
+		"AUTO_RENAME_TRIGGER=" + p.Trigger,
+	}
+	if f := p.File; f != nil {
+		env = append(env,
+			"AUTO_RENAME_OLD_PATH="+f.OldPath,
+			"AUTO_RENAME_NEW_PATH="+f.NewPath,
+			"AUTO_RENAME_OLD_NAME="+f.OldName,
+			"AUTO_RENAME_NEW_NAME="+f.NewName,
+			"AUTO_RENAME_FILE_SIZE="+strconv.FormatInt(f.Size, 10),
+		)
+		if f.Status != "" {
+			env = append(env, "AUTO_RENAME_STATUS="+f.Status)
+		}
+		if f.Error != "" {
+			env = append(env, "AUTO_RENAME_ERROR="+f.Error)
+		}
+	}
+	if s := p.Summary; s != nil {
+		env = append(env,
+			"AUTO_RENAME_SEEN="+strconv.Itoa(s.Seen),
+			"AUTO_RENAME_RENAMED="+strconv.Itoa(s.Renamed),
+			"AUTO_RENAME_SKIPPED="+strconv.Itoa(s.Skipped),
+			"AUTO_RENAME_FAILED="+strconv.Itoa(s.Failed),
+			"AUTO_RENAME_QUEUED="+strconv.Itoa(s.Queued),
+			"AUTO_RENAME_COLLISIONS="+strconv.Itoa(s.Collisions),
+			"AUTO_RENAME_FOREIGN="+strconv.Itoa(s.Foreign),
+			"AUTO_RENAME_SIDECARS="+strconv.Itoa(s.Sidecars),
+		)
+	}
+	if p.Error != "" {
+		env = append(env, "AUTO_RENAME_ERROR="+p.Error)
+	}
+	return env
+}
+
+// runHooks chạy lần lượt các lệnh của một thời điểm và dừng ở lệnh lỗi đầu
+// tiên. Lỗi gồm tên hook, nguyên nhân và dòng output cuối của lệnh.
+func runHooks(hooks []config.HookCommand, p HookPayload, logger *slog.Logger) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	stdin, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	env := p.env()
+	for _, h := range hooks {
+		ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+		start := time.Now()
+		stdout, stderr, err := infrastructure.RunShellCommand(ctx, h.Command, env, stdin)
+		cancel()
+		logger.Debug("hook finished", "stage", p.Hook, "hook", h.Name,
+			"duration_ms", time.Since(start).Milliseconds(), "stdout", stdout, "stderr", stderr, "error", err)
+		if err != nil {
+			hookRuns.Inc(p.Hook, "failed")
+			if msg := lastLine(stderr, stdout); msg != "" {
+				return fmt.Errorf("%s: %v: %s", h.Name, err, msg)
+			}
+			return fmt.Errorf("%s: %v", h.Name, err)
+		}
+		hookRuns.Inc(p.Hook, "ok")
+	}
+	return nil
+}
+
+// renameWithHooks chạy pre-rename hook, đổi tên rồi chạy post-rename hook.
+// strategy là cách file được chuyển (rename hoặc copy); veto khác rỗng là lý do
+// pre-rename hook từ chối (file không bị đổi tên); err là lỗi đổi tên. Lỗi của
+// post-rename hook chỉ được log vì file đã đổi tên.
+func renameWithHooks(config config.Config, run runInfo, metricsRoot, oldPath, newPath string, size int64, logger *slog.Logger) (strategy, veto string, err error) {
+	file := &HookFile{
+		OldPath: oldPath,
+		NewPath: newPath,
+		OldName: filepath.Base(oldPath),
+		NewName: filepath.Base(newPath),
+		Size:    size,
+	}
+	pre := newHookPayload(HookPreRename, run)
+	pre.File = file
+	if hookErr := runHooks(config.Hooks.PreRename, pre, logger); hookErr != nil {
+		logger.Info("rename vetoed by hook", "path", oldPath, "reason", hookErr)
+		return "", hookVetoPrefix + " " + hookErr.Error(), nil
+	}
+
+	strategy, err = timedRename(metricsRoot, oldPath, newPath)
+	if err == nil && strategy == infrastructure.MoveCopy {
+		logger.Info("file copied across file systems", "path", oldPath, "new_path", newPath)
+	}
+	post := newHookPayload(HookPostRename, run)
+	post.File = file
+	file.Status = StatusRenamed
+	if err != nil {
+		file.Status, file.Error = StatusFailed, err.Error()
+	}
+	if hookErr := runHooks(config.Hooks.PostRename, post, logger); hookErr != nil {
+		logger.Warn("post-rename hook failed", "path", oldPath, "error", hookErr)
+	}
+	return strategy, "", err
+}
+
+// lastLine trả về dòng cuối khác rỗng của output đầu tiên có nội dung, cắt ngắn
+func lastLine(outputs ...string) string {
+	for _, out := range outputs {
+		if out == "" {
+			continue
+		}
+		lines := strings.Split(out, "\n")
+		line := strings.TrimSpace(lines[len(lines)-1])
+		if len(line) > maxHookMessage {
+			line = line[:maxHookMessage] + "…"
+		}
+		return line
+	}
+	return ""
+}
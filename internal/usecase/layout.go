@@ -0,0 +1,62 @@
+// Folder layouts: move renamed files into a sharded or date-based tree
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// layoutErrorPrefix mở đầu lý do lỗi khi không tính được thư mục layout
+const layoutErrorPrefix = "layout"
+
+// layoutRoot trả về thư mục gốc của cây layout
+func layoutRoot(config config.Config) string {
+	if config.LayoutDir != "" {
+		return config.LayoutDir
+	}
+	return config.Dir
+}
+
+// layoutPath trả về đường dẫn đích của file có tên mới newName trong cây layout,
+// vd <root>/ab/cd/<uuid>.ext hoặc <root>/2026/10/16/<uuid>.ext. Layout theo
+// ngày dùng thời điểm chụp trong metadata, nếu không có thì thời điểm sửa file.
+func layoutPath(config config.Config, path, newName string, content fileContent) (string, error) {
+	var sub string
+	switch config.Layout {
+	case domain.LayoutUUID:
+		key := strings.ToLower(newName)
+		// Tên do luật đặt không có dạng UUID: chia theo hash của tên cho đều
+		if !LooksLikeUUID(config, newName) {
+			sum := sha256.Sum256([]byte(newName))
+			key = hex.EncodeToString(sum[:])
+		}
+		sub = filepath.Join(key[:2], key[2:4])
+	case domain.LayoutHash:
+		sum, err := infrastructure.HashFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: hash: %w", layoutErrorPrefix, err)
+		}
+		sub = filepath.Join(sum[:2], sum[2:4])
+	case domain.LayoutDate:
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", layoutErrorPrefix, err)
+		}
+		t := info.ModTime()
+		if taken, ok := content.takenAt(); ok {
+			t = taken
+		}
+		sub = filepath.Join(t.Format("2006"), t.Format("01"), t.Format("02"))
+	default:
+		return filepath.Join(filepath.Dir(path), newName), nil
+	}
+	return filepath.Join(layoutRoot(config), sub, newName), nil
+}
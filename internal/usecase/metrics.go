@@ -0,0 +1,115 @@
+// Prometheus metrics for scans and renames
+package usecase
+
+import (
+	"strings"
+	"time"
+
+	"auto-rename/internal/infrastructure"
+)
+
+var (
+	filesProcessed = infrastructure.Metrics.NewCounterVec(
+		"auto_rename_files_total",
+		"Files handled by scans, by root, status and reason.",
+		"root", "status", "reason")
+	scanDuration = infrastructure.Metrics.NewHistogramVec(
+		"auto_rename_scan_duration_seconds",
+		"Wall-clock duration of a scan run.",
+		[]float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600},
+		"root")
+	renameLatency = infrastructure.Metrics.NewHistogramVec(
+		"auto_rename_file_rename_duration_seconds",
+		"Latency of a single file rename on disk.",
+		[]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+		"root")
+	lastSuccessfulScan = infrastructure.Metrics.NewGaugeVec(
+		"auto_rename_last_successful_scan_timestamp_seconds",
+		"Unix time the last scan of a root finished without error.",
+		"root")
+)
+
+// reviewMetricsRoot là nhãn root cho các đổi tên do review worker thực hiện
+const reviewMetricsRoot = "review"
+
+// metricReason rút gọn lý do của kết quả thành nhãn ít giá trị; lỗi chỉ giữ
+// loại lỗi vì thông báo lỗi chứa đường dẫn
+func metricReason(result FileResult, dryRun bool) string {
+	switch result.Status {
+	case StatusRenamed:
+		if dryRun {
+			return "dry_run"
+		}
+	case StatusSkipped:
+		if strings.HasPrefix(result.Reason, hookVetoPrefix) {
+			return "hook_veto"
+		}
+		if strings.HasPrefix(result.Reason, ruleSkipPrefix) {
+			return "rule_skip"
+		}
+		if strings.HasPrefix(result.Reason, "name unchanged by rule") {
+			return "rule_unchanged"
+		}
+		if strings.HasPrefix(result.Reason, collisionErrorPrefix) {
+			return "collision"
+		}
+		if strings.HasPrefix(result.Reason, sidecarSkipPrefix+" ") {
+			return "sidecar"
+		}
+		if result.Foreign {
+			return "foreign"
+		}
+		return strings.ReplaceAll(result.Reason, " ", "_")
+	case StatusFailed:
+		switch {
+		case strings.HasPrefix(result.Reason, "db lookup"):
+			return "db_lookup"
+		case strings.HasPrefix(result.Reason, "Failed to get file info"):
+			return "file_info"
+		case strings.HasPrefix(result.Reason, "queue for review"):
+			return "review_queue"
+		case strings.HasPrefix(result.Reason, "file no longer available"):
+			return "file_gone"
+		case strings.HasPrefix(result.Reason, "file changed"):
+			return "file_changed"
+		case strings.HasPrefix(result.Reason, hookVetoPrefix):
+			return "hook_veto"
+		case strings.HasPrefix(result.Reason, ruleErrorPrefix):
+			return "rule"
+		case strings.HasPrefix(result.Reason, layoutErrorPrefix+":"):
+			return "layout"
+		case strings.HasPrefix(result.Reason, collisionErrorPrefix):
+			return "collision"
+		case strings.HasPrefix(result.Reason, sidecarErrorPrefix+" "):
+			return "sidecar"
+		default:
+			return "rename"
+		}
+	}
+	return ""
+}
+
+// observeFile đếm kết quả một file
+func observeFile(root string, result FileResult, dryRun bool) {
+	filesProcessed.Inc(root, result.Status, metricReason(result, dryRun))
+}
+
+// moveFile chuyển file; test thay bằng hàm trả lỗi tạm thời
+var moveFile = infrastructure.MoveFile
+
+// timedRename đổi tên hoặc chuyển file (sao chép nếu khác file system), ghi lại
+// độ trễ và trả về cách đã dùng
+func timedRename(root, oldPath, newPath string) (string, error) {
+	start := time.Now()
+	strategy, err := moveFile(oldPath, newPath)
+	renameLatency.Observe(time.Since(start).Seconds(), root)
+	return strategy, err
+}
+
+// observeRun ghi thời lượng lượt quét và thời điểm quét thành công gần nhất
+func observeRun(root string, started time.Time, err error) {
+	scanDuration.Observe(time.Since(started).Seconds(), root)
+	if err == nil {
+		lastSuccessfulScan.Set(float64(time.Now().Unix()), root)
+	}
+}
@@ -0,0 +1,189 @@
+// Progress tracking for running scans
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Progress theo dõi tiến độ một lượt quét đang chạy
+type Progress struct {
+	RunID     string
+	Root      string
+	DryRun    bool
+	StartedAt time.Time
+
+	absRoot string
+	seen    atomic.Int64
+	renamed atomic.Int64
+	skipped atomic.Int64
+	failed  atomic.Int64
+	queued  atomic.Int64
+}
+
+// ProgressSnapshot là trạng thái tiến độ tại một thời điểm, Rate tính theo file/giây
+type ProgressSnapshot struct {
+	RunID          string  `json:"run_id"`
+	Root           string  `json:"root"`
+	DryRun         bool    `json:"dry_run"`
+	StartedAt      string  `json:"started_at"`
+	Seen           int64   `json:"seen"`
+	Renamed        int64   `json:"renamed"`
+	Skipped        int64   `json:"skipped"`
+	Failed         int64   `json:"failed"`
+	Queued         int64   `json:"queued"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	Rate           float64 `json:"rate"`
+}
+
+// maxRunHistory là số lượt quét đã xong được giữ lại trong bộ nhớ
+const maxRunHistory = 100
+
+// RunLog là tóm tắt một lượt quét đã xong, hiển thị ở trang logs
+type RunLog struct {
+	RunID     string `json:"run_id"`
+	Root      string `json:"root"`
+	Timestamp string `json:"timestamp"`
+	Processed int    `json:"processed"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	Error     string `json:"error,omitempty"`
+}
+
+var runHistory = struct {
+	sync.Mutex
+	logs []RunLog
+}{}
+
+// recordRun lưu tóm tắt lượt quét vào lịch sử, bỏ bản cũ nhất khi đầy
+func recordRun(log RunLog) {
+	runHistory.Lock()
+	defer runHistory.Unlock()
+	runHistory.logs = append(runHistory.logs, log)
+	if len(runHistory.logs) > maxRunHistory {
+		runHistory.logs = runHistory.logs[len(runHistory.logs)-maxRunHistory:]
+	}
+}
+
+// RecentRuns trả về các lượt quét đã xong, cũ nhất trước
+func RecentRuns() []RunLog {
+	runHistory.Lock()
+	defer runHistory.Unlock()
+	logs := make([]RunLog, len(runHistory.logs))
+	copy(logs, runHistory.logs)
+	return logs
+}
+
+var activeRuns = struct {
+	sync.Mutex
+	runs map[string]*Progress
+}{runs: make(map[string]*Progress)}
+
+// ErrScanInProgress báo đã có lượt quét khác chạy trên cùng thư mục
+var ErrScanInProgress = errors.New("a scan is already running for this directory")
+
+// startProgress đăng ký một lượt quét mới. Mỗi thư mục chỉ có một lượt quét
+// tại một thời điểm; thư mục cha/con của thư mục đang quét cũng bị chặn.
+func startProgress(root string, dryRun bool) (*Progress, error) {
+	absRoot, err := absPath(root)
+	if err != nil {
+		return nil, err
+	}
+	activeRuns.Lock()
+	defer activeRuns.Unlock()
+	for _, running := range activeRuns.runs {
+		if pathsOverlap(running.absRoot, absRoot) {
+			return nil, fmt.Errorf("%w: %s", ErrScanInProgress, running.Root)
+		}
+	}
+	p := &Progress{RunID: uuid.New().String(), Root: root, DryRun: dryRun, StartedAt: time.Now(), absRoot: absRoot}
+	activeRuns.runs[p.RunID] = p
+	return p, nil
+}
+
+// absPath trả về đường dẫn tuyệt đối đã giải symlink nếu có thể
+func absPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// pathsOverlap kiểm tra a và b trùng nhau hoặc một cái nằm trong cái kia
+func pathsOverlap(a, b string) bool {
+	return isWithin(a, b) || isWithin(b, a)
+}
+
+// isWithin kiểm tra path nằm trong (hoặc bằng) root
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// finish gỡ lượt quét khỏi danh sách đang chạy
+func (p *Progress) finish() {
+	activeRuns.Lock()
+	delete(activeRuns.runs, p.RunID)
+	activeRuns.Unlock()
+}
+
+func (p *Progress) count(status string) {
+	switch status {
+	case StatusRenamed:
+		p.renamed.Add(1)
+	case StatusSkipped:
+		p.skipped.Add(1)
+	case StatusFailed:
+		p.failed.Add(1)
+	case StatusQueued:
+		p.queued.Add(1)
+	}
+}
+
+// Snapshot đọc tiến độ hiện tại
+func (p *Progress) Snapshot() ProgressSnapshot {
+	elapsed := time.Since(p.StartedAt).Seconds()
+	s := ProgressSnapshot{
+		RunID:          p.RunID,
+		Root:           p.Root,
+		DryRun:         p.DryRun,
+		StartedAt:      p.StartedAt.Format(time.RFC3339),
+		Seen:           p.seen.Load(),
+		Renamed:        p.renamed.Load(),
+		Skipped:        p.skipped.Load(),
+		Failed:         p.failed.Load(),
+		Queued:         p.queued.Load(),
+		ElapsedSeconds: elapsed,
+	}
+	if elapsed > 0 {
+		s.Rate = float64(s.Renamed+s.Skipped+s.Failed+s.Queued) / elapsed
+	}
+	return s
+}
+
+// ActiveRuns trả về tiến độ các lượt quét đang chạy, cũ nhất trước
+func ActiveRuns() []ProgressSnapshot {
+	activeRuns.Lock()
+	snapshots := make([]ProgressSnapshot, 0, len(activeRuns.runs))
+	for _, p := range activeRuns.runs {
+		snapshots = append(snapshots, p.Snapshot())
+	}
+	activeRuns.Unlock()
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].StartedAt < snapshots[j].StartedAt })
+	return snapshots
+}
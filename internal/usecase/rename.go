@@ -2,10 +2,12 @@
 package usecase
 
 import (
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"auto-rename/internal/config"
@@ -15,164 +17,725 @@ import (
 	"github.com/google/uuid"
 )
 
+// Trạng thái kết quả xử lý một file
+const (
+	StatusRenamed = "renamed"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+	StatusQueued  = "queued"
+)
+
+// Nguồn kích hoạt lượt quét, ghi vào log với khóa "trigger"
+const (
+	TriggerCLI     = "cli"
+	TriggerCron    = "cron"
+	TriggerAPI     = "api"
+	TriggerPreview = "preview"
+	TriggerRetry   = "retry"
+)
+
+// foreignReason là lý do bỏ qua file có dạng tên đã đổi nhưng không có bản ghi
+const foreignReason = "foreign: looks renamed but has no rename record"
+
+// maxSummaryFailures giới hạn số file lỗi (và file foreign) giữ lại trong RunSummary
+const maxSummaryFailures = 100
+
+// FileResult là kết quả xử lý một file trong lượt quét
+type FileResult struct {
+	Path    string `json:"path"`
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name,omitempty"`
+	// NewPath là đường dẫn mới, có thể ở thư mục khác khi luật chọn dir()
+	NewPath string `json:"new_path,omitempty"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	// Collisions là số lần đích đổi tên đã có file trước khi chọn được đích trống
+	Collisions int `json:"collisions,omitempty"`
+	// Retryable cho biết file lỗi vì lỗi tạm thời và có thể được thử lại
+	Retryable bool `json:"retryable,omitempty"`
+	// Foreign cho biết file có dạng tên đã đổi nhưng DB không có bản ghi đổi tên ra tên đó
+	Foreign bool `json:"foreign,omitempty"`
+	// MimeType là loại file nhận ra từ nội dung; ExtMismatch cho biết đuôi gốc không khớp nội dung
+	MimeType    string `json:"mime_type,omitempty"`
+	ExtMismatch bool   `json:"ext_mismatch,omitempty"`
+	// Sidecars là các file đi kèm được đổi tên cùng file này (SIDECAR_EXTENSIONS)
+	Sidecars []FileResult `json:"sidecars,omitempty"`
+}
+
+// RunSummary tổng hợp kết quả một lượt quét. Failures giữ tối đa
+// maxSummaryFailures file lỗi đầu tiên, theo thứ tự phát hiện.
+type RunSummary struct {
+	RunID      string       `json:"run_id"`
+	Root       string       `json:"root"`
+	DryRun     bool         `json:"dry_run"`
+	StartedAt  string       `json:"started_at"`
+	FinishedAt string       `json:"finished_at"`
+	Seen       int          `json:"seen"`
+	Renamed    int          `json:"renamed"`
+	Skipped    int          `json:"skipped"`
+	Failed     int          `json:"failed"`
+	Queued     int          `json:"queued"`
+	Collisions int          `json:"collisions"`
+	Failures   []FileResult `json:"failures"`
+	// Foreign là số file có dạng tên đã đổi nhưng không có bản ghi (CONFIRM_RENAMED)
+	Foreign      int      `json:"foreign"`
+	ForeignFiles []string `json:"foreign_files,omitempty"`
+	// Sidecars là số file đi kèm được đổi tên cùng file chính; chúng được tính là skipped khi được quét tới
+	Sidecars int `json:"sidecars"`
+}
+
 // renameFiles thực hiện đổi tên file trong thư mục
 func RenameFiles(config config.Config, db *infrastructure.Database) error {
-	log.Printf("Scanning directory: %s", config.Dir)
 	if config.DryRun {
-		log.Printf("DRY RUN MODE - No files will be renamed")
+		slog.Info("dry run mode, no files will be renamed", "root", config.Dir)
 	}
+	_, err := ScanDirectory(config, db, TriggerCLI)
+	return err
+}
 
-	var files []os.DirEntry
-	var err error
-	if config.RenameSubfolder {
-		err = filepath.WalkDir(config.Dir, func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-			// Chỉ xử lý file, không đổi tên folder
-			if !d.IsDir() {
-				files = append(files, &fileEntryWrapper{d, path})
+// ScanDirectory quét thư mục và đổi tên file theo kiểu pipeline: file được đưa
+// cho pool worker ngay khi duyệt tới, nên bộ nhớ không phụ thuộc kích thước cây
+// thư mục. Kết quả được sắp lại theo thứ tự phát hiện trước khi log, ghi DB theo
+// lô và tổng hợp; số file đang xử lý bị giới hạn bởi một cửa sổ cố định.
+func ScanDirectory(config config.Config, db *infrastructure.Database, trigger string) (RunSummary, error) {
+	progress, err := startProgress(config.Dir, config.DryRun)
+	if err != nil {
+		return RunSummary{Root: config.Dir, DryRun: config.DryRun, Failures: []FileResult{}}, err
+	}
+	return runScan(config, db, trigger, progress)
+}
+
+// StartScan bắt đầu một lượt quét chạy nền và trả về run id ngay lập tức
+func StartScan(config config.Config, db *infrastructure.Database) (string, error) {
+	progress, err := startProgress(config.Dir, config.DryRun)
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		// Lỗi đã được runScan ghi log kèm run_id
+		_, _ = runScan(config, db, TriggerAPI, progress)
+	}()
+	return progress.RunID, nil
+}
+
+// runScan chạy pipeline quét cho lượt quét đã đăng ký progress
+func runScan(config config.Config, db *infrastructure.Database, trigger string, progress *Progress) (RunSummary, error) {
+	defer progress.finish()
+	logger := slog.With("run_id", progress.RunID, "root", config.Dir, "trigger", trigger)
+	logger.Debug("scan started", "dry_run", config.DryRun, "review", config.ReviewMode, "workers", config.Workers)
+	summary := RunSummary{
+		RunID:     progress.RunID,
+		Root:      config.Dir,
+		DryRun:    config.DryRun,
+		StartedAt: progress.StartedAt.Format(time.RFC3339),
+		Failures:  []FileResult{},
+	}
+	publishEvent(Event{Type: EventRunStarted, RunID: summary.RunID, Root: summary.Root, DryRun: summary.DryRun})
+	run := runInfo{ID: progress.RunID, Root: config.Dir, Trigger: trigger, Counter: newRuleCounter(config, db), Sidecars: newSidecarIndex(), Targets: newTargetSet()}
+	// Hook không chạy khi dry-run vì có thể có tác dụng phụ
+	if !config.DryRun {
+		if err := runHooks(config.Hooks.RunStart, newHookPayload(HookRunStart, run), logger); err != nil {
+			logger.Warn("run-start hook failed", "error", err)
+		}
+	}
+
+	workers := config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	window := make(chan struct{}, workers*4)
+
+	type job struct {
+		index int
+		path  string
+	}
+	type indexedResult struct {
+		index   int
+		result  FileResult
+		records []domain.FileRecord
+	}
+	jobs := make(chan job)
+	results := make(chan indexedResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				result, records := processFile(config, db, j.path, run, logger)
+				results <- indexedResult{index: j.index, result: result, records: records}
 			}
+		}()
+	}
+
+	var walkErr error
+	go func() {
+		index := 0
+		walkErr = infrastructure.WalkFiles(config.Dir, config.RenameSubfolder, func(path string) error {
+			window <- struct{}{}
+			progress.seen.Add(1)
+			jobs <- job{index: index, path: path}
+			index++
 			return nil
+		}, func(dir string, err error) {
+			logger.Warn("failed to read directory", "path", dir, "error", err)
 		})
-	} else {
-		entries, e := os.ReadDir(config.Dir)
-		if e != nil {
-			err = e
-		} else {
-			for _, d := range entries {
-				if !d.IsDir() {
-					files = append(files, &fileEntryWrapper{d, filepath.Join(config.Dir, d.Name())})
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Worker trả kết quả không theo thứ tự; giữ lại cho tới khi đủ liền mạch
+	// để log, ghi DB và tổng hợp luôn theo thứ tự phát hiện.
+	batch := newRecordBatch(db, config.DBBatchSize, logger)
+	pending := make(map[int]indexedResult)
+	next := 0
+	for r := range results {
+		pending[r.index] = r
+		for {
+			p, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+			if trigger == TriggerCron {
+				cron.progress(time.Now())
+			}
+
+			summary.Seen++
+			if c := p.result.Collisions; c > 0 {
+				summary.Collisions += c
+				nameCollisions.Add(float64(c), summary.Root, config.CollisionPolicy)
+			}
+			if p.result.Foreign {
+				summary.Foreign++
+				if len(summary.ForeignFiles) < maxSummaryFailures {
+					summary.ForeignFiles = append(summary.ForeignFiles, p.result.Path)
+				}
+			}
+			progress.count(p.result.Status)
+			observeFile(summary.Root, p.result, summary.DryRun)
+			result := p.result
+			publishEvent(Event{Type: fileEventType(result.Status), RunID: summary.RunID, Root: summary.Root, DryRun: summary.DryRun, File: &result})
+			switch p.result.Status {
+			case StatusRenamed:
+				summary.Renamed++
+				summary.Sidecars += len(p.result.Sidecars)
+			case StatusSkipped:
+				summary.Skipped++
+			case StatusQueued:
+				summary.Queued++
+			case StatusFailed:
+				summary.Failed++
+				if len(summary.Failures) < maxSummaryFailures {
+					summary.Failures = append(summary.Failures, p.result)
 				}
 			}
+			for _, record := range p.records {
+				batch.add(record)
+			}
+			if p.result.Retryable && !config.DryRun {
+				scheduleRetry(config, db, run, p.result, logger)
+			}
+		}
+	}
+	batch.flush()
+	summary.FinishedAt = time.Now().Format(time.RFC3339)
+
+	var err error
+	errMsg := ""
+	if walkErr != nil {
+		err = fmt.Errorf("failed to scan directory: %w", walkErr)
+		errMsg = err.Error()
+	}
+	observeRun(summary.Root, progress.StartedAt, err)
+	logRunSummary(logger, trigger, summary, time.Since(progress.StartedAt), err)
+	recordRun(RunLog{
+		RunID:     summary.RunID,
+		Root:      summary.Root,
+		Timestamp: summary.FinishedAt,
+		Processed: summary.Renamed,
+		Skipped:   summary.Skipped,
+		Failed:    summary.Failed,
+		Error:     errMsg,
+	})
+	if !config.DryRun {
+		p := newHookPayload(HookRunEnd, run)
+		p.Summary, p.Error = &summary, errMsg
+		if err := runHooks(config.Hooks.RunEnd, p, logger); err != nil {
+			logger.Warn("run-end hook failed", "error", err)
 		}
 	}
+	publishEvent(Event{Type: EventRunFinished, RunID: summary.RunID, Root: summary.Root, DryRun: summary.DryRun, Summary: &summary, Error: errMsg})
+	return summary, err
+}
+
+// logRunSummary ghi kết quả lượt quét; lượt quét cron không thay đổi gì chỉ ghi
+// ở mức debug để không làm ngập log mỗi phút
+func logRunSummary(logger *slog.Logger, trigger string, summary RunSummary, elapsed time.Duration, err error) {
+	attrs := []any{
+		"seen", summary.Seen, "renamed", summary.Renamed, "skipped", summary.Skipped,
+		"failed", summary.Failed, "queued", summary.Queued, "collisions", summary.Collisions,
+		"foreign", summary.Foreign, "sidecars", summary.Sidecars, "dry_run", summary.DryRun,
+		"duration_ms", elapsed.Milliseconds(),
+	}
+	switch {
+	case err != nil:
+		logger.Error("scan failed", append(attrs, "error", err)...)
+	case summary.Failed > 0:
+		logger.Warn("scan finished with failures", attrs...)
+	case trigger == TriggerCron && summary.Renamed == 0 && summary.Queued == 0:
+		logger.Debug("scan finished", attrs...)
+	default:
+		logger.Info("scan finished", attrs...)
+	}
+}
+
+// processFile kiểm tra và đổi tên một file, trả về kết quả và bản ghi cần lưu (nếu có).
+// Luật đặt tên (nếu có) có thể đổi tên mới, chuyển thư mục hoặc bỏ qua file. Pre-rename
+// hook chạy ngay trước khi đổi tên và có thể từ chối, post-rename hook chạy sau đó.
+func processFile(config config.Config, db *infrastructure.Database, path string, run runInfo, logger *slog.Logger) (FileResult, []domain.FileRecord) {
+	name := filepath.Base(path)
+	result := FileResult{Path: path, OldName: name}
+	logger.Debug("scanning file", "path", path)
+
+	skip := func(reason string) (FileResult, []domain.FileRecord) {
+		logger.Debug("file skipped", "path", path, "reason", reason)
+		result.Status, result.Reason = StatusSkipped, reason
+		return result, nil
+	}
+	lookupFailed := func(err error) (FileResult, []domain.FileRecord) {
+		logger.Error("db lookup failed", "path", path, "error", err)
+		result.Status, result.Reason = StatusFailed, fmt.Sprintf("db lookup: %v", err)
+		return result, nil
+	}
+	reason, foreign, err := skipReason(config, db, path, run)
 	if err != nil {
-		return fmt.Errorf("failed to scan directory: %w", err)
-	}
-
-	log.Printf("Found %d files to process", len(files))
-	log.Printf("Files: %v", files)
-	renamedCount := 0
-	skippedCount := 0
-	for _, file := range files {
-		// fileEntryWrapper đảm bảo có path đầy đủ
-		name := file.Name()
-		path := file.(interface{ Path() string }).Path()
-		log.Printf("Scanning file: %s", path)
-		if file.IsDir() {
-			continue
+		return lookupFailed(err)
+	}
+	if foreign {
+		// Có dạng tên đã đổi nhưng không phải do auto-rename đổi: không đổi tên lại
+		logger.Info("foreign file", "path", path)
+		result.Foreign = true
+	}
+	if reason != "" {
+		return skip(reason)
+	}
+
+	// Tên mới giữ đuôi file đã sửa theo nội dung (FIX_EXTENSIONS)
+	content := inspectFile(config, path, logger)
+
+	// File đi kèm được đổi tên cùng file chính của nhóm, trừ khi luật bỏ qua nó.
+	// File chính đã được xử lý trước đó thì không đổi tên nhóm nữa: file đi kèm
+	// (vd .xmp mới thêm) được xử lý riêng, theo tên mới của file chính nếu có.
+	sidecars := run.Sidecars.groupOf(config, path)
+	if sidecars != nil && sidecars.Leader != name {
+		leaderSkip, _, err := skipReason(config, db, filepath.Join(filepath.Dir(path), sidecars.Leader), run)
+		if err != nil {
+			return lookupFailed(err)
+		}
+		if leaderSkip == "" {
+			reason, err := ruleSkipReason(config, db, run.Root, path, content)
+			if err != nil {
+				logger.Error("rule evaluation failed", "path", path, "error", err)
+			}
+			if reason == "" {
+				reason = fmt.Sprintf("%s %s", sidecarSkipPrefix, sidecars.Leader)
+			}
+			return skip(reason)
+		}
+		sidecars = nil
+	}
+	var leader *domain.FileRecord
+	var follow ruleTarget
+	if sidecars == nil && isSidecar(config, name) {
+		if leader, follow, err = followLeader(config, db, path, content); err != nil {
+			return lookupFailed(err)
+		}
+		if leader != nil {
+			reason, err := ruleSkipReason(config, db, run.Root, path, content)
+			if err != nil {
+				logger.Error("rule evaluation failed", "path", path, "error", err)
+			}
+			if reason != "" {
+				return skip(reason)
+			}
 		}
+	}
+	group, err := newRenameGroup(config, db, run, path, sidecars, content, logger)
+	if err != nil {
+		return lookupFailed(err)
+	}
+	_, fixedExt := splitExt(config, content.Name)
+	newName := GenerateUUIDName(config, content.Name)
+	newPath := filepath.Join(filepath.Dir(path), newName)
+	result.NewName, result.NewPath = newName, newPath
+	result.MimeType, result.ExtMismatch = content.Type.MIME, content.Mismatch
+	record := domain.FileRecord{
+		OriginalName: name,
+		NewName:      newName,
+		FilePath:     filepath.Dir(path),
+		OldPath:      absOrSelf(path),
+		Extension:    strings.ToLower(fixedExt),
+		MimeType:     content.Type.MIME,
+		ExtMismatch:  content.Mismatch,
+		Metadata:     content.Metadata,
+	}
 
-		if SameFileAsDB(config, file.Name()) {
-			skippedCount++
-			continue
+	fileSize, fileMode, modTime, err := infrastructure.GetFileInfo(path)
+	if err != nil {
+		logger.Error("failed to get file info", "path", path, "error", err)
+		record.ErrorMsg = fmt.Sprintf("Failed to get file info: %v", err)
+		record.ErrorType = domain.ErrorTypeFileInfo
+		record.RenamedAt = time.Now().UTC().Format(time.RFC3339)
+		result.Status, result.Reason = StatusFailed, record.ErrorMsg
+		result.Retryable = transientError(err)
+		return result, []domain.FileRecord{record}
+	}
+	record.FileSize, record.FileMode, record.ModTime = fileSize, fileMode, modTime
+
+	// Đề xuất đang mở hoặc đã bị từ chối (file không đổi) không được đề xuất lại;
+	// kiểm tra trước luật đặt tên để không tốn seq()
+	if config.ReviewMode && !config.DryRun {
+		status, err := db.BlockingPendingRename(absOrSelf(path), fileSize, modTime)
+		if err != nil {
+			return lookupFailed(err)
 		}
+		switch status {
+		case domain.PendingStatusRejected:
+			return skip(reviewRejectedReason)
+		case domain.PendingStatusPending, domain.PendingStatusApproved:
+			return skip("awaiting review")
+		}
+	}
 
-		if LooksLikeUUID(file.Name()) {
-			skippedCount++
-			continue
+	fail := func(errorType string, err error) (FileResult, []domain.FileRecord) {
+		record.ErrorMsg = err.Error()
+		record.ErrorType = errorType
+		record.RenamedAt = time.Now().UTC().Format(time.RFC3339)
+		result.Status, result.Reason = StatusFailed, record.ErrorMsg
+		result.Retryable = transientError(err)
+		return result, []domain.FileRecord{record}
+	}
+	target := follow
+	if leader == nil {
+		var planSkip, errorType string
+		target, planSkip, errorType, err = planTarget(config, run, path, newName, fileSize, content, logger)
+		if err != nil {
+			return fail(errorType, err)
+		}
+		if planSkip != "" {
+			return skip(planSkip)
 		}
+	}
 
-		exists, err := db.HasOriginalName(file.Name())
-		if err == nil && exists {
-			skippedCount++
-			continue
+	// Đích có thể bị worker khác chiếm ngay trước khi đổi tên; khi đó tìm đích
+	// khác theo chính sách trùng tên và thử lại, file có sẵn không bị ghi đè
+	var strategy string
+	for attempt := 1; ; attempt++ {
+		if leader != nil {
+			// File đi kèm chỉ lấy tên theo file chính, không chọn tên khác khi trùng
+			taken, err := takenTarget(config, target, nil)
+			if err != nil {
+				logger.Error("rename failed", "path", path, "old", name, "new", target.Path, "error", err)
+				return fail(renameErrorType(err), err)
+			}
+			if taken != "" {
+				result.Collisions++
+				return skip(fmt.Sprintf("%s: %s exists", collisionErrorPrefix, taken))
+			}
+		} else {
+			var collisions int
+			var collisionSkip string
+			target, collisions, collisionSkip, err = avoidCollision(config, run, path, fileSize, content, group, target, logger)
+			result.Collisions += collisions
+			if err != nil {
+				logger.Error("rename failed", "path", path, "old", name, "new", target.Path, "error", err)
+				return fail(renameErrorType(err), err)
+			}
+			if collisionSkip != "" {
+				return skip(collisionSkip)
+			}
 		}
+		newName, newPath = target.Name, target.Path
+		result.NewName, result.NewPath = newName, newPath
+		record.NewName, record.FilePath = newName, filepath.Dir(newPath)
+		record.OldPath, record.NewPath = absOrSelf(path), absOrSelf(newPath)
 
-		oldPath := path
-		newName := GenerateUUIDName(name)
-		newPath := filepath.Join(filepath.Dir(path), newName)
+		if config.ReviewMode && !config.DryRun {
+			return queueForReview(config, db, result, record, path, logger), nil
+		}
+		if config.DryRun {
+			logger.Info("would rename file", "path", path, "old", name, "new", newName, "new_path", newPath)
+			break
+		}
+		if target.Rule != "" || config.Layout != "" || leader != nil {
+			if err := prepareTarget(newPath); err != nil {
+				logger.Error("rename failed", "path", path, "old", name, "new", newPath, "error", err)
+				return fail(domain.ErrorTypeRename, err)
+			}
+		}
 
-		fileSize, fileMode, modTime, err := infrastructure.GetFileInfo(oldPath)
+		run.Targets.add(newPath)
+		var veto string
+		strategy, veto, err = renameWithHooks(config, run, config.Dir, path, newPath, fileSize, logger)
+		if veto != "" {
+			return skip(veto)
+		}
+		if errors.Is(err, infrastructure.ErrTargetExists) && attempt < maxCollisionAttempts && leader == nil {
+			continue
+		}
+		record.MoveStrategy = strategy
 		if err != nil {
-			log.Printf("Failed to get file info for %s: %v", file.Name(), err)
-			record := domain.FileRecord{
-				OriginalName: file.Name(),
-				NewName:      newName,
-				FilePath:     config.Dir,
-				Success:      false,
-				ErrorMsg:     fmt.Sprintf("Failed to get file info: %v", err),
-				RenamedAt:    time.Now().Format(time.RFC3339),
+			logger.Error("rename failed", "path", path, "old", name, "new", newName, "error", err)
+			if errors.Is(err, infrastructure.ErrTargetExists) {
+				result.Collisions++
+				err = fmt.Errorf("%s: %w", collisionErrorPrefix, err)
 			}
-			_ = db.InsertFileRecord(record)
-			continue
+			return fail(renameErrorType(err), err)
 		}
+		logger.Info("file renamed", "path", path, "old", name, "new", newName, "new_path", newPath, "strategy", strategy)
+		break
+	}
 
-		log.Printf("  %s -> %s", file.Name(), newName)
+	var members []domain.FileRecord
+	if group != nil {
+		var memberResults []FileResult
+		members, memberResults, err = renameMembers(config, run, config.Dir, group, target, config.DryRun, logger)
+		if err != nil {
+			// Cả nhóm được đổi tên hoặc không file nào: chuyển file chính lại chỗ cũ
+			logger.Error("group rename failed", "path", path, "group_id", group.ID, "error", err)
+			if !config.DryRun {
+				if _, moveErr := timedRename(config.Dir, newPath, path); moveErr != nil {
+					logger.Error("failed to move file back", "path", newPath, "to", path, "error", moveErr)
+					err = fmt.Errorf("%w; moving %s back: %v", err, name, moveErr)
+				}
+			}
+			return fail(domain.ErrorTypeRename, err)
+		}
+		record.GroupID = group.ID
+		result.Sidecars = memberResults
+	} else if leader != nil && !config.DryRun {
+		record.GroupID = joinLeaderGroup(db, leader, logger)
+	}
+	record.Success = true
+	record.RenamedAt = time.Now().UTC().Format(time.RFC3339)
+	result.Status = StatusRenamed
+	return result, append([]domain.FileRecord{record}, members...)
+}
 
-		var renameErr error
-		success := true
-		errorMsg := ""
+// targetSet là các đích đổi tên của một lượt quét, theo đường dẫn tuyệt đối
+type targetSet struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
 
-		if !config.DryRun {
-			renameErr = os.Rename(oldPath, newPath)
-			if renameErr != nil {
-				success = false
-				errorMsg = renameErr.Error()
-				log.Printf("Failed to rename %s: %v", file.Name(), renameErr)
-			}
+func newTargetSet() *targetSet {
+	return &targetSet{paths: map[string]struct{}{}}
+}
+
+// add ghi nhận đích trước khi đổi tên, để worker khác gặp file ở tên mới thì bỏ qua
+func (s *targetSet) add(path string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths[absOrSelf(path)] = struct{}{}
+}
+
+func (s *targetSet) has(path string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.paths[absOrSelf(path)]
+	return ok
+}
+
+// skipReason trả về lý do bỏ qua file theo tên và DB: file database, file đã
+// đổi tên hoặc đã xử lý, file đang chờ retry worker; rỗng khi file cần đổi tên.
+// foreign cho biết file có dạng tên đã đổi nhưng không có bản ghi.
+func skipReason(config config.Config, db *infrastructure.Database, path string, run runInfo) (reason string, foreign bool, err error) {
+	name := filepath.Base(path)
+	if SameFileAsDB(config, name) {
+		return "database file", false, nil
+	}
+	// Bản ghi của file vừa đổi tên trong lượt quét có thể chưa được ghi xuống DB
+	// khi readdir gặp lại file ở tên mới
+	if run.Targets.has(path) {
+		return "already renamed", false, nil
+	}
+	uuidName := LooksLikeUUID(config, name)
+	if uuidName && !config.ConfirmRenamed {
+		return "already renamed", false, nil
+	}
+	if uuidName || config.Rules != nil || config.CollisionPolicy == domain.CollisionSuffix {
+		// Tên do luật đặt hoặc có hậu tố trùng tên không có dạng UUID nên phải tra DB;
+		// tên UUID chỉ được tra khi bật CONFIRM_RENAMED
+		renamed, err := db.HasNewName(absOrSelf(path))
+		if err != nil {
+			return "", false, err
 		}
+		if renamed {
+			return "already renamed", false, nil
+		}
+		if uuidName {
+			return foreignReason, true, nil
+		}
+	}
+	// File đã đổi tên thành công thì bỏ qua; file lỗi tạm thời đang chờ retry
+	// worker. File lỗi khác và file đã hoàn tác được đổi tên lại.
+	if run.Trigger == TriggerRetry {
+		return "", false, nil
+	}
+	exists, err := db.HasOriginalName(name)
+	if err != nil || exists {
+		return "already processed", false, err
+	}
+	pending, err := db.HasPendingRenameRetry(absOrSelf(path))
+	if err != nil || pending {
+		return "retry pending", false, err
+	}
+	return "", false, nil
+}
 
-		record := domain.FileRecord{
-			OriginalName: file.Name(),
-			NewName:      newName,
-			FilePath:     config.Dir,
-			FileSize:     fileSize,
-			FileMode:     fileMode,
-			ModTime:      modTime,
-			Success:      success,
-			ErrorMsg:     errorMsg,
-			RenamedAt:    time.Now().Format(time.RFC3339),
+// planTarget chọn tên và đường dẫn mới cho file: newName là tên UUID mặc định,
+// sau đó áp dụng luật đặt tên và layout. errorType là loại lỗi khi err khác nil.
+func planTarget(config config.Config, run runInfo, path, newName string, size int64, content fileContent, logger *slog.Logger) (target ruleTarget, skip, errorType string, err error) {
+	target, skip, err = applyRules(config, run, path, newName, size, content)
+	if err != nil {
+		logger.Error("rule evaluation failed", "path", path, "error", err)
+		return target, "", domain.ErrorTypeRule, fmt.Errorf("%s: %v", ruleErrorPrefix, err)
+	}
+	if skip != "" {
+		return target, skip, "", nil
+	}
+	if target.Rule != "" {
+		logger.Debug("rule matched", "path", path, "rule", target.Rule, "new", target.Path)
+	}
+	// Thư mục do luật chọn được ưu tiên hơn layout
+	if config.Layout != "" && !target.Moved {
+		if target.Path, err = layoutPath(config, path, target.Name, content); err != nil {
+			logger.Error("failed to place file in layout", "path", path, "layout", config.Layout, "error", err)
+			return target, "", domain.ErrorTypeLayout, err
 		}
+	}
+	return target, "", "", nil
+}
+
+// renameErrorType phân loại lỗi đổi tên: trùng tên hoặc lỗi đổi tên thông thường
+func renameErrorType(err error) string {
+	if errors.Is(err, infrastructure.ErrTargetExists) {
+		return domain.ErrorTypeCollision
+	}
+	return domain.ErrorTypeRename
+}
 
-		_ = db.InsertFileRecord(record)
+// recordBatch gom bản ghi và ghi vào DB trong một transaction khi đủ lô
+type recordBatch struct {
+	db      *infrastructure.Database
+	size    int
+	logger  *slog.Logger
+	records []domain.FileRecord
+}
 
-		if success {
-			renamedCount++
-		}
+func newRecordBatch(db *infrastructure.Database, size int, logger *slog.Logger) *recordBatch {
+	if size < 1 {
+		size = 1
 	}
+	return &recordBatch{db: db, size: size, logger: logger}
+}
 
-	if config.DryRun {
-		log.Printf("Would rename %d files (skipped %d)", renamedCount, skippedCount)
-	} else {
-		log.Printf("Successfully renamed %d files (skipped %d)", renamedCount, skippedCount)
+func (b *recordBatch) add(record domain.FileRecord) {
+	b.records = append(b.records, record)
+	if len(b.records) >= b.size {
+		b.flush()
 	}
+}
 
-	return nil
+func (b *recordBatch) flush() {
+	if len(b.records) == 0 {
+		return
+	}
+	if err := b.db.InsertFileRecords(b.records); err != nil {
+		b.logger.Error("failed to record renames", "count", len(b.records), "error", err)
+	}
+	b.records = b.records[:0]
 }
 
-// LooksLikeUUID kiểm tra tên file có phải dạng UUID
-func LooksLikeUUID(name string) bool {
-	ext := filepath.Ext(name)
-	base := name[:len(name)-len(ext)]
+// LooksLikeUUID kiểm tra tên file có đúng dạng GenerateUUIDName tạo ra: UUID
+// phiên bản 4, variant RFC 4122, chữ hex thường, với đuôi thường hoặc đuôi ghép
+func LooksLikeUUID(config config.Config, name string) bool {
+	base, _ := splitExt(config, name)
 	if len(base) != 36 {
 		return false
 	}
-	expectedHyphens := []int{8, 13, 18, 23}
-	for _, pos := range expectedHyphens {
-		if pos >= len(base) || base[pos] != '-' {
-			return false
+	for i := 0; i < len(base); i++ {
+		c := base[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		case 14:
+			// Phiên bản: uuid.New() tạo UUID ngẫu nhiên (v4)
+			if c != '4' {
+				return false
+			}
+		case 19:
+			// Variant RFC 4122: 2 bit cao là 10
+			if c != '8' && c != '9' && c != 'a' && c != 'b' {
+				return false
+			}
+		default:
+			if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+				return false
+			}
 		}
 	}
 	return true
 }
 
-// GenerateUUIDName tạo tên mới dạng UUID cho file
-func GenerateUUIDName(originalName string) string {
-	ext := filepath.Ext(originalName)
+// GenerateUUIDName tạo tên mới dạng UUID cho file, giữ đuôi của tên gốc (kể cả đuôi ghép)
+func GenerateUUIDName(config config.Config, originalName string) string {
+	_, ext := splitExt(config, originalName)
 	newUUID := uuid.New().String()
 	return newUUID + ext
 }
 
-// fileEntryWrapper dùng để lưu path đầy đủ cho file
-type fileEntryWrapper struct {
-	os.DirEntry
-	fullPath string
+// FindForeignFiles trả về các file trong config.Dir có dạng tên đã đổi nhưng DB
+// không có bản ghi đổi tên ra tên đó, kể cả khi không bật CONFIRM_RENAMED
+func FindForeignFiles(config config.Config, db *infrastructure.Database) ([]string, error) {
+	var foreign []string
+	err := infrastructure.WalkFiles(config.Dir, config.RenameSubfolder, func(path string) error {
+		name := filepath.Base(path)
+		if !LooksLikeUUID(config, name) {
+			return nil
+		}
+		renamed, err := db.HasNewName(absOrSelf(path))
+		if err != nil {
+			return err
+		}
+		if !renamed {
+			foreign = append(foreign, path)
+		}
+		return nil
+	}, func(dir string, err error) {
+		slog.Warn("failed to read directory", "path", dir, "error", err)
+	})
+	return foreign, err
 }
 
-func (f *fileEntryWrapper) Path() string {
-	return f.fullPath
+// absOrSelf trả về đường dẫn tuyệt đối, hoặc chính path nếu không tính được
+func absOrSelf(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
 }
 
 // SameFileAsDB kiểm tra file có phải là file database không
@@ -185,104 +748,27 @@ func SameFileAsDB(config config.Config, name string) bool {
 
 // startCronScanner launches a ticker that rescans the directory every minute.
 func StartCronScanner(config config.Config, db *infrastructure.Database) {
-	log.Printf("[cron] StartCronScanner initialized for dir=%s", config.Dir)
-	ticker := time.NewTicker(time.Minute)
+	slog.Info("cron scanner initialized", "root", config.Dir, "interval", CronInterval)
+	ticker := time.NewTicker(CronInterval)
+	cron.start(time.Now())
 	for {
-		log.Printf("[cron] waiting for next tick...")
 		<-ticker.C
-		log.Printf("[cron] running scan of %s", config.Dir)
-		processed, skipped, err := RenameOnlyNewFiles(config, db)
-		if err != nil {
-			log.Printf("[cron] error: %v", err)
-			log.Printf("[cron] run summary: processed=%d skipped=%d error=%v", processed, skipped, err)
-		} else {
-			log.Printf("[cron] scan complete")
-			log.Printf("[cron] run summary: processed=%d skipped=%d error=nil", processed, skipped)
-		}
+		cron.tick(time.Now())
+		slog.Debug("cron tick", "root", config.Dir)
+		// Kết quả và lỗi đã được runScan ghi log kèm run_id
+		_, _, _ = RenameOnlyNewFiles(config, db)
+		cron.finish(time.Now())
 	}
 }
 
 // RenameOnlyNewFiles chỉ đổi tên file chưa có trong DB
 func RenameOnlyNewFiles(config config.Config, db *infrastructure.Database) (int, int, error) {
-	var files []os.DirEntry
-	var err error
-	if config.RenameSubfolder {
-		err = filepath.WalkDir(config.Dir, func(path string, d os.DirEntry, walkErr error) error {
-			if walkErr != nil {
-				return walkErr
-			}
-			if !d.IsDir() {
-				files = append(files, &fileEntryWrapper{d, path})
-			}
-			return nil
-		})
-		if err != nil {
-			return 0, 0, fmt.Errorf("failed to scan directory: %w", err)
-		}
-	} else {
-		entries, e := os.ReadDir(config.Dir)
-		if e != nil {
-			return 0, 0, fmt.Errorf("failed to read directory: %w", e)
-		}
-		for _, d := range entries {
-			if !d.IsDir() {
-				files = append(files, &fileEntryWrapper{d, filepath.Join(config.Dir, d.Name())})
-			}
-		}
+	summary, err := ScanDirectory(config, db, TriggerCron)
+	if errors.Is(err, ErrScanInProgress) {
+		slog.Info("cron scan skipped, another scan is running", "root", config.Dir)
 	}
-
-	processed := 0
-	skipped := 0
-	for _, file := range files {
-		name := file.Name()
-		path := file.(interface{ Path() string }).Path()
-		if file.IsDir() {
-			continue
-		}
-		if SameFileAsDB(config, name) {
-			skipped++
-			continue
-		}
-		if LooksLikeUUID(name) {
-			skipped++
-			continue
-		}
-		exists, err := db.HasOriginalName(name)
-		if err != nil {
-			log.Printf("[cron] db lookup failed for %s: %v", name, err)
-			continue
-		}
-		if exists {
-			skipped++
-			continue
-		}
-		oldPath := path
-		newName := GenerateUUIDName(name)
-		newPath := filepath.Join(filepath.Dir(path), newName)
-		fileSize, fileMode, modTime, infoErr := infrastructure.GetFileInfo(oldPath)
-		if infoErr != nil {
-			log.Printf("[cron] info failed %s: %v", name, infoErr)
-			record := domain.FileRecord{OriginalName: name, NewName: newName, FilePath: config.Dir, Success: false, ErrorMsg: fmt.Sprintf("file info: %v", infoErr), RenamedAt: time.Now().Format(time.RFC3339)}
-			_ = db.InsertFileRecord(record)
-			continue
-		}
-		if config.DryRun {
-			log.Printf("[cron][dry-run] %s -> %s", name, newName)
-		} else {
-			if err := os.Rename(oldPath, newPath); err != nil {
-				log.Printf("[cron] rename failed %s: %v", name, err)
-				record := domain.FileRecord{OriginalName: name, NewName: newName, FilePath: config.Dir, FileSize: fileSize, FileMode: fileMode, ModTime: modTime, Success: false, ErrorMsg: err.Error(), RenamedAt: time.Now().Format(time.RFC3339)}
-				_ = db.InsertFileRecord(record)
-				continue
-			}
-			log.Printf("[cron] renamed %s -> %s", name, newName)
-		}
-		record := domain.FileRecord{OriginalName: name, NewName: newName, FilePath: config.Dir, FileSize: fileSize, FileMode: fileMode, ModTime: modTime, Success: true, RenamedAt: time.Now().Format(time.RFC3339)}
-		if err := db.InsertFileRecord(record); err != nil {
-			log.Printf("[cron] failed to record rename for %s: %v", name, err)
-		}
-		processed++
+	if err != nil {
+		return 0, 0, err
 	}
-	log.Printf("[cron] processed=%d skipped=%d", processed, skipped)
-	return processed, skipped, nil
+	return summary.Renamed, summary.Skipped, nil
 }
@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+	"auto-rename/internal/rules"
+)
+
+// writeTestFile tạo file với nội dung content trong dir
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// discardLogger bỏ log của pipeline trong test
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// testRun tạo runInfo của một lượt quét như runScan
+func testRun(cfg config.Config, db *infrastructure.Database) runInfo {
+	return runInfo{ID: "test", Root: cfg.Dir, Trigger: TriggerCLI, Counter: newRuleCounter(cfg, db), Sidecars: newSidecarIndex(), Targets: newTargetSet()}
+}
+
+func TestRuleRenamedFileSeenAgainInSameRun(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	set, err := rules.Parse("rules", `ext == ".txt" => name("doc-" + str(seq("doc")) + ext)`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	cfg := config.Config{Dir: dir, Rules: set, CollisionPolicy: domain.CollisionRegenerate}
+	run := testRun(cfg, db)
+	path := writeTestFile(t, dir, "a.txt", "a")
+
+	result, records := processFile(cfg, db, path, run, discardLogger)
+	if result.Status != StatusRenamed || result.NewName != "doc-1.txt" {
+		t.Fatalf("first pass = %s %q (%s), want renamed to doc-1.txt", result.Status, result.NewName, result.Reason)
+	}
+	// readdir gặp lại file ở tên mới trước khi bản ghi được ghi xuống DB
+	again, _ := processFile(cfg, db, result.NewPath, run, discardLogger)
+	if again.Status != StatusSkipped || again.Reason != "already renamed" {
+		t.Errorf("second pass = %s (%s), want skipped as already renamed", again.Status, again.Reason)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "doc-1.txt")); err != nil {
+		t.Errorf("doc-1.txt: %v", err)
+	}
+	if next, _ := db.PeekRuleCounter("doc"); next != 1 {
+		t.Errorf("seq(doc) = %d after one rename, want 1", next)
+	}
+
+	// Lượt quét sau tra DB
+	if err := db.InsertFileRecords(records); err != nil {
+		t.Fatal(err)
+	}
+	later, _ := processFile(cfg, db, result.NewPath, testRun(cfg, db), discardLogger)
+	if later.Status != StatusSkipped {
+		t.Errorf("next run = %s (%s), want skipped", later.Status, later.Reason)
+	}
+}
+
+func TestScanDirectoryKeepsDiscoveryOrder(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	for i := 0; i < 120; i++ {
+		// Kích thước khác nhau để worker xong không theo thứ tự nhận việc
+		writeTestFile(t, dir, fmt.Sprintf("sub%d/file-%03d.txt", i%3, i), strings.Repeat("x", (i*7919)%4096))
+	}
+	cfg := config.Config{Dir: dir, RenameSubfolder: true, Workers: 8, DBBatchSize: 7, CollisionPolicy: domain.CollisionRegenerate}
+
+	// Thứ tự readdir của cây chưa đổi tên là thứ tự phát hiện của lượt quét
+	var want []string
+	if err := infrastructure.WalkFiles(dir, true, func(path string) error {
+		want = append(want, path)
+		return nil
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel := Events.Subscribe(len(want) + 2)
+	summary, err := ScanDirectory(cfg, db, TriggerCLI)
+	cancel()
+	if err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+	if summary.Seen != len(want) || summary.Renamed != len(want) {
+		t.Fatalf("summary = %d seen, %d renamed, want %d", summary.Seen, summary.Renamed, len(want))
+	}
+
+	var published []string
+	for e := range events {
+		if e.File != nil && e.RunID == summary.RunID {
+			published = append(published, e.File.Path)
+		}
+	}
+	if strings.Join(published, "\n") != strings.Join(want, "\n") {
+		t.Errorf("file events out of discovery order:\n%v\nwant\n%v", published, want)
+	}
+
+	records, err := db.GetAllFileRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// GetAllFileRecords trả bản ghi mới nhất trước
+	var stored []string
+	for i := len(records) - 1; i >= 0; i-- {
+		stored = append(stored, records[i].OldPath)
+	}
+	if strings.Join(stored, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records out of discovery order:\n%v\nwant\n%v", stored, want)
+	}
+}
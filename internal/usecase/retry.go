@@ -0,0 +1,207 @@
+// Retry queue: renames that failed with a transient error are tried again later
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+const (
+	// retryWorkerInterval là chu kỳ worker kiểm tra lượt thử lại đã tới hạn
+	retryWorkerInterval = 10 * time.Second
+	// retryMaxBackoff giới hạn khoảng chờ giữa hai lần thử lại
+	retryMaxBackoff = 6 * time.Hour
+	// retryBatchSize là số lượt thử lại được lấy ra mỗi lần
+	retryBatchSize = 100
+	// retryMetricsRoot là nhãn root và run id của các đổi tên do retry worker thực hiện
+	retryMetricsRoot = "retry"
+)
+
+// ErrCannotRetry báo bản ghi không thể thử lại (đổi tên đã thành công, file không còn...)
+var ErrCannotRetry = errors.New("cannot retry")
+
+// retryWake đánh thức worker ngay khi có file được thử lại thủ công
+var retryWake = make(chan struct{}, 1)
+
+var retryResults = infrastructure.Metrics.NewCounterVec(
+	"auto_rename_rename_retries_total",
+	"Rename retries, by result (renamed, retry, failed).",
+	"result")
+
+// transientErrnos là các lỗi có thể tự hết: file đang bị khóa hoặc dùng, thiếu
+// quyền (có thể được sửa), đĩa đầy hoặc chỉ đọc, lỗi I/O tạm thời
+var transientErrnos = []syscall.Errno{
+	syscall.EBUSY, syscall.ETXTBSY, syscall.EAGAIN, syscall.EINTR,
+	syscall.EACCES, syscall.EPERM, syscall.EROFS,
+	syscall.ENOSPC, syscall.EDQUOT, syscall.EIO, syscall.ETIMEDOUT,
+	syscall.EMFILE, syscall.ENFILE,
+}
+
+// transientError cho biết lỗi đổi tên có đáng thử lại không. File không còn,
+// trùng tên, lỗi luật và lỗi layout không tự hết nên không thử lại.
+func transientError(err error) bool {
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackoff là thời gian chờ trước lần thử lại thứ attempt (bắt đầu từ 1)
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	backoff := base
+	for i := 1; i < attempt && backoff < retryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > retryMaxBackoff {
+		backoff = retryMaxBackoff
+	}
+	return backoff
+}
+
+// scheduleRetry đưa file vừa đổi tên lỗi tạm thời trong lượt quét vào hàng đợi thử lại
+func scheduleRetry(config config.Config, db *infrastructure.Database, run runInfo, result FileResult, logger *slog.Logger) {
+	if config.RetryMaxAttempts == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	backoff := retryBackoff(config.RetryBackoff, 1)
+	retry, err := db.ScheduleRenameRetry(domain.RenameRetry{
+		Path:          absOrSelf(result.Path),
+		Root:          absOrSelf(run.Root),
+		OriginalName:  result.OldName,
+		LastError:     result.Reason,
+		CreatedAt:     now.Format(time.RFC3339),
+		UpdatedAt:     now.Format(time.RFC3339),
+		NextAttemptAt: now.Add(backoff).Format(time.RFC3339),
+	})
+	if err != nil {
+		logger.Error("failed to schedule rename retry", "path", result.Path, "error", err)
+		return
+	}
+	logger.Info("rename will be retried", "path", result.Path, "retry_id", retry.ID, "retry_in", backoff.String())
+}
+
+// RetryRecord đưa file của một bản ghi thất bại vào hàng đợi để thử lại ngay,
+// kể cả khi lỗi không phải tạm thời. Số lần thử lại được đặt lại từ đầu.
+func RetryRecord(config config.Config, db *infrastructure.Database, id int) (domain.RenameRetry, error) {
+	// Worker không chạy ở chế độ dry-run nên lượt thử lại sẽ không bao giờ tới
+	if config.DryRun {
+		return domain.RenameRetry{}, fmt.Errorf("%w: dry-run mode is on", ErrCannotRetry)
+	}
+	record, err := db.GetFileRecord(id)
+	if err != nil {
+		return domain.RenameRetry{}, fmt.Errorf("record %d: %w", id, err)
+	}
+	if record.Success {
+		return domain.RenameRetry{}, fmt.Errorf("%w: record %d is not a failed rename", ErrCannotRetry, id)
+	}
+	// Bản ghi trước phiên bản schema 7 không có old_path; khi đó file chưa rời thư mục cũ
+	path := record.OldPath
+	if path == "" {
+		path = absOrSelf(filepath.Join(record.FilePath, record.OriginalName))
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return domain.RenameRetry{}, fmt.Errorf("%w: file is gone: %v", ErrCannotRetry, err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	retry, err := db.ScheduleRenameRetry(domain.RenameRetry{
+		Path:          path,
+		Root:          scanRoot(config, path),
+		OriginalName:  record.OriginalName,
+		LastError:     record.ErrorMsg,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		NextAttemptAt: now,
+	})
+	if err != nil {
+		return retry, err
+	}
+	select {
+	case retryWake <- struct{}{}:
+	default:
+	}
+	slog.Info("rename retry requested", "record", id, "path", path, "retry_id", retry.ID)
+	return retry, nil
+}
+
+// StartRetryWorker thử lại các file trong hàng đợi khi tới hạn. Ở chế độ dry-run
+// worker không chạy; các lượt đã có trong hàng đợi chờ tới khi tắt dry-run.
+func StartRetryWorker(config config.Config, db *infrastructure.Database) {
+	if config.DryRun {
+		slog.Info("retry worker disabled in dry-run mode")
+		return
+	}
+	slog.Info("retry worker initialized", "max_attempts", config.RetryMaxAttempts, "backoff", config.RetryBackoff)
+	ticker := time.NewTicker(retryWorkerInterval)
+	for {
+		select {
+		case <-ticker.C:
+		case <-retryWake:
+		}
+		for {
+			items, err := db.GetDueRenameRetries(time.Now().UTC().Format(time.RFC3339), retryBatchSize)
+			if err != nil {
+				slog.Error("failed to load rename retries", "error", err)
+				break
+			}
+			for _, item := range items {
+				executeRetry(config, db, item)
+			}
+			if len(items) < retryBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// executeRetry chạy lại quy trình đổi tên cho file, ghi bản ghi mới và cập nhật
+// lượt thử: xong khi đổi tên được, chờ tiếp khi vẫn lỗi tạm thời và còn lượt, còn lại là failed
+func executeRetry(config config.Config, db *infrastructure.Database, item domain.RenameRetry) {
+	logger := slog.With("run_id", retryMetricsRoot, "root", item.Root, "trigger", TriggerRetry, "retry_id", item.ID)
+	run := runInfo{ID: retryMetricsRoot, Root: item.Root, Trigger: TriggerRetry, Counter: newRuleCounter(config, db)}
+	result, records := processFile(config, db, item.Path, run, logger)
+	if len(records) > 0 {
+		if err := db.InsertFileRecords(records); err != nil {
+			logger.Error("failed to record rename", "path", item.Path, "error", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	item.Attempts++
+	item.UpdatedAt = now.Format(time.RFC3339)
+	switch {
+	case result.Status == StatusRenamed || result.Status == StatusQueued:
+		item.Status, item.LastError = domain.RetryStatusDone, ""
+		retryResults.Inc("renamed")
+	case result.Status == StatusSkipped:
+		item.Status, item.LastError = domain.RetryStatusFailed, "skipped: "+result.Reason
+		retryResults.Inc("failed")
+		logger.Info("rename retry skipped", "path", item.Path, "reason", result.Reason)
+	case result.Retryable && item.Attempts < config.RetryMaxAttempts:
+		backoff := retryBackoff(config.RetryBackoff, item.Attempts+1)
+		item.LastError = result.Reason
+		item.NextAttemptAt = now.Add(backoff).Format(time.RFC3339)
+		retryResults.Inc("retry")
+		logger.Info("rename will be retried", "path", item.Path, "attempts", item.Attempts, "retry_in", backoff.String())
+	default:
+		item.Status, item.LastError = domain.RetryStatusFailed, result.Reason
+		retryResults.Inc("failed")
+		logger.Warn("rename retry gave up", "path", item.Path, "attempts", item.Attempts, "error", result.Reason)
+	}
+	if err := db.UpdateRenameRetry(item); err != nil {
+		logger.Error("failed to update rename retry", "error", err)
+	}
+	observeFile(retryMetricsRoot, result, false)
+	publishEvent(Event{Type: fileEventType(result.Status), RunID: retryMetricsRoot, Root: item.Root, File: &result})
+}
@@ -0,0 +1,139 @@
+package usecase
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+)
+
+func TestRetryDryRun(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	path := writeTestFile(t, dir, "locked.txt", "data")
+	if err := db.InsertFileRecords([]domain.FileRecord{{OriginalName: "locked.txt", FilePath: dir, OldPath: path, ErrorMsg: "device or resource busy"}}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{Dir: dir, DryRun: true, RetryMaxAttempts: 3, RetryBackoff: time.Minute}
+
+	if _, err := RetryRecord(cfg, db, 1); !errors.Is(err, ErrCannotRetry) {
+		t.Errorf("RetryRecord in dry-run mode = %v, want ErrCannotRetry", err)
+	}
+	if queued, _ := db.GetRenameRetries("", 10); len(queued) != 0 {
+		t.Errorf("%d retries queued in dry-run mode, want none", len(queued))
+	}
+
+	// Worker không chạy: trả về ngay thay vì đổi tên thật
+	done := make(chan struct{})
+	go func() {
+		StartRetryWorker(cfg, db)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("StartRetryWorker kept running in dry-run mode")
+	}
+}
+
+func TestExecuteRetry(t *testing.T) {
+	busy := &os.LinkError{Op: "rename", Err: syscall.EBUSY}
+	tests := []struct {
+		name     string
+		file     string
+		attempts int
+		moveErr  error
+		status   string
+		lastErr  string
+		backoff  time.Duration
+	}{
+		{"renamed", "locked.txt", 0, nil, domain.RetryStatusDone, "", 0},
+		{"still busy", "locked.txt", 0, busy, domain.RetryStatusPending, "device or resource busy", 2 * time.Minute},
+		{"backoff doubles", "locked.txt", 2, busy, domain.RetryStatusPending, "device or resource busy", 8 * time.Minute},
+		{"attempts exhausted", "locked.txt", 4, busy, domain.RetryStatusFailed, "device or resource busy", 0},
+		{"permanent error", "locked.txt", 0, errors.New("invalid cross-device link"), domain.RetryStatusFailed, "invalid cross-device link", 0},
+		{"skipped", "123e4567-e89b-42d3-a456-426614174000.txt", 0, nil, domain.RetryStatusFailed, "skipped: ", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := newTestDatabase(t)
+			path := writeTestFile(t, dir, tt.file, "data")
+			moveErr := tt.moveErr
+			orig := moveFile
+			moveFile = func(oldPath, newPath string) (string, error) {
+				if moveErr != nil {
+					return "", moveErr
+				}
+				return orig(oldPath, newPath)
+			}
+			t.Cleanup(func() { moveFile = orig })
+
+			cfg := config.Config{Dir: dir, CollisionPolicy: domain.CollisionRegenerate, RetryMaxAttempts: 5, RetryBackoff: time.Minute}
+			now := time.Now().UTC().Format(time.RFC3339)
+			item, err := db.ScheduleRenameRetry(domain.RenameRetry{Path: path, Root: dir, OriginalName: tt.file, CreatedAt: now, UpdatedAt: now, NextAttemptAt: now})
+			if err != nil {
+				t.Fatal(err)
+			}
+			item.Attempts = tt.attempts
+			start := time.Now().UTC().Truncate(time.Second)
+			executeRetry(cfg, db, item)
+
+			retries, err := db.GetRenameRetries("", 10)
+			if err != nil || len(retries) != 1 {
+				t.Fatalf("retries = %v, %v, want 1", retries, err)
+			}
+			got := retries[0]
+			if got.Status != tt.status || got.Attempts != tt.attempts+1 || !strings.Contains(got.LastError, tt.lastErr) {
+				t.Errorf("retry = %s after %d attempts (%q), want %s after %d containing %q",
+					got.Status, got.Attempts, got.LastError, tt.status, tt.attempts+1, tt.lastErr)
+			}
+			if tt.backoff > 0 {
+				next, _ := time.Parse(time.RFC3339, got.NextAttemptAt)
+				if d := next.Sub(start); d < tt.backoff || d > tt.backoff+2*time.Second {
+					t.Errorf("next attempt in %s, want %s", d, tt.backoff)
+				}
+			}
+			// File chỉ rời chỗ cũ khi đổi tên thành công
+			_, statErr := os.Stat(path)
+			if renamed := tt.status == domain.RetryStatusDone; renamed != os.IsNotExist(statErr) {
+				t.Errorf("stat %s after retry = %v", filepath.Base(path), statErr)
+			}
+		})
+	}
+}
+
+func TestScanSchedulesRetry(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	writeTestFile(t, dir, "locked.txt", "data")
+	orig := moveFile
+	moveFile = func(oldPath, newPath string) (string, error) {
+		return "", &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EBUSY}
+	}
+	t.Cleanup(func() { moveFile = orig })
+	cfg := config.Config{Dir: dir, CollisionPolicy: domain.CollisionRegenerate, RetryMaxAttempts: 3, RetryBackoff: time.Minute}
+
+	summary, err := ScanDirectory(cfg, db, TriggerCLI)
+	if err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+	if summary.Failed != 1 || len(summary.Failures) != 1 || !summary.Failures[0].Retryable {
+		t.Fatalf("summary = %d failed %+v, want one retryable failure", summary.Failed, summary.Failures)
+	}
+	retries, err := db.GetRenameRetries(domain.RetryStatusPending, 10)
+	if err != nil || len(retries) != 1 || retries[0].Attempts != 0 {
+		t.Fatalf("retries = %+v, %v, want one pending retry", retries, err)
+	}
+	// Lượt quét sau để file cho retry worker
+	reason, _, err := skipReason(cfg, db, filepath.Join(dir, "locked.txt"), testRun(cfg, db))
+	if err != nil || reason != "retry pending" {
+		t.Errorf("skip reason on next scan = %q, %v, want retry pending", reason, err)
+	}
+}
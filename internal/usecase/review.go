@@ -0,0 +1,234 @@
+// Human review queue: planned renames wait for approval before execution
+package usecase
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// reviewWorkerInterval là chu kỳ worker kiểm tra đề xuất đã duyệt và hết hạn
+const reviewWorkerInterval = 10 * time.Second
+
+// reviewRejectedReason là lý do bỏ qua file có đề xuất đã bị từ chối; file được
+// đề xuất lại khi kích thước hoặc thời điểm sửa thay đổi
+const reviewRejectedReason = "rejected in review"
+
+// reviewWake đánh thức worker ngay khi có đề xuất vừa được duyệt
+var reviewWake = make(chan struct{}, 1)
+
+// queueForReview lưu đổi tên dự kiến vào hàng chờ duyệt thay vì đổi tên ngay
+func queueForReview(config config.Config, db *infrastructure.Database, result FileResult, record domain.FileRecord, path string, logger *slog.Logger) FileResult {
+	// Luật có thể chuyển file sang thư mục khác: new_name khi đó là đường dẫn
+	// tương đối so với thư mục hiện tại của file
+	newName := record.NewName
+	if record.FilePath != filepath.Dir(path) {
+		if rel, err := filepath.Rel(filepath.Dir(path), filepath.Join(record.FilePath, record.NewName)); err == nil {
+			newName = rel
+		}
+	}
+	// Lưu đường dẫn tuyệt đối vì worker có thể chạy ở tiến trình khác
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	now := time.Now().UTC()
+	queued, err := db.InsertPendingRename(domain.PendingRename{
+		Path:         path,
+		OriginalName: record.OriginalName,
+		NewName:      newName,
+		FileSize:     record.FileSize,
+		ModTime:      record.ModTime,
+		CreatedAt:    now.Format(time.RFC3339),
+		ExpiresAt:    now.Add(config.ReviewExpiry).Format(time.RFC3339),
+	})
+	if err != nil {
+		logger.Error("failed to queue rename for review", "path", path, "error", err)
+		result.Status, result.Reason = StatusFailed, fmt.Sprintf("queue for review: %v", err)
+		return result
+	}
+	if !queued {
+		logger.Debug("file skipped", "path", path, "reason", "awaiting review")
+		result.Status, result.Reason = StatusSkipped, "awaiting review"
+		return result
+	}
+	logger.Info("rename queued for approval", "path", path, "old", record.OriginalName, "new", newName)
+	result.Status = StatusQueued
+	return result
+}
+
+// DecideRenames duyệt hoặc từ chối các đề xuất đang chờ, trả về số đề xuất được cập nhật
+func DecideRenames(db *infrastructure.Database, ids []int, approve bool) (int64, error) {
+	status := domain.PendingStatusRejected
+	if approve {
+		status = domain.PendingStatusApproved
+	}
+	n, err := db.DecidePendingRenames(ids, status, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	if approve && n > 0 {
+		select {
+		case reviewWake <- struct{}{}:
+		default:
+		}
+	}
+	return n, nil
+}
+
+// StartReviewWorker thực hiện các đề xuất đã duyệt và đánh dấu hết hạn đề xuất quá hạn
+func StartReviewWorker(config config.Config, db *infrastructure.Database) {
+	slog.Info("review worker initialized", "expiry", config.ReviewExpiry)
+	ticker := time.NewTicker(reviewWorkerInterval)
+	for {
+		select {
+		case <-ticker.C:
+		case <-reviewWake:
+		}
+		if n, err := db.ExpirePendingRenames(time.Now().UTC().Format(time.RFC3339)); err != nil {
+			slog.Error("failed to expire pending renames", "error", err)
+		} else if n > 0 {
+			slog.Info("pending renames expired", "count", n)
+		}
+		for {
+			items, err := db.GetApprovedRenames(100)
+			if err != nil {
+				slog.Error("failed to load approved renames", "error", err)
+				break
+			}
+			for _, item := range items {
+				executeApprovedRename(config, db, item)
+			}
+			if len(items) < 100 {
+				break
+			}
+		}
+	}
+}
+
+// executeApprovedRename kiểm tra file vẫn còn và không đổi kể từ lúc đề xuất rồi mới đổi tên;
+// pre-rename hook từ chối thì đề xuất được đánh dấu failed với lý do từ chối
+func executeApprovedRename(config config.Config, db *infrastructure.Database, item domain.PendingRename) {
+	result := FileResult{Path: item.Path, OldName: item.OriginalName, NewName: item.NewName}
+	logger := slog.With("run_id", reviewMetricsRoot, "root", filepath.Dir(item.Path), "trigger", reviewMetricsRoot, "pending_id", item.Id)
+	fail := func(msg string) {
+		logger.Warn("approved rename not executed", "path", item.Path, "reason", msg)
+		if err := db.CompletePendingRename(item.Id, domain.PendingStatusFailed, msg); err != nil {
+			logger.Error("failed to update pending rename", "error", err)
+		}
+		result.Status, result.Reason = StatusFailed, msg
+		observeFile(reviewMetricsRoot, result, false)
+		publishEvent(Event{Type: EventFileFailed, RunID: "review", Root: filepath.Dir(item.Path), File: &result})
+	}
+
+	fileSize, fileMode, modTime, err := infrastructure.GetFileInfo(item.Path)
+	if err != nil {
+		fail(fmt.Sprintf("file no longer available: %v", err))
+		return
+	}
+	if fileSize != item.FileSize || modTime != item.ModTime {
+		fail("file changed since the rename was proposed")
+		return
+	}
+
+	newPath := filepath.Join(filepath.Dir(item.Path), item.NewName)
+	result.NewName, result.NewPath = filepath.Base(newPath), newPath
+	if filepath.Dir(newPath) != filepath.Dir(item.Path) {
+		// Đề xuất chuyển thư mục từ luật đặt tên
+		if err := prepareTarget(newPath); err != nil {
+			fail(err.Error())
+			return
+		}
+	}
+	content := inspectFile(config, item.Path, logger)
+	_, newExt := splitExt(config, filepath.Base(newPath))
+	result.MimeType, result.ExtMismatch = content.Type.MIME, content.Mismatch
+	record := domain.FileRecord{
+		OriginalName: item.OriginalName,
+		NewName:      filepath.Base(newPath),
+		FilePath:     filepath.Dir(newPath),
+		OldPath:      item.Path,
+		NewPath:      newPath,
+		Extension:    strings.ToLower(newExt),
+		MimeType:     content.Type.MIME,
+		ExtMismatch:  content.Mismatch,
+		Metadata:     content.Metadata,
+		FileSize:     fileSize,
+		FileMode:     fileMode,
+		ModTime:      modTime,
+		Success:      true,
+		RenamedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+	// Nhóm file đi kèm được đọc trước khi file chính đổi tên; file đi kèm lẻ theo
+	// tên mới của file chính đã đổi tên thì vào nhóm của file chính
+	run := runInfo{ID: reviewMetricsRoot, Root: filepath.Dir(item.Path), Trigger: reviewMetricsRoot}
+	var group *renameGroup
+	var leader *domain.FileRecord
+	if g := (*sidecarIndex)(nil).groupOf(config, item.Path); g != nil && g.Leader == filepath.Base(item.Path) {
+		if group, err = newRenameGroup(config, db, run, item.Path, g, content, logger); err != nil {
+			fail(fmt.Sprintf("db lookup: %v", err))
+			return
+		}
+	} else if g == nil && isSidecar(config, item.OriginalName) {
+		var follow ruleTarget
+		if leader, follow, err = followLeader(config, db, item.Path, content); err != nil {
+			fail(fmt.Sprintf("db lookup: %v", err))
+			return
+		}
+		if follow.Path != newPath {
+			leader = nil
+		}
+	}
+	strategy, veto, err := renameWithHooks(config, run, reviewMetricsRoot, item.Path, newPath, fileSize, logger)
+	record.MoveStrategy = strategy
+	if veto != "" {
+		fail(veto)
+		return
+	}
+	if err != nil {
+		record.Success = false
+		record.ErrorMsg = err.Error()
+		record.ErrorType = domain.ErrorTypeRename
+		_ = db.InsertFileRecord(record)
+		fail(err.Error())
+		return
+	}
+	records := []domain.FileRecord{record}
+	if group != nil {
+		target := ruleTarget{Name: filepath.Base(newPath), Path: newPath}
+		members, memberResults, err := renameMembers(config, run, reviewMetricsRoot, group, target, false, logger)
+		if err != nil {
+			// Cả nhóm được đổi tên hoặc không file nào: chuyển file chính lại chỗ cũ
+			if _, moveErr := timedRename(reviewMetricsRoot, newPath, item.Path); moveErr != nil {
+				logger.Error("failed to move file back", "path", newPath, "to", item.Path, "error", moveErr)
+				err = fmt.Errorf("%w; moving %s back: %v", err, item.OriginalName, moveErr)
+			}
+			record.Success = false
+			record.ErrorMsg = err.Error()
+			record.ErrorType = domain.ErrorTypeRename
+			_ = db.InsertFileRecord(record)
+			fail(err.Error())
+			return
+		}
+		records[0].GroupID = group.ID
+		records = append(records, members...)
+		result.Sidecars = memberResults
+	} else if leader != nil {
+		records[0].GroupID = joinLeaderGroup(db, leader, logger)
+	}
+	if err := db.InsertFileRecords(records); err != nil {
+		logger.Error("failed to record rename", "path", item.Path, "error", err)
+	}
+	if err := db.CompletePendingRename(item.Id, domain.PendingStatusDone, ""); err != nil {
+		logger.Error("failed to update pending rename", "error", err)
+	}
+	logger.Info("file renamed", "path", item.Path, "old", item.OriginalName, "new", newPath)
+	result.Status = StatusRenamed
+	observeFile(reviewMetricsRoot, result, false)
+	publishEvent(Event{Type: EventFileRenamed, RunID: "review", Root: filepath.Dir(item.Path), File: &result})
+}
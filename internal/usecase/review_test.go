@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// pendingByName đọc mọi đề xuất, đề xuất mới nhất của mỗi tên gốc
+func pendingByName(t *testing.T, db *infrastructure.Database) map[string]domain.PendingRename {
+	t.Helper()
+	items, err := db.GetPendingRenamesPage("", 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]domain.PendingRename{}
+	for i := len(items) - 1; i >= 0; i-- {
+		byName[items[i].OriginalName] = items[i]
+	}
+	return byName
+}
+
+func TestReviewLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	for _, name := range []string{"approved.txt", "changed.txt", "rejected.txt", "waiting.txt"} {
+		writeTestFile(t, dir, name, name)
+	}
+	cfg := config.Config{Dir: dir, Workers: 2, DBBatchSize: 10, CollisionPolicy: domain.CollisionRegenerate, ReviewMode: true, ReviewExpiry: time.Hour}
+
+	summary, err := ScanDirectory(cfg, db, TriggerCLI)
+	if err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+	if summary.Queued != 4 || summary.Renamed != 0 {
+		t.Fatalf("first scan = %d queued, %d renamed, want 4 queued", summary.Queued, summary.Renamed)
+	}
+	// Đề xuất đang chờ không được đề xuất lại
+	if summary, _ = ScanDirectory(cfg, db, TriggerCLI); summary.Skipped != 4 {
+		t.Errorf("second scan = %d skipped, want 4 awaiting review", summary.Skipped)
+	}
+	pending := pendingByName(t, db)
+	if len(pending) != 4 {
+		t.Fatalf("pending = %v, want 4 proposals", pending)
+	}
+	waiting := pending["waiting.txt"]
+	created, _ := time.Parse(time.RFC3339, waiting.CreatedAt)
+	if expires, _ := time.Parse(time.RFC3339, waiting.ExpiresAt); expires.Sub(created) != cfg.ReviewExpiry {
+		t.Errorf("proposal expires at %s, created at %s, want REVIEW_EXPIRY later", waiting.ExpiresAt, waiting.CreatedAt)
+	}
+
+	if n, err := DecideRenames(db, []int{pending["approved.txt"].Id, pending["changed.txt"].Id}, true); err != nil || n != 2 {
+		t.Fatalf("approve = %d, %v, want 2", n, err)
+	}
+	if n, err := DecideRenames(db, []int{pending["rejected.txt"].Id, pending["approved.txt"].Id}, false); err != nil || n != 1 {
+		t.Errorf("reject = %d, %v, want only the undecided proposal", n, err)
+	}
+	// File đổi sau khi được đề xuất thì không được đổi tên
+	writeTestFile(t, dir, "changed.txt", "changed after review")
+
+	approved, err := db.GetApprovedRenames(100)
+	if err != nil || len(approved) != 2 {
+		t.Fatalf("approved = %v, %v, want 2", approved, err)
+	}
+	for _, item := range approved {
+		executeApprovedRename(cfg, db, item)
+	}
+	pending = pendingByName(t, db)
+	done := pending["approved.txt"]
+	if done.Status != domain.PendingStatusDone {
+		t.Errorf("approved.txt proposal = %s (%s), want done", done.Status, done.ErrorMsg)
+	}
+	if _, err := os.Stat(filepath.Join(dir, done.NewName)); err != nil {
+		t.Errorf("approved.txt not renamed to %s: %v", done.NewName, err)
+	}
+	if changed := pending["changed.txt"]; changed.Status != domain.PendingStatusFailed || changed.ErrorMsg != "file changed since the rename was proposed" {
+		t.Errorf("changed.txt proposal = %s (%s), want failed as changed", changed.Status, changed.ErrorMsg)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "changed.txt")); err != nil {
+		t.Errorf("changed.txt: %v", err)
+	}
+	if n, _ := db.CountFileRecords(); n != 1 {
+		t.Errorf("file records = %d, want 1 for the executed rename", n)
+	}
+
+	// Lượt quét sau: file bị từ chối và chưa đổi thì bỏ qua, file lỗi được đề xuất lại
+	summary, err = ScanDirectory(cfg, db, TriggerCLI)
+	if err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+	if summary.Queued != 1 || summary.Skipped != 3 {
+		t.Errorf("third scan = %d queued, %d skipped, want changed.txt queued again", summary.Queued, summary.Skipped)
+	}
+	if p := pendingByName(t, db)["changed.txt"]; p.Status != domain.PendingStatusPending {
+		t.Errorf("changed.txt proposal = %s, want pending again", p.Status)
+	}
+	writeTestFile(t, dir, "rejected.txt", "edited after rejection")
+	if summary, _ = ScanDirectory(cfg, db, TriggerCLI); summary.Queued != 1 {
+		t.Errorf("scan after editing rejected file = %d queued, want 1", summary.Queued)
+	}
+
+	// Hết hạn chỉ áp dụng cho đề xuất chưa được duyệt
+	if n, err := db.ExpirePendingRenames(time.Now().UTC().Format(time.RFC3339)); err != nil || n != 0 {
+		t.Errorf("expire now = %d, %v, want 0", n, err)
+	}
+	later := time.Now().UTC().Add(2 * cfg.ReviewExpiry).Format(time.RFC3339)
+	if n, err := db.ExpirePendingRenames(later); err != nil || n != 3 {
+		t.Errorf("expire after REVIEW_EXPIRY = %d, %v, want 3", n, err)
+	}
+	pending = pendingByName(t, db)
+	for name, want := range map[string]string{"waiting.txt": domain.PendingStatusExpired, "rejected.txt": domain.PendingStatusExpired, "approved.txt": domain.PendingStatusDone} {
+		if got := pending[name].Status; got != want {
+			t.Errorf("%s proposal = %s, want %s", name, got, want)
+		}
+	}
+	if n, _ := DecideRenames(db, []int{waiting.Id}, true); n != 0 {
+		t.Errorf("approved %d expired proposals, want 0", n)
+	}
+}
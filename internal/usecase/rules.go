@@ -0,0 +1,211 @@
+// Naming rules: scripted names, skips and target directories
+package usecase
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/infrastructure"
+	"auto-rename/internal/rules"
+)
+
+// ruleSkipPrefix mở đầu lý do bỏ qua file khi luật chọn skip()
+const ruleSkipPrefix = "skipped by rule"
+
+// ruleErrorPrefix mở đầu lý do lỗi khi luật không chạy được với file
+const ruleErrorPrefix = "rule error"
+
+// dbRuleCounter cấp số seq() từ bảng rule_counters, dùng khi đổi tên thật
+type dbRuleCounter struct {
+	db *infrastructure.Database
+}
+
+func (c dbRuleCounter) Next(name string) (int64, error) {
+	return c.db.NextRuleCounter(name)
+}
+
+// previewRuleCounter đọc giá trị hiện tại trong DB rồi tăng trong bộ nhớ, để
+// dry-run và xem trước hiển thị đúng số sẽ được cấp mà không tiêu thụ bộ đếm
+type previewRuleCounter struct {
+	db   *infrastructure.Database
+	mu   sync.Mutex
+	used map[string]int64
+}
+
+func (c *previewRuleCounter) Next(name string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.used[name]
+	if !ok {
+		var err error
+		if value, err = c.db.PeekRuleCounter(name); err != nil {
+			return 0, err
+		}
+	}
+	value++
+	c.used[name] = value
+	return value, nil
+}
+
+// newRuleCounter tạo bộ đếm cho một lượt quét
+func newRuleCounter(config config.Config, db *infrastructure.Database) rules.Counter {
+	if config.DryRun {
+		return &previewRuleCounter{db: db, used: map[string]int64{}}
+	}
+	return dbRuleCounter{db: db}
+}
+
+// ruleTarget là tên và đường dẫn mới sau khi áp dụng luật
+type ruleTarget struct {
+	Name string
+	Path string
+	// Rule là vị trí luật đã khớp, rỗng khi không có luật nào khớp
+	Rule string
+	// Moved cho biết luật đã chọn thư mục đích bằng dir()
+	Moved bool
+}
+
+// applyRules áp dụng luật cho file, với newName là tên mặc định. skip khác rỗng
+// là lý do bỏ qua file; err là lỗi khi chạy luật hoặc tạo thư mục đích.
+func applyRules(config config.Config, run runInfo, path, newName string, size int64, content fileContent) (target ruleTarget, skip string, err error) {
+	target = ruleTarget{Name: newName, Path: filepath.Join(filepath.Dir(path), newName)}
+	if config.Rules == nil {
+		return target, "", nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return target, "", err
+	}
+	d, err := config.Rules.Evaluate(ruleFile(config, path, run.Root, size, info, content), run.Counter)
+	if err != nil {
+		return target, "", err
+	}
+	if !d.Matched {
+		return target, "", nil
+	}
+	target.Rule = d.Rule
+	if d.Skip {
+		return target, fmt.Sprintf("%s %s: %s", ruleSkipPrefix, d.Rule, d.Reason), nil
+	}
+	if d.Name != "" {
+		target.Name = d.Name
+	}
+	dir := filepath.Dir(path)
+	if d.Dir != "" {
+		dir = filepath.Join(run.Root, filepath.FromSlash(d.Dir))
+		target.Moved = true
+	}
+	target.Path = filepath.Join(dir, target.Name)
+	if target.Path == path {
+		return target, "name unchanged by rule " + d.Rule, nil
+	}
+	return target, "", nil
+}
+
+// ruleSkipReason trả về lý do bỏ qua khi luật chọn skip() cho file, rỗng khi
+// không; không tiêu thụ bộ đếm seq(). Dùng cho file đi kèm được đổi tên theo
+// file chính thay vì theo luật.
+func ruleSkipReason(config config.Config, db *infrastructure.Database, root, path string, content fileContent) (string, error) {
+	if config.Rules == nil {
+		return "", nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	d, err := config.Rules.Evaluate(ruleFile(config, path, root, info.Size(), info, content), &previewRuleCounter{db: db, used: map[string]int64{}})
+	if err != nil || !d.Matched || !d.Skip {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s: %s", ruleSkipPrefix, d.Rule, d.Reason), nil
+}
+
+// ruleFile tạo metadata file cho luật, với đuôi file đã sửa theo nội dung và
+// metadata ảnh/video của file
+func ruleFile(config config.Config, path, root string, size int64, info os.FileInfo, content fileContent) rules.File {
+	base, _ := splitExt(config, filepath.Base(path))
+	_, ext := splitExt(config, content.Name)
+	f := rules.File{
+		Path:     path,
+		Root:     root,
+		Size:     size,
+		ModTime:  info.ModTime(),
+		Mode:     info.Mode().String(),
+		Base:     base,
+		Ext:      ext,
+		MimeType: content.Type.MIME,
+	}
+	if t, ok := content.takenAt(); ok {
+		f.TakenAt = t
+	}
+	if m := content.Metadata; m != nil {
+		f.CameraMake, f.CameraModel = m.CameraMake, m.CameraModel
+		f.Width, f.Height, f.Duration = int64(m.Width), int64(m.Height), m.Duration
+	}
+	return f
+}
+
+// prepareTarget tạo thư mục đích do luật chọn và từ chối ghi đè file đã có
+func prepareTarget(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%w: %s", infrastructure.ErrTargetExists, target)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// scanRoot trả về thư mục quét chứa file (đường dẫn tuyệt đối), hoặc thư mục
+// của file khi file nằm ngoài thư mục quét
+func scanRoot(config config.Config, abs string) string {
+	if config.Dir != "" {
+		if root, err := absPath(config.Dir); err == nil && isWithin(abs, root) {
+			return root
+		}
+	}
+	return filepath.Dir(abs)
+}
+
+// RuleTest là kết quả thử luật với một file, cho lệnh "rules test"
+type RuleTest struct {
+	Path     string
+	Root     string
+	Vars     map[string]string
+	Decision rules.Decision
+	// Ext là đuôi tên UUID mặc định giữ lại, kể cả đuôi ghép và đuôi đã sửa theo nội dung
+	Ext string
+}
+
+// TestRules áp dụng luật cho file mà không đổi tên hay tăng bộ đếm seq().
+// File ngoài thư mục quét được thử với root là thư mục chứa nó.
+func TestRules(config config.Config, db *infrastructure.Database, path string) (RuleTest, error) {
+	if config.Rules == nil {
+		return RuleTest{}, fmt.Errorf("no rules configured, set RULES_FILE or -rules")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return RuleTest{}, err
+	}
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return RuleTest{}, err
+	}
+	if info.IsDir() {
+		return RuleTest{}, fmt.Errorf("%s is a directory", path)
+	}
+	root := scanRoot(config, abs)
+	content := inspectFile(config, abs, slog.Default())
+	file := ruleFile(config, abs, root, info.Size(), info, content)
+	test := RuleTest{Path: abs, Root: root, Vars: rules.FileVars(file)}
+	_, test.Ext = splitExt(config, content.Name)
+	counter := &previewRuleCounter{db: db, used: map[string]int64{}}
+	test.Decision, err = config.Rules.Evaluate(file, counter)
+	return test, err
+}
@@ -0,0 +1,97 @@
+// On-demand scans and dry-run previews
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/infrastructure"
+)
+
+// ScanRequest là yêu cầu quét từ API; các trường rỗng giữ nguyên cấu hình gốc
+type ScanRequest struct {
+	Dir     string `json:"dir"`
+	Profile string `json:"profile"`
+	DryRun  *bool  `json:"dry_run"`
+}
+
+// ErrInvalidScanRequest báo yêu cầu quét không hợp lệ
+var ErrInvalidScanRequest = errors.New("invalid scan request")
+
+// errPreviewLimit dừng việc duyệt khi preview đủ số file
+var errPreviewLimit = errors.New("preview limit reached")
+
+// ResolveScanConfig áp dụng profile và thư mục của yêu cầu lên cấu hình gốc.
+// Thư mục chỉ được nằm trong thư mục gốc hoặc thư mục của một profile.
+func ResolveScanConfig(base config.Config, req ScanRequest) (config.Config, error) {
+	cfg := base
+	if req.Profile != "" {
+		var err error
+		if cfg, err = base.WithProfile(req.Profile); err != nil {
+			return cfg, fmt.Errorf("%w: %v", ErrInvalidScanRequest, err)
+		}
+	}
+	if req.Dir != "" {
+		if !dirAllowed(base, req.Dir) {
+			return cfg, fmt.Errorf("%w: directory %s is outside the configured scan roots", ErrInvalidScanRequest, req.Dir)
+		}
+		cfg.Dir = req.Dir
+	}
+	if req.DryRun != nil {
+		cfg.DryRun = *req.DryRun
+	}
+	if cfg.Dir == "" {
+		return cfg, fmt.Errorf("%w: no directory configured", ErrInvalidScanRequest)
+	}
+	if info, err := os.Stat(cfg.Dir); err != nil || !info.IsDir() {
+		return cfg, fmt.Errorf("%w: directory does not exist: %s", ErrInvalidScanRequest, cfg.Dir)
+	}
+	return cfg, nil
+}
+
+// dirAllowed kiểm tra dir nằm trong thư mục gốc hoặc thư mục của một profile
+func dirAllowed(base config.Config, dir string) bool {
+	absDir, err := absPath(dir)
+	if err != nil {
+		return false
+	}
+	roots := []string{base.Dir}
+	for _, p := range base.Profiles {
+		roots = append(roots, p.Dir)
+	}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		absRoot, err := absPath(root)
+		if err == nil && isWithin(absDir, absRoot) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviewRenames trả về các thay đổi tên dự kiến mà không đổi tên file hay ghi DB
+func PreviewRenames(config config.Config, db *infrastructure.Database, limit int) ([]FileResult, bool, error) {
+	config.DryRun = true
+	logger := slog.With("root", config.Dir, "trigger", TriggerPreview)
+	run := runInfo{Root: config.Dir, Trigger: TriggerPreview, Counter: newRuleCounter(config, db), Sidecars: newSidecarIndex()}
+	results := []FileResult{}
+	truncated := false
+	err := infrastructure.WalkFiles(config.Dir, config.RenameSubfolder, func(path string) error {
+		if limit > 0 && len(results) >= limit {
+			truncated = true
+			return errPreviewLimit
+		}
+		result, _ := processFile(config, db, path, run, logger)
+		results = append(results, result)
+		return nil
+	}, nil)
+	if err != nil && !errors.Is(err, errPreviewLimit) {
+		return results, truncated, err
+	}
+	return results, truncated, nil
+}
@@ -0,0 +1,366 @@
+// Sidecar files: rename files sharing a base name together as one group
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// sidecarSkipPrefix mở đầu lý do bỏ qua file thuộc nhóm; file được đổi tên cùng file chính
+const sidecarSkipPrefix = "grouped with"
+
+// sidecarErrorPrefix mở đầu lý do lỗi khi không đổi tên được một file trong nhóm
+const sidecarErrorPrefix = "sidecar"
+
+// sidecarGroup là các file cùng tên gốc trong một thư mục, có ít nhất một file
+// đi kèm (config.SidecarExtensions). File chính đầu tiên theo thứ tự tên là
+// Leader: cả nhóm được đổi tên khi xử lý nó, các file khác bị bỏ qua.
+type sidecarGroup struct {
+	Leader string
+	// Members là tên các file còn lại (file chính khác và file đi kèm), theo thứ tự tên
+	Members []string
+	// prefix là độ dài tên gốc chung ở đầu tên của từng file, tính theo byte
+	prefix map[string]int
+}
+
+// isSidecar kiểm tra file có đuôi của file đi kèm
+func isSidecar(config config.Config, name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, s := range config.SidecarExtensions {
+		if ext == s {
+			return true
+		}
+	}
+	return false
+}
+
+// groupSidecars chia các file trong một thư mục thành nhóm, trả về nhóm của
+// từng file thuộc nhóm. File đi kèm thuộc về file chính có tên gốc trùng với
+// phần đầu dài nhất của tên nó (không phân biệt hoa thường): IMG_001.xmp,
+// IMG_001.CR2.xmp và movie.en.srt thuộc về IMG_001.CR2 và movie.mkv.
+func groupSidecars(config config.Config, names []string) map[string]*sidecarGroup {
+	sort.Strings(names)
+	primaries := map[string][]string{}
+	for _, name := range names {
+		if !isSidecar(config, name) {
+			base, _ := splitExt(config, name)
+			key := strings.ToLower(base)
+			primaries[key] = append(primaries[key], name)
+		}
+	}
+	groups := map[string]*sidecarGroup{}
+	for _, name := range names {
+		if !isSidecar(config, name) {
+			continue
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		for candidate := stem; candidate != ""; {
+			key := strings.ToLower(candidate)
+			if main, ok := primaries[key]; ok {
+				g := groups[key]
+				if g == nil {
+					g = &sidecarGroup{Leader: main[0], Members: append([]string{}, main[1:]...), prefix: map[string]int{}}
+					for _, p := range main {
+						base, _ := splitExt(config, p)
+						g.prefix[p] = len(base)
+					}
+					groups[key] = g
+				}
+				g.Members = append(g.Members, name)
+				g.prefix[name] = len(candidate)
+				break
+			}
+			i := strings.LastIndex(candidate, ".")
+			if i <= 0 {
+				break
+			}
+			candidate = candidate[:i]
+		}
+	}
+	byName := map[string]*sidecarGroup{}
+	for _, g := range groups {
+		sort.Strings(g.Members)
+		byName[g.Leader] = g
+		for _, m := range g.Members {
+			byName[m] = g
+		}
+	}
+	return byName
+}
+
+// sidecarIndex nhớ nhóm file của từng thư mục trong một lượt quét, để mọi file
+// của thư mục thấy cùng một cách chia nhóm dù được xử lý song song
+type sidecarIndex struct {
+	mu   sync.Mutex
+	dirs map[string]map[string]*sidecarGroup
+}
+
+func newSidecarIndex() *sidecarIndex {
+	return &sidecarIndex{dirs: map[string]map[string]*sidecarGroup{}}
+}
+
+// groupOf trả về nhóm của file, nil khi file không thuộc nhóm nào. index nil là
+// đọc lại thư mục (duyệt đề xuất, thử luật).
+func (x *sidecarIndex) groupOf(config config.Config, path string) *sidecarGroup {
+	if len(config.SidecarExtensions) == 0 {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if x == nil {
+		return readSidecarGroups(config, dir)[filepath.Base(path)]
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	groups, ok := x.dirs[dir]
+	if !ok {
+		groups = readSidecarGroups(config, dir)
+		x.dirs[dir] = groups
+	}
+	return groups[filepath.Base(path)]
+}
+
+// readSidecarGroups đọc tên file trong thư mục và chia nhóm
+func readSidecarGroups(config config.Config, dir string) map[string]*sidecarGroup {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Debug("failed to read directory for sidecars", "path", dir, "error", err)
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return groupSidecars(config, names)
+}
+
+// groupMember là một file trong nhóm được đổi tên cùng file chính
+type groupMember struct {
+	Path    string
+	Content fileContent
+	// prefix là độ dài tên gốc chung ở đầu tên file
+	prefix int
+}
+
+// renameGroup là nhóm đang được đổi tên: file chính cùng các file đi kèm
+type renameGroup struct {
+	ID string
+	// LeaderExt là đuôi (đã sửa) của tên gốc file chính
+	LeaderExt string
+	Members   []groupMember
+}
+
+// newRenameGroup chuẩn bị đổi tên nhóm của file chính path, nil khi không có
+// nhóm. File trong nhóm qua cùng các kiểm tra như file lẻ (file database, đã
+// đổi tên hoặc đã xử lý, đang chờ retry, luật skip()); file bị bỏ qua không
+// được đổi tên cùng nhóm.
+func newRenameGroup(config config.Config, db *infrastructure.Database, run runInfo, path string, g *sidecarGroup, leader fileContent, logger *slog.Logger) (*renameGroup, error) {
+	if g == nil || len(g.Members) == 0 {
+		return nil, nil
+	}
+	dir := filepath.Dir(path)
+	_, ext := splitExt(config, leader.Name)
+	group := &renameGroup{ID: uuid.New().String(), LeaderExt: ext}
+	for _, name := range g.Members {
+		path := filepath.Join(dir, name)
+		reason, _, err := skipReason(config, db, path, run)
+		if err != nil {
+			return nil, err
+		}
+		content := inspectFile(config, path, logger)
+		if reason == "" {
+			if reason, err = ruleSkipReason(config, db, run.Root, path, content); err != nil {
+				reason = fmt.Sprintf("%s: %v", ruleErrorPrefix, err)
+			}
+		}
+		if reason != "" {
+			logger.Info("sidecar left out of group", "path", path, "reason", reason)
+			continue
+		}
+		group.Members = append(group.Members, groupMember{
+			Path:    path,
+			Content: content,
+			prefix:  g.prefix[name],
+		})
+	}
+	if len(group.Members) == 0 {
+		return nil, nil
+	}
+	return group, nil
+}
+
+// followLeader tìm file chính đã được đổi tên trước đó (bản ghi thành công, chưa
+// hoàn tác, file còn ở đường dẫn mới) của file đi kèm lẻ path, vd IMG_001.xmp
+// được thêm sau khi IMG_001.CR2 đã đổi tên. target là tên mới theo tên mới của
+// file chính, cùng thư mục với nó; leader nil khi không có.
+func followLeader(config config.Config, db *infrastructure.Database, path string, content fileContent) (leader *domain.FileRecord, target ruleTarget, err error) {
+	dir := absOrSelf(filepath.Dir(path))
+	name := filepath.Base(path)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	for candidate := stem; candidate != ""; {
+		records, err := db.FindRenamedByStem(filepath.Join(dir, candidate))
+		if err != nil {
+			return nil, target, err
+		}
+		for _, r := range records {
+			base, ext := splitExt(config, r.OriginalName)
+			if filepath.Dir(r.OldPath) != dir || isSidecar(config, r.OriginalName) || !strings.EqualFold(base, candidate) {
+				continue
+			}
+			if _, err := os.Lstat(r.NewPath); err != nil {
+				continue
+			}
+			g := &renameGroup{LeaderExt: ext}
+			newName := g.memberName(config, groupMember{Content: content, prefix: len(candidate)}, r.NewName)
+			return &r, ruleTarget{Name: newName, Path: filepath.Join(filepath.Dir(r.NewPath), newName)}, nil
+		}
+		i := strings.LastIndex(candidate, ".")
+		if i <= 0 {
+			break
+		}
+		candidate = candidate[:i]
+	}
+	return nil, target, nil
+}
+
+// joinLeaderGroup trả về group_id của file chính để file đi kèm được hoàn tác
+// cùng nó; file chính chưa có nhóm thì được gán nhóm mới
+func joinLeaderGroup(db *infrastructure.Database, leader *domain.FileRecord, logger *slog.Logger) string {
+	if leader.GroupID != "" {
+		return leader.GroupID
+	}
+	id := uuid.New().String()
+	if err := db.SetFileRecordGroup(leader.Id, id); err != nil {
+		logger.Error("failed to group file with sidecar", "id", leader.Id, "error", err)
+		return ""
+	}
+	leader.GroupID = id
+	return id
+}
+
+// memberName trả về tên mới của file trong nhóm khi file chính có tên mới
+// leaderName: tên gốc chung được thay bằng tên gốc mới, phần còn lại giữ nguyên,
+// vd IMG_001.xmp → <uuid>.xmp, IMG_001.CR2.xmp → <uuid>.CR2.xmp, movie.en.srt → <uuid>.en.srt
+func (g *renameGroup) memberName(config config.Config, m groupMember, leaderName string) string {
+	newBase, newExt := splitExt(config, leaderName)
+	rest := m.Content.Name[min(m.prefix, len(m.Content.Name)):]
+	// Đuôi của file chính nằm trong tên file đi kèm (IMG_001.CR2.xmp) theo đuôi mới
+	if ext := g.LeaderExt; ext != "" && len(rest) > len(ext) && rest[len(ext)] == '.' && strings.EqualFold(rest[:len(ext)], ext) {
+		rest = newExt + rest[len(ext):]
+	}
+	return newBase + rest
+}
+
+// memberPaths trả về đường dẫn mới của các file trong nhóm, cùng thư mục với file chính
+func (g *renameGroup) memberPaths(config config.Config, target ruleTarget) []string {
+	if g == nil {
+		return nil
+	}
+	paths := make([]string, len(g.Members))
+	for i, m := range g.Members {
+		paths[i] = filepath.Join(filepath.Dir(target.Path), g.memberName(config, m, target.Name))
+	}
+	return paths
+}
+
+// takenTarget trả về đích đã có file trong các đích của file chính và nhóm, rỗng khi còn trống
+func takenTarget(config config.Config, target ruleTarget, group *renameGroup) (string, error) {
+	for _, path := range append([]string{target.Path}, group.memberPaths(config, target)...) {
+		if _, err := os.Lstat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// memberRecord tạo bản ghi cho file trong nhóm, cùng group_id với file chính
+func (g *renameGroup) memberRecord(config config.Config, m groupMember, newPath string) (domain.FileRecord, error) {
+	_, ext := splitExt(config, filepath.Base(newPath))
+	record := domain.FileRecord{
+		OriginalName: filepath.Base(m.Path),
+		NewName:      filepath.Base(newPath),
+		FilePath:     filepath.Dir(newPath),
+		OldPath:      absOrSelf(m.Path),
+		NewPath:      absOrSelf(newPath),
+		Extension:    strings.ToLower(ext),
+		MimeType:     m.Content.Type.MIME,
+		ExtMismatch:  m.Content.Mismatch,
+		Metadata:     m.Content.Metadata,
+		GroupID:      g.ID,
+	}
+	var err error
+	record.FileSize, record.FileMode, record.ModTime, err = infrastructure.GetFileInfo(m.Path)
+	return record, err
+}
+
+// renameMembers đổi tên các file trong nhóm sau khi file chính đã được đổi tên
+// thành target. Khi một file không đổi tên được (lỗi, hook từ chối) các file
+// đã đổi tên được chuyển lại chỗ cũ và err cho biết file lỗi; file chính do
+// người gọi chuyển lại. dryRun chỉ tạo bản ghi và kết quả dự kiến.
+func renameMembers(config config.Config, run runInfo, metricsRoot string, group *renameGroup, target ruleTarget, dryRun bool, logger *slog.Logger) ([]domain.FileRecord, []FileResult, error) {
+	var records []domain.FileRecord
+	var results []FileResult
+	var done [][2]string
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if _, err := timedRename(metricsRoot, done[i][1], done[i][0]); err != nil {
+				logger.Error("failed to move sidecar back", "path", done[i][1], "to", done[i][0], "error", err)
+			}
+		}
+	}
+	for i, newPath := range group.memberPaths(config, target) {
+		m := group.Members[i]
+		record, err := group.memberRecord(config, m, newPath)
+		if err == nil && !dryRun {
+			if filepath.Dir(newPath) != filepath.Dir(m.Path) {
+				err = prepareTarget(newPath)
+			}
+			if err == nil {
+				run.Targets.add(newPath)
+				var veto string
+				record.MoveStrategy, veto, err = renameWithHooks(config, run, metricsRoot, m.Path, newPath, record.FileSize, logger)
+				if veto != "" {
+					err = errors.New(veto)
+				}
+			}
+		}
+		if err != nil {
+			rollback()
+			return nil, nil, fmt.Errorf("%s %s: %w", sidecarErrorPrefix, filepath.Base(m.Path), err)
+		}
+		if dryRun {
+			logger.Info("would rename sidecar", "path", m.Path, "new_path", newPath, "group_id", group.ID)
+		} else {
+			done = append(done, [2]string{m.Path, newPath})
+			logger.Info("sidecar renamed", "path", m.Path, "new_path", newPath, "group_id", group.ID)
+		}
+		record.Success = true
+		record.RenamedAt = time.Now().UTC().Format(time.RFC3339)
+		records = append(records, record)
+		results = append(results, FileResult{
+			Path:     m.Path,
+			OldName:  record.OriginalName,
+			NewName:  record.NewName,
+			NewPath:  newPath,
+			Status:   StatusRenamed,
+			MimeType: record.MimeType,
+		})
+	}
+	return records, results, nil
+}
@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+)
+
+func TestGroupSidecars(t *testing.T) {
+	cfg := config.Config{SidecarExtensions: []string{".xmp", ".srt"}}
+	tests := []struct {
+		name   string
+		files  []string
+		file   string
+		leader string
+		member []string
+	}{
+		{"raw with xmp", []string{"IMG_001.CR2", "IMG_001.xmp"}, "IMG_001.xmp", "IMG_001.CR2", []string{"IMG_001.xmp"}},
+		{"xmp named after full file name", []string{"IMG_001.CR2", "IMG_001.CR2.xmp"}, "IMG_001.CR2", "IMG_001.CR2", []string{"IMG_001.CR2.xmp"}},
+		{"case-insensitive base", []string{"img_001.CR2", "IMG_001.xmp"}, "IMG_001.xmp", "img_001.CR2", []string{"IMG_001.xmp"}},
+		{"subtitle with language", []string{"movie.mkv", "movie.en.srt", "movie.vi.srt"}, "movie.mkv", "movie.mkv", []string{"movie.en.srt", "movie.vi.srt"}},
+		{"two primaries share one group", []string{"IMG_001.JPG", "IMG_001.CR2", "IMG_001.xmp"}, "IMG_001.JPG", "IMG_001.CR2", []string{"IMG_001.JPG", "IMG_001.xmp"}},
+		{"primary without sidecar", []string{"IMG_001.CR2", "IMG_002.xmp"}, "IMG_001.CR2", "", nil},
+		{"sidecar without primary", []string{"IMG_001.CR2", "IMG_002.xmp"}, "IMG_002.xmp", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := groupSidecars(cfg, tt.files)[tt.file]
+			if tt.leader == "" {
+				if g != nil {
+					t.Errorf("group = %+v, want none", g)
+				}
+				return
+			}
+			if g == nil || g.Leader != tt.leader || !reflect.DeepEqual(g.Members, tt.member) {
+				t.Errorf("group = %+v, want leader %s with %v", g, tt.leader, tt.member)
+			}
+		})
+	}
+}
+
+func TestScanRenamesSidecarGroupAndUndo(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDatabase(t)
+	originals := []string{"IMG_001.CR2", "IMG_001.xmp", "IMG_001.CR2.xmp", "movie.mkv", "movie.en.srt", "notes.txt"}
+	for _, name := range originals {
+		writeTestFile(t, dir, name, name)
+	}
+	cfg := config.Config{Dir: dir, Workers: 4, DBBatchSize: 10, CollisionPolicy: domain.CollisionRegenerate, SidecarExtensions: []string{".xmp", ".srt"}}
+
+	summary, err := ScanDirectory(cfg, db, TriggerCLI)
+	if err != nil {
+		t.Fatalf("ScanDirectory: %v", err)
+	}
+	if summary.Renamed != 3 || summary.Sidecars != 3 || summary.Failed != 0 {
+		t.Fatalf("summary = %d renamed, %d sidecars, %d failed, want 3, 3, 0", summary.Renamed, summary.Sidecars, summary.Failed)
+	}
+
+	records, err := db.GetAllFileRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]domain.FileRecord{}
+	for _, r := range records {
+		byName[r.OriginalName] = r
+	}
+	raw := byName["IMG_001.CR2"]
+	base := strings.TrimSuffix(raw.NewName, ".CR2")
+	if raw.GroupID == "" || base == raw.NewName {
+		t.Fatalf("IMG_001.CR2 record = %+v, want a group and a .CR2 name", raw)
+	}
+	// Cả nhóm cùng tên gốc mới và cùng group_id
+	for name, want := range map[string]string{"IMG_001.xmp": base + ".xmp", "IMG_001.CR2.xmp": base + ".CR2.xmp"} {
+		r := byName[name]
+		if r.NewName != want || r.GroupID != raw.GroupID {
+			t.Errorf("%s renamed to %s in group %q, want %s in group %q", name, r.NewName, r.GroupID, want, raw.GroupID)
+		}
+	}
+	movie := byName["movie.mkv"]
+	if srt := byName["movie.en.srt"]; srt.NewName != strings.TrimSuffix(movie.NewName, ".mkv")+".en.srt" || srt.GroupID == "" || srt.GroupID != movie.GroupID {
+		t.Errorf("movie.en.srt = %s in group %q, want next to %s in group %q", srt.NewName, srt.GroupID, movie.NewName, movie.GroupID)
+	}
+	if notes := byName["notes.txt"]; notes.GroupID != "" {
+		t.Errorf("notes.txt has group %q, want none", notes.GroupID)
+	}
+
+	// Một file trong nhóm không hoàn tác được thì cả nhóm giữ nguyên
+	writeTestFile(t, dir, "movie.en.srt", "new")
+	if _, err := UndoRename(db, movie.Id); !errors.Is(err, ErrCannotUndo) {
+		t.Errorf("undo with occupied sidecar path = %v, want ErrCannotUndo", err)
+	}
+	if _, err := os.Stat(movie.NewPath); err != nil {
+		t.Errorf("movie moved by refused undo: %v", err)
+	}
+
+	// Hoàn tác từ file đi kèm đưa cả nhóm về tên cũ
+	undone, err := UndoRename(db, byName["IMG_001.xmp"].Id)
+	if err != nil {
+		t.Fatalf("UndoRename: %v", err)
+	}
+	if len(undone) != 3 || undone[0].OriginalName != "IMG_001.xmp" {
+		t.Errorf("undone = %d records starting with %s, want the 3 files starting with IMG_001.xmp", len(undone), undone[0].OriginalName)
+	}
+	for _, name := range []string{"IMG_001.CR2", "IMG_001.xmp", "IMG_001.CR2.xmp"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not restored: %v", name, err)
+		}
+		r, err := db.GetFileRecord(byName[name].Id)
+		if err != nil || r.UndoneAt == "" {
+			t.Errorf("record of %s = %+v, %v, want undone", name, r, err)
+		}
+	}
+	if _, err := UndoRename(db, raw.Id); !errors.Is(err, ErrCannotUndo) {
+		t.Errorf("second undo = %v, want ErrCannotUndo", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Undo: move renamed files back to their original path
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// undoMetricsRoot là nhãn root của metric đổi tên khi hoàn tác
+const undoMetricsRoot = "undo"
+
+// ErrCannotUndo báo bản ghi không thể hoàn tác (thất bại, đã hoàn tác, file đã đổi...)
+var ErrCannotUndo = errors.New("cannot undo")
+
+// undoMu tuần tự hóa việc hoàn tác để hai yêu cầu cùng lúc không chuyển một file hai lần
+var undoMu sync.Mutex
+
+// UndoRename chuyển file của bản ghi id từ đường dẫn mới về đường dẫn cũ và
+// đánh dấu bản ghi đã hoàn tác. File đã hoàn tác được coi như file mới nên lượt
+// quét sau đổi tên lại. Thư mục layout trống không bị xóa.
+// Bản ghi thuộc nhóm file đi kèm được hoàn tác cùng cả nhóm: records là mọi bản
+// ghi đã hoàn tác, bản ghi id đứng đầu.
+func UndoRename(db *infrastructure.Database, id int) ([]domain.FileRecord, error) {
+	undoMu.Lock()
+	defer undoMu.Unlock()
+	record, err := db.GetFileRecord(id)
+	if err != nil {
+		return nil, fmt.Errorf("record %d: %w", id, err)
+	}
+	records := []domain.FileRecord{record}
+	if record.GroupID != "" {
+		group, err := db.GetFileRecordGroup(record.GroupID)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", record.GroupID, err)
+		}
+		for _, r := range group {
+			if r.Id != id {
+				records = append(records, r)
+			}
+		}
+	}
+	// Kiểm tra cả nhóm trước khi chuyển file nào
+	for _, r := range records {
+		if err := checkUndo(r); err != nil {
+			return nil, err
+		}
+	}
+	for i, r := range records {
+		if err := os.MkdirAll(filepath.Dir(r.OldPath), 0o755); err == nil {
+			_, err = timedRename(undoMetricsRoot, r.NewPath, r.OldPath)
+		}
+		if err != nil {
+			// Không để nhóm hoàn tác dở dang: chuyển các file đã hoàn tác về lại
+			for j := i - 1; j >= 0; j-- {
+				if _, moveErr := timedRename(undoMetricsRoot, records[j].OldPath, records[j].NewPath); moveErr != nil {
+					slog.Error("failed to redo rename", "id", records[j].Id, "path", records[j].OldPath, "error", moveErr)
+				}
+			}
+			return nil, fmt.Errorf("record %d: %w", r.Id, err)
+		}
+	}
+	undoneAt := time.Now().Format(time.RFC3339)
+	for i := range records {
+		records[i].UndoneAt = undoneAt
+		if _, err := db.MarkFileRecordUndone(records[i].Id, undoneAt); err != nil {
+			// File đã về chỗ cũ; chỉ log vì không thể hoàn tác lại việc chuyển
+			slog.Error("failed to mark record undone", "id", records[i].Id, "path", records[i].OldPath, "error", err)
+			return records, err
+		}
+		slog.Info("rename undone", "id", records[i].Id, "from", records[i].NewPath, "to", records[i].OldPath, "group_id", records[i].GroupID)
+	}
+	return records, nil
+}
+
+// checkUndo kiểm tra bản ghi có thể hoàn tác: đổi tên thành công, chưa hoàn
+// tác, file mới còn đó và đường dẫn cũ còn trống
+func checkUndo(record domain.FileRecord) error {
+	switch {
+	case !record.Success:
+		return fmt.Errorf("%w: record %d is a failed rename", ErrCannotUndo, record.Id)
+	case record.UndoneAt != "":
+		return fmt.Errorf("%w: record %d was already undone at %s", ErrCannotUndo, record.Id, record.UndoneAt)
+	case record.OldPath == "" || record.NewPath == "":
+		return fmt.Errorf("%w: record %d has no paths", ErrCannotUndo, record.Id)
+	}
+	if _, err := os.Lstat(record.NewPath); err != nil {
+		return fmt.Errorf("%w: renamed file is gone: %v", ErrCannotUndo, err)
+	}
+	if _, err := os.Lstat(record.OldPath); err == nil {
+		return fmt.Errorf("%w: %s already exists", ErrCannotUndo, record.OldPath)
+	}
+	return nil
+}
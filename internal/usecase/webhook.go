@@ -0,0 +1,579 @@
+// Outbound webhooks fired from scan events
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// webhookTimeout giới hạn thời gian một lần gửi
+	webhookTimeout = 10 * time.Second
+	// webhookDefaultMaxAttempts là số lần thử khi webhook không cấu hình max_attempts
+	webhookDefaultMaxAttempts = 6
+	// webhookMaxBackoff là thời gian chờ tối đa giữa hai lần thử
+	webhookMaxBackoff = 10 * time.Minute
+	// webhookConcurrency là số worker gửi webhook, dùng chung cho mọi webhook
+	webhookConcurrency = 4
+	// webhookQueueSize giới hạn số lần gửi chờ worker; phần vượt quá nằm trong DB tới lượt nạp sau
+	webhookQueueSize = 256
+	// webhookInsertBatch là số lần gửi mới được lưu chung một transaction
+	webhookInsertBatch = 100
+	// webhookBatchSize là số file tối đa trong một payload files-renamed
+	webhookBatchSize = 500
+)
+
+var (
+	// webhookBaseBackoff nhân đôi sau mỗi lần thử lỗi, tối đa webhookMaxBackoff
+	webhookBaseBackoff = 2 * time.Second
+	// webhookPollInterval là chu kỳ lưu các lần gửi đang đệm và nạp lần gửi tới hạn từ DB
+	webhookPollInterval = time.Second
+)
+
+var webhookResults = infrastructure.Metrics.NewCounterVec(
+	"auto_rename_webhook_deliveries_total",
+	"Webhook delivery attempts, by webhook and result (delivered, retry, failed).",
+	"webhook", "result")
+
+// WebhookFile mô tả một file trong payload webhook
+type WebhookFile struct {
+	Path    string `json:"path"`
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name,omitempty"`
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Sidecars là các file đi kèm được đổi tên cùng file
+	Sidecars []WebhookFile `json:"sidecars,omitempty"`
+}
+
+// WebhookPayload là body JSON gửi tới webhook. File có với file-renamed và
+// file-failed, Files với files-renamed, Summary với run-finished và run-failed.
+type WebhookPayload struct {
+	ID      string        `json:"id"`
+	Event   string        `json:"event"`
+	Time    string        `json:"time"`
+	RunID   string        `json:"run_id,omitempty"`
+	Root    string        `json:"root,omitempty"`
+	File    *WebhookFile  `json:"file,omitempty"`
+	Files   []WebhookFile `json:"files,omitempty"`
+	Summary *RunSummary   `json:"summary,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// webhookDispatcher nhận event trực tiếp từ nơi phát (publishEvent), không đi qua
+// event bus vì bus bỏ event khi subscriber chậm. Lần gửi mới được đệm rồi lưu theo
+// lô vào webhook_deliveries; webhookConcurrency worker gửi từ một hàng đợi có giới
+// hạn. Lần thử lại và phần tràn hàng đợi được nạp lại từ DB khi tới hạn.
+type webhookDispatcher struct {
+	db     *infrastructure.Database
+	hooks  []config.Webhook
+	client *http.Client
+	queue  chan webhookJob
+	// wg đếm các lần gửi chưa xong, kể cả đang đệm hoặc chờ thử lại
+	wg   sync.WaitGroup
+	stop chan struct{}
+	// mu tuần tự hóa handle giữa các lượt quét, review và retry worker
+	mu sync.Mutex
+	// batches giữ file đã đổi tên của các lượt quét đang chạy, chỉ dùng khi có webhook batch
+	batches map[string][]WebhookFile
+	// pendingMu bảo vệ buffer và queued
+	pendingMu sync.Mutex
+	// buffer là các lần gửi mới chưa lưu vào DB
+	buffer []webhookJob
+	// queued là id các lần gửi đang trong hàng đợi hoặc đang được gửi
+	queued map[string]bool
+}
+
+// webhookJob là một lần gửi cùng webhook nhận nó
+type webhookJob struct {
+	hook     config.Webhook
+	delivery domain.WebhookDelivery
+}
+
+var (
+	webhooksMu sync.Mutex
+	webhooks   *webhookDispatcher
+)
+
+// StartWebhooks bắt đầu gửi webhook cho event của lượt quét và gửi tiếp các
+// lần gửi còn dang dở từ lần chạy trước. Không làm gì khi chưa cấu hình webhook.
+func StartWebhooks(config config.Config, db *infrastructure.Database) {
+	if len(config.Webhooks) == 0 {
+		return
+	}
+	d := newWebhookDispatcher(config.Webhooks, db)
+	webhooksMu.Lock()
+	webhooks = d
+	webhooksMu.Unlock()
+	slog.Info("webhooks initialized", "count", len(d.hooks))
+}
+
+// newWebhookDispatcher tạo dispatcher, nhận các lần gửi còn dang dở rồi chạy worker
+// cùng vòng nạp lần gửi tới hạn cho tới khi stop đóng
+func newWebhookDispatcher(hooks []config.Webhook, db *infrastructure.Database) *webhookDispatcher {
+	d := &webhookDispatcher{
+		db:      db,
+		hooks:   hooks,
+		client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan webhookJob, webhookQueueSize),
+		stop:    make(chan struct{}),
+		batches: make(map[string][]WebhookFile),
+		queued:  make(map[string]bool),
+	}
+	// Đếm lần gửi cũ trước khi vòng nạp chạy để wg không về âm
+	d.resume()
+	for i := 0; i < webhookConcurrency; i++ {
+		go d.work()
+	}
+	go d.poll(webhookPollInterval)
+	return d
+}
+
+// StopWebhooks ngừng nhận event và đợi các lần gửi (kể cả thử lại) xong trong
+// tối đa timeout. Lần gửi chưa xong được gửi tiếp ở lần chạy sau.
+func StopWebhooks(timeout time.Duration) {
+	webhooksMu.Lock()
+	d := webhooks
+	webhooks = nil
+	webhooksMu.Unlock()
+	if d == nil {
+		return
+	}
+	finished := make(chan struct{})
+	go func() {
+		// Đợi event đang xử lý rồi lưu các lần gửi còn đệm
+		d.mu.Lock()
+		d.mu.Unlock()
+		d.flush()
+		d.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+		slog.Warn("webhook deliveries still pending at shutdown, they resume on next start", "timeout", timeout.String())
+	}
+	close(d.stop)
+}
+
+func currentWebhooks() (*webhookDispatcher, error) {
+	webhooksMu.Lock()
+	defer webhooksMu.Unlock()
+	if webhooks == nil {
+		return nil, errors.New("no webhooks configured")
+	}
+	return webhooks, nil
+}
+
+// notifyWebhooks đệm các lần gửi của event; không làm gì khi chưa cấu hình
+// webhook hoặc đã dừng
+func notifyWebhooks(e Event) {
+	webhooksMu.Lock()
+	d := webhooks
+	webhooksMu.Unlock()
+	if d != nil {
+		d.handle(e)
+	}
+}
+
+// handle chuyển một event thành các lần gửi theo đăng ký của từng webhook.
+// Lượt quét dry-run không đổi tên gì nên không gửi.
+func (d *webhookDispatcher) handle(e Event) {
+	if e.DryRun {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch e.Type {
+	case EventRunStarted:
+		for _, h := range d.hooks {
+			if h.Batch && h.Wants(domain.WebhookEventFileRenamed) {
+				d.batches[e.RunID] = []WebhookFile{}
+				break
+			}
+		}
+	case EventFileRenamed:
+		file := webhookFile(e.File)
+		files, batching := d.batches[e.RunID]
+		if batching {
+			d.batches[e.RunID] = append(files, file)
+		}
+		for _, h := range d.hooks {
+			// Đổi tên từ review worker không thuộc lượt quét nào nên luôn gửi riêng
+			if h.Wants(domain.WebhookEventFileRenamed) && !(h.Batch && batching) {
+				d.add(h, WebhookPayload{Event: domain.WebhookEventFileRenamed, RunID: e.RunID, Root: e.Root, File: &file})
+			}
+		}
+	case EventFileFailed:
+		file := webhookFile(e.File)
+		for _, h := range d.hooks {
+			if h.Wants(domain.WebhookEventFileFailed) {
+				d.add(h, WebhookPayload{Event: domain.WebhookEventFileFailed, RunID: e.RunID, Root: e.Root, File: &file})
+			}
+		}
+	case EventRunFinished:
+		files, batching := d.batches[e.RunID]
+		delete(d.batches, e.RunID)
+		for _, h := range d.hooks {
+			if batching && h.Batch && h.Wants(domain.WebhookEventFileRenamed) {
+				for start := 0; start < len(files); start += webhookBatchSize {
+					end := start + webhookBatchSize
+					if end > len(files) {
+						end = len(files)
+					}
+					d.add(h, WebhookPayload{Event: domain.WebhookEventFilesRenamed, RunID: e.RunID, Root: e.Root, Files: files[start:end]})
+				}
+			}
+			if h.Wants(domain.WebhookEventRunFinished) {
+				d.add(h, WebhookPayload{Event: domain.WebhookEventRunFinished, RunID: e.RunID, Root: e.Root, Summary: e.Summary, Error: e.Error})
+			}
+			if e.Error != "" && h.Wants(domain.WebhookEventRunFailed) {
+				d.add(h, WebhookPayload{Event: domain.WebhookEventRunFailed, RunID: e.RunID, Root: e.Root, Summary: e.Summary, Error: e.Error})
+			}
+		}
+		d.flush()
+	}
+}
+
+// webhookFile chuyển kết quả xử lý file sang dạng gửi qua webhook
+func webhookFile(r *FileResult) WebhookFile {
+	if r == nil {
+		return WebhookFile{}
+	}
+	dir := filepath.Dir(r.Path)
+	f := WebhookFile{Path: dir, OldName: r.OldName, NewName: r.NewName, OldPath: r.Path}
+	if r.NewPath != "" {
+		f.NewPath = r.NewPath
+	} else if r.NewName != "" {
+		f.NewPath = filepath.Join(dir, r.NewName)
+	}
+	if r.Status == StatusFailed {
+		f.Error = r.Reason
+	}
+	for i := range r.Sidecars {
+		f.Sidecars = append(f.Sidecars, webhookFile(&r.Sidecars[i]))
+	}
+	return f
+}
+
+// newWebhookDelivery tạo lần gửi pending cho payload, tới hạn ngay
+func newWebhookDelivery(hook config.Webhook, p WebhookPayload) (domain.WebhookDelivery, error) {
+	p.ID = uuid.New().String()
+	p.Time = time.Now().UTC().Format(time.RFC3339)
+	body, err := json.Marshal(p)
+	if err != nil {
+		return domain.WebhookDelivery{}, err
+	}
+	return domain.WebhookDelivery{
+		ID:            p.ID,
+		Webhook:       hook.Name,
+		Event:         p.Event,
+		RunID:         p.RunID,
+		Payload:       string(body),
+		Status:        domain.WebhookStatusPending,
+		CreatedAt:     p.Time,
+		UpdatedAt:     p.Time,
+		NextAttemptAt: p.Time,
+	}, nil
+}
+
+// add đệm một lần gửi mới; lưu cả lô khi đệm đủ webhookInsertBatch. Phần còn lại
+// được lưu khi lượt quét kết thúc hoặc ở lượt nạp kế tiếp.
+func (d *webhookDispatcher) add(hook config.Webhook, p WebhookPayload) {
+	w, err := newWebhookDelivery(hook, p)
+	if err != nil {
+		slog.Error("failed to encode webhook payload", "webhook", hook.Name, "event", p.Event, "run_id", p.RunID, "error", err)
+		return
+	}
+	d.wg.Add(1)
+	d.pendingMu.Lock()
+	d.buffer = append(d.buffer, webhookJob{hook: hook, delivery: w})
+	full := len(d.buffer) >= webhookInsertBatch
+	d.pendingMu.Unlock()
+	if full {
+		d.flush()
+	}
+}
+
+// flush lưu các lần gửi đang đệm trong một transaction rồi đưa vào hàng đợi
+func (d *webhookDispatcher) flush() {
+	d.pendingMu.Lock()
+	jobs := d.buffer
+	d.buffer = nil
+	d.pendingMu.Unlock()
+	if len(jobs) == 0 {
+		return
+	}
+	deliveries := make([]domain.WebhookDelivery, len(jobs))
+	for i, job := range jobs {
+		deliveries[i] = job.delivery
+	}
+	if err := d.db.InsertWebhookDeliveries(deliveries); err != nil {
+		slog.Error("failed to store webhook deliveries", "count", len(jobs), "error", err)
+		for range jobs {
+			d.wg.Done()
+		}
+		return
+	}
+	for _, job := range jobs {
+		if !d.push(job) {
+			break
+		}
+	}
+}
+
+// enqueue lưu payload thành một lần gửi mới ngay rồi đưa vào hàng đợi
+func (d *webhookDispatcher) enqueue(hook config.Webhook, p WebhookPayload) (domain.WebhookDelivery, error) {
+	delivery, err := newWebhookDelivery(hook, p)
+	if err != nil {
+		return delivery, err
+	}
+	d.wg.Add(1)
+	if err := d.db.InsertWebhookDelivery(delivery); err != nil {
+		d.wg.Done()
+		slog.Error("failed to store webhook delivery", "webhook", hook.Name, "event", p.Event, "run_id", p.RunID, "error", err)
+		return delivery, err
+	}
+	d.push(webhookJob{hook: hook, delivery: delivery})
+	return delivery, nil
+}
+
+// push đưa lần gửi vào hàng đợi nếu chưa có trong đó; trả về false khi hàng đợi
+// đầy, lần gửi khi đó chờ lượt nạp sau từ DB
+func (d *webhookDispatcher) push(job webhookJob) bool {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	if d.queued[job.delivery.ID] {
+		return true
+	}
+	select {
+	case d.queue <- job:
+		d.queued[job.delivery.ID] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// poll định kỳ lưu các lần gửi đang đệm và nạp lần gửi tới hạn (thử lại, tràn hàng đợi)
+func (d *webhookDispatcher) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.flush()
+			d.loadDue()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// loadDue đưa các lần gửi pending đã tới hạn trong DB vào hàng đợi cho tới khi đầy
+func (d *webhookDispatcher) loadDue() {
+	due, err := d.db.GetDueWebhookDeliveries(time.Now().UTC().Format(time.RFC3339), webhookQueueSize)
+	if err != nil {
+		slog.Error("failed to load due webhook deliveries", "error", err)
+		return
+	}
+	for _, w := range due {
+		hook, ok := d.hook(w.Webhook)
+		if !ok {
+			d.pendingMu.Lock()
+			queued := d.queued[w.ID]
+			d.pendingMu.Unlock()
+			if !queued {
+				d.dropUnconfigured(w)
+				d.wg.Done()
+			}
+			continue
+		}
+		if !d.push(webhookJob{hook: hook, delivery: w}) {
+			return
+		}
+	}
+}
+
+// work gửi các lần gửi trong hàng đợi cho tới khi dispatcher dừng
+func (d *webhookDispatcher) work() {
+	for {
+		select {
+		case job := <-d.queue:
+			d.attempt(job)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// attempt thử gửi một lần và ghi kết quả vào delivery log. Lần gửi còn pending
+// được nạp lại khi tới next_attempt_at.
+func (d *webhookDispatcher) attempt(job webhookJob) {
+	hook := job.hook
+	defer func() {
+		d.pendingMu.Lock()
+		delete(d.queued, job.delivery.ID)
+		d.pendingMu.Unlock()
+	}()
+	// Đọc lại từ DB: lượt nạp có thể đã lấy bản cũ trước khi lần thử trước ghi kết quả
+	w, err := d.db.GetWebhookDelivery(job.delivery.ID)
+	if err != nil || w.Status != domain.WebhookStatusPending || w.Attempts != job.delivery.Attempts {
+		return
+	}
+	logger := slog.With("webhook", hook.Name, "event", w.Event, "delivery", w.ID)
+	maxAttempts := hook.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = webhookDefaultMaxAttempts
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	code, err := infrastructure.PostWebhook(ctx, d.client, hook.URL, hook.Secret, w, time.Now().Unix())
+	cancel()
+
+	now := time.Now().UTC()
+	w.Attempts++
+	w.ResponseCode = code
+	w.UpdatedAt = now.Format(time.RFC3339)
+	switch {
+	case err == nil:
+		w.Status, w.LastError = domain.WebhookStatusDelivered, ""
+		webhookResults.Inc(hook.Name, "delivered")
+		logger.Debug("webhook delivered", "attempts", w.Attempts, "status", code)
+	case !retryableWebhookError(err) || w.Attempts >= maxAttempts:
+		w.Status, w.LastError = domain.WebhookStatusFailed, err.Error()
+		webhookResults.Inc(hook.Name, "failed")
+		logger.Warn("webhook delivery failed", "attempts", w.Attempts, "status", code, "error", err)
+	default:
+		backoff := webhookBackoff(w.Attempts)
+		w.LastError = err.Error()
+		w.NextAttemptAt = now.Add(backoff).Format(time.RFC3339)
+		webhookResults.Inc(hook.Name, "retry")
+		logger.Info("webhook delivery will be retried", "attempts", w.Attempts, "status", code, "retry_in", backoff.String(), "error", err)
+	}
+	if err := d.db.UpdateWebhookDelivery(w); err != nil {
+		logger.Error("failed to update webhook delivery", "error", err)
+		return
+	}
+	if w.Status != domain.WebhookStatusPending {
+		d.wg.Done()
+	}
+}
+
+// retryableWebhookError: lỗi mạng, timeout, 408, 429 và 5xx được thử lại;
+// các phản hồi 4xx khác là lỗi cấu hình nên dừng ngay
+func retryableWebhookError(err error) bool {
+	var statusErr *infrastructure.WebhookStatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.Code
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+	}
+	return true
+}
+
+// webhookBackoff là thời gian chờ sau lần thử lỗi thứ attempt
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempt && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// resume nhận các lần gửi còn pending từ lần chạy trước; lượt nạp gửi chúng khi tới hạn
+func (d *webhookDispatcher) resume() {
+	pending, err := d.db.GetPendingWebhookDeliveries()
+	if err != nil {
+		slog.Error("failed to load pending webhook deliveries", "error", err)
+		return
+	}
+	for _, w := range pending {
+		if _, ok := d.hook(w.Webhook); !ok {
+			d.dropUnconfigured(w)
+			continue
+		}
+		d.wg.Add(1)
+	}
+	if len(pending) > 0 {
+		slog.Info("resuming pending webhook deliveries", "count", len(pending))
+	}
+	d.loadDue()
+}
+
+// dropUnconfigured đánh dấu lỗi lần gửi tới webhook không còn trong cấu hình
+func (d *webhookDispatcher) dropUnconfigured(w domain.WebhookDelivery) {
+	w.Status, w.LastError = domain.WebhookStatusFailed, "webhook is no longer configured"
+	w.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := d.db.UpdateWebhookDelivery(w); err != nil {
+		slog.Error("failed to update webhook delivery", "delivery", w.ID, "error", err)
+	}
+}
+
+func (d *webhookDispatcher) hook(name string) (config.Webhook, bool) {
+	for _, h := range d.hooks {
+		if h.Name == name {
+			return h, true
+		}
+	}
+	return config.Webhook{}, false
+}
+
+// TestWebhook gửi event ping tới webhook để kiểm tra cấu hình
+func TestWebhook(name string) (domain.WebhookDelivery, error) {
+	d, err := currentWebhooks()
+	if err != nil {
+		return domain.WebhookDelivery{}, err
+	}
+	hook, ok := d.hook(name)
+	if !ok {
+		return domain.WebhookDelivery{}, fmt.Errorf("unknown webhook %q", name)
+	}
+	return d.enqueue(hook, WebhookPayload{Event: domain.WebhookEventPing})
+}
+
+// RedeliverWebhook đặt lại một lần gửi đã xong (thành công hoặc lỗi) và gửi lại payload cũ
+func RedeliverWebhook(db *infrastructure.Database, id string) (domain.WebhookDelivery, error) {
+	d, err := currentWebhooks()
+	if err != nil {
+		return domain.WebhookDelivery{}, err
+	}
+	w, err := db.GetWebhookDelivery(id)
+	if err != nil {
+		return w, err
+	}
+	if w.Status == domain.WebhookStatusPending {
+		return w, errors.New("delivery is still pending")
+	}
+	hook, ok := d.hook(w.Webhook)
+	if !ok {
+		return w, fmt.Errorf("webhook %q is no longer configured", w.Webhook)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	w.Status, w.Attempts, w.ResponseCode, w.LastError = domain.WebhookStatusPending, 0, 0, ""
+	w.UpdatedAt, w.NextAttemptAt = now, now
+	// Đếm trước khi lưu: lượt nạp có thể gửi xong ngay sau khi lần gửi thành pending
+	d.wg.Add(1)
+	if err := db.UpdateWebhookDelivery(w); err != nil {
+		d.wg.Done()
+		return w, err
+	}
+	d.push(webhookJob{hook: hook, delivery: w})
+	return w, nil
+}
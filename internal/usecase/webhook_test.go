@@ -0,0 +1,331 @@
+package usecase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"auto-rename/internal/config"
+	"auto-rename/internal/domain"
+	"auto-rename/internal/infrastructure"
+)
+
+// webhookRequest là một request webhook server test đã nhận
+type webhookRequest struct {
+	Header  http.Header
+	Body    []byte
+	Payload WebhookPayload
+}
+
+// webhookReceiver là server test ghi lại request và trả status theo thứ tự trong statuses
+// (hết danh sách thì trả 200)
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []webhookRequest
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var p WebhookPayload
+	_ = json.Unmarshal(body, &p)
+	r.mu.Lock()
+	r.requests = append(r.requests, webhookRequest{Header: req.Header.Clone(), Body: body, Payload: p})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *webhookReceiver) received() []webhookRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]webhookRequest(nil), r.requests...)
+}
+
+func newTestDatabase(t *testing.T) *infrastructure.Database {
+	t.Helper()
+	db, err := infrastructure.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fastWebhookBackoff rút ngắn thời gian chờ giữa các lần thử và chu kỳ nạp trong test
+func fastWebhookBackoff(t *testing.T) {
+	t.Helper()
+	oldBackoff, oldPoll := webhookBaseBackoff, webhookPollInterval
+	webhookBaseBackoff, webhookPollInterval = 10*time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() { webhookBaseBackoff, webhookPollInterval = oldBackoff, oldPoll })
+}
+
+// newTestDispatcher tạo dispatcher và dừng worker của nó khi test xong, trước khi đóng DB
+func newTestDispatcher(t *testing.T, hooks []config.Webhook, db *infrastructure.Database) *webhookDispatcher {
+	t.Helper()
+	d := newWebhookDispatcher(hooks, db)
+	t.Cleanup(func() { close(d.stop) })
+	return d
+}
+
+func TestWebhookSignature(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	db := newTestDatabase(t)
+	hook := config.Webhook{Name: "signed", URL: server.URL, Secret: "s3cret"}
+	d := newTestDispatcher(t, []config.Webhook{hook}, db)
+	delivery, err := d.enqueue(hook, WebhookPayload{Event: domain.WebhookEventPing})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	d.wg.Wait()
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	if got := req.Header.Get(infrastructure.WebhookHeaderEvent); got != domain.WebhookEventPing {
+		t.Errorf("event header = %q, want %q", got, domain.WebhookEventPing)
+	}
+	if got := req.Header.Get(infrastructure.WebhookHeaderDelivery); got != delivery.ID {
+		t.Errorf("delivery header = %q, want %q", got, delivery.ID)
+	}
+	timestamp := req.Header.Get(infrastructure.WebhookHeaderTimestamp)
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(req.Body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get(infrastructure.WebhookHeaderSignature); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	// Không có secret thì không ký
+	unsigned := config.Webhook{Name: "unsigned", URL: server.URL}
+	if _, err := d.enqueue(unsigned, WebhookPayload{Event: domain.WebhookEventPing}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	d.wg.Wait()
+	requests = receiver.received()
+	if got := requests[len(requests)-1].Header.Get(infrastructure.WebhookHeaderSignature); got != "" {
+		t.Errorf("unsigned webhook sent signature %q", got)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	fastWebhookBackoff(t)
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		wantStatus   string
+		wantAttempts int
+		wantCode     int
+	}{
+		{"retried until delivered", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 0, domain.WebhookStatusDelivered, 3, http.StatusOK},
+		{"client error is not retried", []int{http.StatusBadRequest}, 0, domain.WebhookStatusFailed, 1, http.StatusBadRequest},
+		{"gives up after max attempts", []int{500, 500, 500, 500}, 3, domain.WebhookStatusFailed, 3, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &webhookReceiver{statuses: tt.statuses}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+
+			db := newTestDatabase(t)
+			hook := config.Webhook{Name: "retry", URL: server.URL, MaxAttempts: tt.maxAttempts}
+			d := newTestDispatcher(t, []config.Webhook{hook}, db)
+			delivery, err := d.enqueue(hook, WebhookPayload{Event: domain.WebhookEventPing})
+			if err != nil {
+				t.Fatalf("enqueue: %v", err)
+			}
+			d.wg.Wait()
+
+			got, err := db.GetWebhookDelivery(delivery.ID)
+			if err != nil {
+				t.Fatalf("GetWebhookDelivery: %v", err)
+			}
+			if got.Status != tt.wantStatus || got.Attempts != tt.wantAttempts || got.ResponseCode != tt.wantCode {
+				t.Errorf("delivery = %s after %d attempts (status %d), want %s after %d attempts (status %d)",
+					got.Status, got.Attempts, got.ResponseCode, tt.wantStatus, tt.wantAttempts, tt.wantCode)
+			}
+			if n := len(receiver.received()); n != tt.wantAttempts {
+				t.Errorf("server got %d requests, want %d", n, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{9, 512 * time.Second},
+		{10, webhookMaxBackoff},
+		{50, webhookMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempt); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookBatching(t *testing.T) {
+	fastWebhookBackoff(t)
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	db := newTestDatabase(t)
+	batch := config.Webhook{Name: "batch", URL: server.URL, Batch: true, Events: []string{domain.WebhookEventFileRenamed}}
+	single := config.Webhook{Name: "single", URL: server.URL, Events: []string{domain.WebhookEventFileRenamed, domain.WebhookEventRunFinished}}
+	d := newWebhookDispatcher([]config.Webhook{batch, single}, db)
+	webhooksMu.Lock()
+	webhooks = d
+	webhooksMu.Unlock()
+	t.Cleanup(func() { StopWebhooks(time.Second) })
+
+	// Nhiều event hơn một payload batch; mọi event phải được gửi, không bị bỏ như trên event bus
+	const files = webhookBatchSize + 1
+	root := t.TempDir()
+	publishEvent(Event{Type: EventRunStarted, RunID: "run-1", Root: root})
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("file-%d.txt", i)
+		result := FileResult{Path: filepath.Join(root, name), OldName: name, NewName: name + ".new", Status: StatusRenamed}
+		publishEvent(Event{Type: EventFileRenamed, RunID: "run-1", Root: root, File: &result})
+	}
+	publishEvent(Event{Type: EventRunFinished, RunID: "run-1", Root: root, Summary: &RunSummary{RunID: "run-1", Renamed: files}})
+	// Dry-run không gửi gì
+	publishEvent(Event{Type: EventRunFinished, RunID: "run-2", Root: root, DryRun: true, Summary: &RunSummary{RunID: "run-2"}})
+	d.wg.Wait()
+
+	counts := map[string]int{}
+	batchFiles := 0
+	for _, req := range receiver.received() {
+		counts[req.Payload.Event]++
+		if req.Payload.Event == domain.WebhookEventFilesRenamed {
+			if req.Payload.RunID != "run-1" {
+				t.Errorf("batch run_id = %q, want run-1", req.Payload.RunID)
+			}
+			batchFiles += len(req.Payload.Files)
+		}
+	}
+	if counts[domain.WebhookEventFilesRenamed] != 2 || batchFiles != files {
+		t.Errorf("got %d batches with %d files, want 2 batches with %d files", counts[domain.WebhookEventFilesRenamed], batchFiles, files)
+	}
+	if counts[domain.WebhookEventFileRenamed] != files {
+		t.Errorf("got %d file-renamed deliveries, want %d", counts[domain.WebhookEventFileRenamed], files)
+	}
+	if counts[domain.WebhookEventRunFinished] != 1 {
+		t.Errorf("got %d run-finished deliveries, want 1", counts[domain.WebhookEventRunFinished])
+	}
+	if len(d.batches) != 0 {
+		t.Errorf("batches not released after run-finished: %d runs left", len(d.batches))
+	}
+}
+
+func TestWebhookFileSidecars(t *testing.T) {
+	root := t.TempDir()
+	result := FileResult{
+		Path: filepath.Join(root, "IMG_1.CR2"), OldName: "IMG_1.CR2", NewName: "new.CR2", Status: StatusRenamed,
+		Sidecars: []FileResult{{Path: filepath.Join(root, "IMG_1.xmp"), OldName: "IMG_1.xmp", NewName: "new.xmp",
+			NewPath: filepath.Join(root, "new.xmp"), Status: StatusRenamed}},
+	}
+	f := webhookFile(&result)
+	if len(f.Sidecars) != 1 {
+		t.Fatalf("got %d sidecars, want 1", len(f.Sidecars))
+	}
+	if s := f.Sidecars[0]; s.OldPath != filepath.Join(root, "IMG_1.xmp") || s.NewPath != filepath.Join(root, "new.xmp") {
+		t.Errorf("sidecar = %s → %s, want IMG_1.xmp → new.xmp in %s", s.OldPath, s.NewPath, root)
+	}
+}
+
+func TestWebhookWorkerPool(t *testing.T) {
+	// Chỉ lưu theo lô hoặc khi lượt quét kết thúc, không theo chu kỳ nạp
+	old := webhookPollInterval
+	webhookPollInterval = time.Hour
+	t.Cleanup(func() { webhookPollInterval = old })
+
+	var mu sync.Mutex
+	inFlight, maxInFlight, received := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight--
+		received++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	db := newTestDatabase(t)
+	hook := config.Webhook{Name: "files", URL: server.URL, Events: []string{domain.WebhookEventFileRenamed}}
+	d := newTestDispatcher(t, []config.Webhook{hook}, db)
+	stored := func() int {
+		deliveries, err := db.GetWebhookDeliveries("", "", 1000)
+		if err != nil {
+			t.Fatalf("GetWebhookDeliveries: %v", err)
+		}
+		return len(deliveries)
+	}
+
+	// Số file lớn hơn hàng đợi: phần tràn được nạp lại từ DB khi lượt quét kết thúc
+	const files = webhookQueueSize + webhookInsertBatch + 1
+	root := t.TempDir()
+	for i := 0; i < files; i++ {
+		if i == webhookInsertBatch-1 && stored() != 0 {
+			t.Fatalf("%d deliveries stored before the first batch was full", stored())
+		}
+		name := fmt.Sprintf("file-%d.txt", i)
+		result := FileResult{Path: filepath.Join(root, name), OldName: name, NewName: name + ".new", Status: StatusRenamed}
+		d.handle(Event{Type: EventFileRenamed, RunID: "run-1", Root: root, File: &result})
+		if i == webhookInsertBatch-1 && stored() != webhookInsertBatch {
+			t.Fatalf("%d deliveries stored after a full batch, want %d", stored(), webhookInsertBatch)
+		}
+	}
+	d.handle(Event{Type: EventRunFinished, RunID: "run-1", Root: root, Summary: &RunSummary{RunID: "run-1"}})
+	d.loadDue()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := received
+		mu.Unlock()
+		if n >= files || time.Now().After(deadline) {
+			break
+		}
+		d.loadDue()
+		time.Sleep(10 * time.Millisecond)
+	}
+	d.wg.Wait()
+
+	if received != files || stored() != files {
+		t.Errorf("server got %d requests and %d deliveries stored, want %d", received, stored(), files)
+	}
+	if maxInFlight > webhookConcurrency {
+		t.Errorf("%d requests in flight at once, want at most %d", maxInFlight, webhookConcurrency)
+	}
+}
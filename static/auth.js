@@ -0,0 +1,49 @@
+// Shared auth helpers for the web UI: adds the CSRF token to requests that
+// change data, redirects to the login page on 401, hides links above the
+// user's role (data-role) and wires the logout link.
+(function () {
+    function csrfToken() {
+        const match = document.cookie.match(/(?:^|;\s*)auto_rename_csrf=([^;]+)/);
+        return match ? decodeURIComponent(match[1]) : '';
+    }
+
+    const originalFetch = window.fetch.bind(window);
+    window.fetch = function (input, init) {
+        init = init || {};
+        const method = (init.method || 'GET').toUpperCase();
+        if (!['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+            const headers = new Headers(init.headers || {});
+            headers.set('X-CSRF-Token', csrfToken());
+            init.headers = headers;
+        }
+        return originalFetch(input, init).then(response => {
+            if (response.status === 401) {
+                window.location.href = '/login?next=' + encodeURIComponent(window.location.pathname);
+            }
+            return response;
+        });
+    };
+
+    window.logout = function () {
+        fetch('/logout', { method: 'POST' }).finally(() => {
+            window.location.href = '/login';
+        });
+    };
+
+    document.addEventListener('DOMContentLoaded', () => {
+        fetch('/api/me')
+            .then(response => response.json())
+            .then(me => {
+                const levels = { viewer: 1, operator: 2, admin: 3 };
+                document.querySelectorAll('[data-role]').forEach(el => {
+                    if ((levels[me.role] || 0) < levels[el.dataset.role]) el.classList.add('hidden');
+                });
+                const link = document.getElementById('logout-link');
+                if (!link || !me.auth_enabled) return;
+                document.getElementById('current-user').textContent = `${me.name} (${me.role})`;
+                link.classList.remove('hidden');
+                link.classList.add('flex');
+            })
+            .catch(() => {});
+    });
+})();